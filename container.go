@@ -394,6 +394,10 @@ func populateCommand(c *Container) {
 		User:       c.Config.User,
 		Config:     driverConfig,
 		Resources:  resources,
+		Domainname: c.Config.Domainname,
+
+		// Privileged containers have always run unconfined
+		DisableAppArmor: c.hostConfig.Privileged,
 	}
 	c.command.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
 }
@@ -777,7 +781,7 @@ func (container *Container) monitor(callback execdriver.StartCallback) error {
 	if container.command == nil {
 		// This happends when you have a GHOST container with lxc
 		populateCommand(container)
-		err = container.runtime.RestoreCommand(container)
+		exitCode, err = container.runtime.RestoreCommand(container)
 	} else {
 		pipes := execdriver.NewPipes(container.stdin, container.stdout, container.stderr, container.Config.OpenStdin)
 		exitCode, err = container.runtime.Run(container, pipes, callback)
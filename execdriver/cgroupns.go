@@ -0,0 +1,25 @@
+package execdriver
+
+import (
+	"log"
+	"os"
+)
+
+// Whether the kernel supports cgroup namespaces, 4.6 onward
+func CgroupNamespaceSupported() bool {
+	_, err := os.Stat("/proc/self/ns/cgroup")
+	return err == nil
+}
+
+// Returns the dockerinit flags unsharing the cgroup namespace of the
+// container. Older kernels get the host view of the cgroups, with a warning.
+func CgroupNamespaceParams(c *Command) []string {
+	if !c.CgroupNamespace {
+		return nil
+	}
+	if !CgroupNamespaceSupported() {
+		log.Printf("WARNING: Your kernel does not support cgroup namespaces, the cgroups of %s are not isolated", c.ID)
+		return nil
+	}
+	return []string{"-cgroupns"}
+}
@@ -6,7 +6,6 @@ import (
 	"github.com/dotcloud/docker/pkg/mount"
 	"os"
 	"os/exec"
-	"syscall"
 )
 
 const (
@@ -68,23 +67,22 @@ func (d *driver) Run(c *execdriver.Command, pipes *execdriver.Pipes, startCallba
 	}
 
 	err = c.Wait()
-	return getExitCode(c), err
-}
-
-/// Return the exit code of the process
-// if the process has not exited -1 will be returned
-func getExitCode(c *execdriver.Command) int {
-	if c.ProcessState == nil {
-		return -1
-	}
-	return c.ProcessState.Sys().(syscall.WaitStatus).ExitStatus()
+	return c.ExitCode(), err
 }
 
 func (d *driver) Kill(p *execdriver.Command, sig int) error {
 	return p.Process.Kill()
 }
 
-func (d *driver) Restore(c *execdriver.Command) error {
+func (d *driver) Pause(c *execdriver.Command) error {
+	return fmt.Errorf("Not supported")
+}
+
+func (d *driver) Unpause(c *execdriver.Command) error {
+	return fmt.Errorf("Not supported")
+}
+
+func (d *driver) Restore(c *execdriver.Command) (int, error) {
 	panic("Not Implemented")
 }
 
@@ -0,0 +1,18 @@
+package execdriver
+
+// Context is the part of a context.Context the drivers use to let the
+// caller give up on a run, Done is closed and Err set once it is canceled.
+// It's declared here as the context package isn't part of go1.2, any
+// context.Context satisfies it.
+type Context interface {
+	Done() <-chan struct{}
+	Err() error
+}
+
+type background struct{}
+
+func (background) Done() <-chan struct{} { return nil }
+func (background) Err() error            { return nil }
+
+// Background is never canceled, like context.Background
+var Background Context = background{}
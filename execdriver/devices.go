@@ -0,0 +1,117 @@
+package execdriver
+
+import (
+	"fmt"
+	"github.com/dotcloud/docker/utils"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Device node created by dockerinit in the container, with the
+// type, numbers, permissions and ownership of the host node
+type InitDevice struct {
+	Path string
+	Mode uint32 // st_mode, including the file type bits
+	Rdev uint64
+	Uid  int
+	Gid  int
+}
+
+// Format as the value of the dockerinit -device flag
+func (d *InitDevice) String() string {
+	return strings.Join([]string{
+		d.Path,
+		strconv.FormatUint(uint64(d.Mode), 8),
+		strconv.FormatUint(d.Rdev, 10),
+		strconv.Itoa(d.Uid),
+		strconv.Itoa(d.Gid),
+	}, ",")
+}
+
+// Parse the value of a dockerinit -device flag
+func ParseInitDevice(value string) (*InitDevice, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 5 || !filepath.IsAbs(parts[0]) {
+		return nil, fmt.Errorf("Invalid device %q", value)
+	}
+	mode, err := strconv.ParseUint(parts[1], 8, 32)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid mode for device %q: %s", value, err)
+	}
+	rdev, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid device number for device %q: %s", value, err)
+	}
+	uid, err := strconv.Atoi(parts[3])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid uid for device %q: %s", value, err)
+	}
+	gid, err := strconv.Atoi(parts[4])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid gid for device %q: %s", value, err)
+	}
+	return &InitDevice{Path: parts[0], Mode: uint32(mode), Rdev: rdev, Uid: uid, Gid: gid}, nil
+}
+
+// Returns the limit in the format of the blkio.throttle files,
+// e.g. "8:0 1048576", after checking Path is a block device
+func (t *ThrottleDevice) CgroupString() (string, error) {
+	rate, err := utils.RAMInBytes(t.Rate)
+	if err != nil || rate <= 0 {
+		return "", fmt.Errorf("Invalid rate %q for device %s", t.Rate, t.Path)
+	}
+	fi, err := os.Stat(t.Path)
+	if err != nil {
+		return "", fmt.Errorf("Invalid device %s: %s", t.Path, err)
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if fi.Mode()&os.ModeDevice == 0 || fi.Mode()&os.ModeCharDevice != 0 || !ok {
+		return "", fmt.Errorf("Invalid device %s: not a block device", t.Path)
+	}
+	return fmt.Sprintf("%d:%d %d", major(uint64(st.Rdev)), minor(uint64(st.Rdev)), rate), nil
+}
+
+func major(device uint64) uint64 {
+	return (device >> 8) & 0xfff
+}
+
+func minor(device uint64) uint64 {
+	return (device & 0xff) | ((device >> 12) & 0xfff00)
+}
+
+// Returns the dockerinit flags creating the allowed devices of the
+// container, after checking each of them is a device node on the host
+func DeviceParams(c *Command) ([]string, error) {
+	var params []string
+	for _, dev := range c.AllowedDevices {
+		if !strings.ContainsRune("abc", dev.Type) {
+			return nil, fmt.Errorf("Invalid type %q for device %s, expected a, b or c", dev.Type, dev.Path)
+		}
+		if dev.Permissions == "" || strings.Trim(dev.Permissions, "rwm") != "" {
+			return nil, fmt.Errorf("Invalid permissions %q for device %s, expected any of rwm", dev.Permissions, dev.Path)
+		}
+		if !filepath.IsAbs(dev.Path) {
+			return nil, fmt.Errorf("Invalid device %s: the path must be absolute", dev.Path)
+		}
+		fi, err := os.Stat(dev.Path)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid device %s: %s", dev.Path, err)
+		}
+		st, ok := fi.Sys().(*syscall.Stat_t)
+		if fi.Mode()&os.ModeDevice == 0 || !ok {
+			return nil, fmt.Errorf("Invalid device %s: not a device node", dev.Path)
+		}
+		init := &InitDevice{
+			Path: dev.Path,
+			Mode: uint32(st.Mode),
+			Rdev: uint64(st.Rdev),
+			Uid:  int(st.Uid),
+			Gid:  int(st.Gid),
+		}
+		params = append(params, "-device", init.String())
+	}
+	return params, nil
+}
@@ -2,9 +2,14 @@ package execdriver
 
 import (
 	"errors"
+	"fmt"
+	"github.com/dotcloud/docker/pkg/seccomp"
 	"io"
 	"os"
 	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
 )
 
 var (
@@ -51,6 +56,30 @@ type InitArgs struct {
 	Args       []string
 	Mtu        int
 	Driver     string
+	CapAdd     []string
+	CapDrop    []string
+	Root       string // rootfs to move to before the setup, for drivers not doing it themselves
+	Console    string
+	Veth       string // name of the interface to rename to eth0
+	Gateway6   string
+	Ip6        string
+	Interfaces []*InitInterface // interfaces to configure after eth0
+	NoNewPrivs bool
+	Seccomp    *seccomp.Profile // syscall filter installed right before running the process
+	Devices    []*InitDevice
+	Domainname string
+	Ulimits    []*Ulimit
+	NetNsFd    int // descriptor of the network namespace to join, -1 if none
+	CgroupNs   bool
+	MkWorkDir  bool // create WorkDir when missing
+	GroupAdd   []string
+	Masked     []string // paths hidden behind /dev/null or an empty tmpfs
+	Readonly   []string // paths remounted read-only
+
+	Propagate map[string]string // mount destinations to their propagation
+	HostUts   bool              // the UTS namespace is the host's, not to be renamed
+	ShmSize   int64             // size of the tmpfs of /dev/shm, the default when 0
+	Sysctls   map[string]string // from their key, e.g. net.core.somaxconn
 }
 
 // Driver specific information based on
@@ -74,25 +103,192 @@ type TtyTerminal interface {
 type Driver interface {
 	Run(c *Command, pipes *Pipes, startCallback StartCallback) (int, error) // Run executes the process and blocks until the process exits and returns the exit code
 	Kill(c *Command, sig int) error
-	Restore(c *Command) error                     // Wait and try to re-attach on an out of process command
+	Pause(c *Command) error
+	Unpause(c *Command) error
+	Restore(c *Command) (int, error)              // Wait and try to re-attach on an out of process command, returns the exit code or -1 when unknown
 	Name() string                                 // Driver name
 	Info(id string) Info                          // "temporary" hack (until we move state from core to plugins)
 	GetPidsForContainer(id string) ([]int, error) // Returns a list of pids for the given container.
 }
 
+// When to relaunch a container which exited, Name is "no" (the default),
+// "on-failure" for a non-zero exit code or "always"
+type RestartPolicy struct {
+	Name              string `json:"name"`
+	MaximumRetryCount int    `json:"maximum_retry_count"` // 0 for unlimited
+}
+
+func (p RestartPolicy) Validate() error {
+	switch p.Name {
+	case "", "no", "on-failure", "always":
+	default:
+		return fmt.Errorf("Invalid restart policy %q, expected no, on-failure or always", p.Name)
+	}
+	if p.MaximumRetryCount < 0 {
+		return fmt.Errorf("Invalid maximum retry count %d for restart policy %s", p.MaximumRetryCount, p.Name)
+	}
+	return nil
+}
+
+// Whether a container exiting with exitCode after having
+// already been restarted restarts times should be relaunched
+func (p RestartPolicy) ShouldRestart(exitCode, restarts int) bool {
+	if p.MaximumRetryCount > 0 && restarts >= p.MaximumRetryCount {
+		return false
+	}
+	switch p.Name {
+	case "always":
+		return true
+	case "on-failure":
+		return exitCode != 0
+	}
+	return false
+}
+
+// What a driver observed of the launches of a container since its last Run
+type RunState struct {
+	Restarts     int       `json:"restarts"`       // relaunches under the restart policy
+	LastExitCode int       `json:"last_exit_code"` // -1 when the last launch failed
+	FinishedAt   time.Time `json:"finished_at"`    // when the last launch exited
+
+	OOMKilled bool `json:"oom_killed"` // the last launch hit its memory limit
+}
+
+type KeyValuePair struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Features a driver supports on this host, so that options it
+// can't honor are rejected before trying to start the container
+type DriverCapabilities struct {
+	Pause          bool // Pause and Unpause, needs the freezer cgroup
+	Exec           bool // running extra processes in a running container
+	MemorySwap     bool // swap limits, needs swap accounting in the memory cgroup
+	CpusetCgroup   bool
+	BlkioCgroup    bool
+	PidsCgroup     bool
+	UserNamespaces bool
+}
+
 // Network settings of the container
+// Used as Network.Gateway to have lxc configure the address and route
+// through the address of the bridge, no default route when empty
+const AutoGateway = "auto"
+
 type Network struct {
 	Gateway     string `json:"gateway"`
 	IPAddress   string `json:"ip"`
 	Bridge      string `json:"bridge"`
 	IPPrefixLen int    `json:"ip_prefix_len"`
 	Mtu         int    `json:"mtu"`
+
+	IPv6Address   string `json:"ipv6"` // IPv6 is not configured when empty
+	IPv6PrefixLen int    `json:"ipv6_prefix_len"`
+	IPv6Gateway   string `json:"ipv6_gateway"`
+
+	MacAddress   string `json:"mac_address"`   // randomly assigned when empty
+	DefaultRoute bool   `json:"default_route"` // route through this gateway, by default only the first interface does
+
+	VethName string `json:"veth_name"` // name of the host side of the veth pair, randomly chosen when empty
+
+	NetworkBandwidth int64 `json:"network_bandwidth"` // cap of what the container sends, in bytes per second, requires VethName
+
+	NetNsPath          string `json:"netns_path"`           // join this network namespace, e.g. /proc/<pid>/ns/net, instead of creating interfaces
+	NetworkContainerID string `json:"network_container_id"` // join the network namespace of this running container, like NetNsPath
 }
 
 type Resources struct {
-	Memory     int64 `json:"memory"`
-	MemorySwap int64 `json:"memory_swap"`
-	CpuShares  int64 `json:"cpu_shares"`
+	Memory      int64  `json:"memory"`
+	MemorySwap  int64  `json:"memory_swap"` // 0 defaults to twice Memory, -1 disables the swap limit
+	CpuShares   int64  `json:"cpu_shares"`
+	CpusetCpus  string `json:"cpuset_cpus"`  // list of cpus the container may run on, e.g. "0-2,7"
+	CpusetMems  string `json:"cpuset_mems"`  // list of NUMA memory nodes the container may allocate from
+	BlkioWeight uint16 `json:"blkio_weight"` // relative disk I/O weight, from 10 to 1000
+	PidsLimit   int64  `json:"pids_limit"`   // maximum number of tasks, 0 or -1 for unlimited
+
+	// CFS limit of CpuQuota of cpu time every CpuPeriod, in microseconds, e.g.
+	// half a core with a quota of 50000 and a period of 100000
+	CpuPeriod int64 `json:"cpu_period"`
+	CpuQuota  int64 `json:"cpu_quota"`
+
+	// Pause the container instead of killing it when it runs out of
+	// memory, it may then hang until the limit is raised or memory freed
+	OomKillDisable bool `json:"oom_kill_disable"`
+
+	// Soft limit the memory of the container is reclaimed down to
+	// under memory pressure, at most Memory when both are set
+	MemoryReservation int64 `json:"memory_reservation"`
+
+	BlkioDeviceReadBps  []ThrottleDevice `json:"blkio_device_read_bps"`  // hard read throughput limits, per block device
+	BlkioDeviceWriteBps []ThrottleDevice `json:"blkio_device_write_bps"` // hard write throughput limits, per block device
+}
+
+// Check the memory swappiness of a container, nil is unset
+func ValidateMemorySwappiness(swappiness *int64) error {
+	if swappiness != nil && (*swappiness < 0 || *swappiness > 100) {
+		return fmt.Errorf("Memory swappiness %d is out of range, it must be between 0 and 100", *swappiness)
+	}
+	return nil
+}
+
+// Throughput limit of a block device of the host
+type ThrottleDevice struct {
+	Path string `json:"path"` // block device node, e.g. /dev/sda
+	Rate string `json:"rate"` // bytes per second, with an optional k, m or g suffix
+}
+
+// Host path bind mounted in the container
+type Mount struct {
+	Source      string `json:"source"`      // path on the host
+	Destination string `json:"destination"` // path in the container
+	Writable    bool   `json:"writable"`
+
+	MountPropagation string `json:"mount_propagation"` // "private", "shared", "slave" or their recursive "r" variants, DefaultMountPropagation when empty
+}
+
+// Host device node the container is granted access to, it is bind
+// mounted at the same path in the container or created by dockerinit
+// where the driver doesn't mount it
+type DeviceEntry struct {
+	Path        string `json:"path"`
+	Type        rune   `json:"type"`        // 'c', 'b' or 'a' for all
+	Major       int64  `json:"major"`       // -1 for any
+	Minor       int64  `json:"minor"`       // -1 for any
+	Permissions string `json:"permissions"` // any of "rwm"
+}
+
+// Returns the entry in the format of devices.allow, e.g. "c 195:0 rwm"
+func (d *DeviceEntry) CgroupString() string {
+	number := func(n int64) string {
+		if n < 0 {
+			return "*"
+		}
+		return strconv.FormatInt(n, 10)
+	}
+	return fmt.Sprintf("%c %s:%s %s", d.Type, number(d.Major), number(d.Minor), d.Permissions)
+}
+
+// Limit of the memory of the container backed by hugepages of PageSize
+type HugepageLimit struct {
+	PageSize string `json:"page_size"` // as named by the hugetlb cgroup, e.g. "2MB" or "1GB"
+	Limit    int64  `json:"limit"`     // bytes
+}
+
+// Range of ids of the container mapped to ids on the host
+type IDMap struct {
+	ContainerID int `json:"container_id"`
+	HostID      int `json:"host_id"`
+	Size        int `json:"size"`
+}
+
+// Resource usage of a container as accounted by its cgroups
+type ResourceStats struct {
+	MemoryUsage int64 `json:"memory_usage"` // bytes
+	MemoryLimit int64 `json:"memory_limit"` // bytes
+	CpuUsage    int64 `json:"cpu_usage"`    // total cpu time in nanoseconds
+	CpuUser     int64 `json:"cpu_user"`     // user cpu time in nanoseconds
+	CpuSystem   int64 `json:"cpu_system"`   // system cpu time in nanoseconds
 }
 
 // Process wrapps an os/exec.Cmd to add more metadata
@@ -102,7 +298,7 @@ type Command struct {
 	ID         string     `json:"id"`
 	Privileged bool       `json:"privileged"`
 	User       string     `json:"user"`
-	Rootfs     string     `json:"rootfs"`   // root fs of the container
+	Rootfs     string     `json:"rootfs"`   // root fs of the container, anywhere on the host
 	InitPath   string     `json:"initpath"` // dockerinit
 	Entrypoint string     `json:"entrypoint"`
 	Arguments  []string   `json:"arguments"`
@@ -113,6 +309,117 @@ type Command struct {
 	Config     []string   `json:"config"`  //  generic values that specific drivers can consume
 	Resources  *Resources `json:"resources"`
 
+	CapAdd         []string `json:"cap_add"`         // capabilities to keep on top of the unprivileged set
+	CapDrop        []string `json:"cap_drop"`        // capabilities to drop from the unprivileged set
+	ReadonlyRootfs bool     `json:"readonly_rootfs"` // mount the root fs read-only, only volumes and scratch tmpfs stay writable
+	Dns            []string `json:"dns"`             // nameservers written to the container's resolv.conf
+	DnsSearch      []string `json:"dns_search"`      // search domains written to the container's resolv.conf
+
+	Mounts []Mount           `json:"mounts"` // host paths bind mounted in the container
+	Tmpfs  map[string]string `json:"tmpfs"`  // tmpfs mounts, from destination to mount options
+
+	UidMappings []IDMap `json:"uid_mappings"` // user namespace uid remapping, disabled when empty
+	GidMappings []IDMap `json:"gid_mappings"` // user namespace gid remapping, disabled when empty
+
+	HostNetworking bool `json:"host_networking"` // share the network namespace of the host, Network is then ignored
+
+	Networks []*Network `json:"networks"` // interfaces added after Network, named eth1 onward
+
+	NoNewPrivileges bool   `json:"no_new_privileges"` // forbid gaining privileges through setuid binaries or file capabilities
+	AppArmorProfile string `json:"apparmor_profile"`  // name of the AppArmor profile to confine the container with, the default when empty
+	SeccompProfile  string `json:"seccomp_profile"`   // path to the JSON syscall filtering profile, "default" for the built-in one
+
+	DisableAppArmor bool `json:"disable_apparmor"` // run unconfined, independently of Privileged
+
+	GenerateAppArmor bool `json:"generate_apparmor"` // confine the container with a profile generated from its mounts and devices, loaded for the time it runs
+
+	AllowedDevices []DeviceEntry `json:"allowed_devices"` // device nodes granted on top of the defaults, restricts privileged containers too
+
+	Domainname string `json:"domainname"` // NIS domain name, the hostname comes from the HOSTNAME variable
+
+	TtyHeight int `json:"tty_height"` // initial size of the tty, the pty default when 0
+	TtyWidth  int `json:"tty_width"`
+
+	LxcConf []KeyValuePair `json:"lxc_conf"` // raw lxc.* lines appended to the generated config
+
+	RestartPolicy RestartPolicy `json:"restart_policy"` // relaunch the container by the driver when it exits
+
+	Ulimits []Ulimit `json:"ulimits"` // resource limits of the process, e.g. a higher nofile for databases
+
+	// Environment of the process of the container, nothing from the host is
+	// passed through. Not to be confused with Cmd.Env, the one of the launcher.
+	// When nil the environment the daemon wrote in /.dockerenv is kept.
+	Env []string `json:"env"`
+
+	// For debugging only: command prefixed to the invocation of dockerinit in
+	// the container, e.g. ["strace", "-f"]. It must exist in the rootfs and
+	// exec dockerinit with the same arguments and environment, the driver
+	// can't tell a failing wrapper from a failing container.
+	InitWrapper []string `json:"init_wrapper"`
+
+	CgroupNamespace bool `json:"cgroup_namespace"` // root /proc/self/cgroup at the cgroups of the container, when the kernel supports it
+
+	CreateWorkingDir bool `json:"create_working_dir"` // create WorkingDir in the container when missing instead of failing
+
+	GroupAdd []string `json:"group_add"` // supplementary groups of the process, names from the /etc/group of the container or gids
+
+	// Share the pid namespace of the host instead of getting a new one. The
+	// container then sees and, with the capabilities to do so, can signal or
+	// ptrace every process of the host, and its own init is not pid 1.
+	// Only for trusted monitoring and debugging tools.
+	HostPid bool `json:"host_pid"`
+
+	// IPC namespace and /dev/shm of the container, its own when empty, the
+	// ones of the host with "host" or of a running container with "container:<id>"
+	IpcMode string `json:"ipc_mode"`
+
+	// UTS namespace of the container, its own when empty or the one of the
+	// host with "host", the hostname and domain name are then the host's
+	UTSMode string `json:"uts_mode"`
+
+	AutoDev bool `json:"autodev"` // have the driver populate a minimal /dev rather than using the one of the rootfs, when supported
+
+	CgroupParent string `json:"cgroup_parent"` // cgroup the one of the container is created under, relative to the daemon's, e.g. "docker-batch"
+
+	MaskedPaths   []string `json:"masked_paths"`   // hidden from the container, DefaultMaskedPaths when nil
+	ReadonlyPaths []string `json:"readonly_paths"` // read-only in the container, DefaultReadonlyPaths when nil
+
+	HugepageLimits []HugepageLimit `json:"hugepage_limits"` // hugetlb cgroup limits, ignored when the subsystem isn't mounted
+
+	// Also write the output of the container to console.log in its directory,
+	// to be read back by those attaching late, e.g. after a crash. It's
+	// rotated to console.log.1 past ConsoleLogSize bytes, unlimited when 0.
+	ConsoleLog     bool  `json:"console_log"`
+	ConsoleLogSize int64 `json:"console_log_size"`
+
+	// Host commands run around the life of the container, with its id in
+	// DOCKER_CONTAINER_ID and the pid of its init in DOCKER_CONTAINER_PID
+	// when it runs. A failing PreStart aborts the start, the failures of
+	// the others are only logged.
+	PreStart  []string `json:"pre_start"`
+	PostStart []string `json:"post_start"`
+	PreStop   []string `json:"pre_stop"`
+	PostStop  []string `json:"post_stop"`
+
+	MemorySwappiness *int64 `json:"memory_swappiness"` // from 0 to 100, 0 swapping as little as possible, the cgroup default when nil
+
+	// Limit of the memory the kernel allocates for the container, e.g. its
+	// dentries and socket buffers, unlimited when 0. The kernel only takes it
+	// before any task joins the memory cgroup, it's set as it's created.
+	KernelMemory int64 `json:"kernel_memory"`
+
+	ShmSize int64 `json:"shm_size"` // size of the tmpfs of /dev/shm in bytes, DefaultShmSize when 0
+
+	// Kernel parameters set in the namespaces of the container, e.g.
+	// net.core.somaxconn. Those which aren't namespaced, like
+	// vm.max_map_count, are only allowed for privileged containers.
+	Sysctls map[string]string `json:"sysctls"`
+
+	// Autostart metadata for the lxc tools booting containers on their own
+	// (lxc-autostart), docker doesn't act on it. A StartOrder of 0 is unset.
+	StartAuto  bool `json:"start_auto"`
+	StartOrder int  `json:"start_order"`
+
 	Terminal Terminal `json:"-"` // standard or tty terminal
 	Console  string   `json:"-"` // dev/console path
 }
@@ -125,3 +432,22 @@ func (c *Command) Pid() int {
 	}
 	return c.Process.Pid
 }
+
+// Return the exit code of the process
+// If the process has not exited -1 will be returned
+func (c *Command) ExitCode() int {
+	if c.ProcessState == nil {
+		return -1
+	}
+	return ExitStatus(c.ProcessState)
+}
+
+// Return the exit code of an exited process, like shells death by a
+// signal is reported as 128+signal
+func ExitStatus(state *os.ProcessState) int {
+	ws := state.Sys().(syscall.WaitStatus)
+	if ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return ws.ExitStatus()
+}
@@ -0,0 +1,268 @@
+package execdriver
+
+import (
+	"github.com/dotcloud/docker/pkg/term"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestDeviceEntryCgroupString(t *testing.T) {
+	dev := &DeviceEntry{Type: 'c', Major: 136, Minor: -1, Permissions: "rwm"}
+	if s := dev.CgroupString(); s != "c 136:* rwm" {
+		t.Fatalf("Expected c 136:* rwm, got %s", s)
+	}
+}
+
+func TestDeviceParams(t *testing.T) {
+	c := &Command{
+		AllowedDevices: []DeviceEntry{
+			{Path: "/dev/null", Type: 'c', Major: 1, Minor: 3, Permissions: "rwm"},
+		},
+	}
+	params, err := DeviceParams(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(params) != 2 || params[0] != "-device" {
+		t.Fatalf("Expected a single -device flag, got %v", params)
+	}
+	dev, err := ParseInitDevice(params[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dev.Path != "/dev/null" || dev.Mode&syscall.S_IFMT != syscall.S_IFCHR || dev.Rdev == 0 {
+		t.Fatalf("Unexpected device %v", dev)
+	}
+
+	for _, entry := range []DeviceEntry{
+		{Path: "/dev/nvidia-missing", Type: 'c', Major: 195, Minor: 0, Permissions: "rwm"},
+		{Path: "/etc/passwd", Type: 'c', Major: 1, Minor: 3, Permissions: "rwm"},
+		{Path: "/dev/null", Type: 'x', Major: 1, Minor: 3, Permissions: "rwm"},
+		{Path: "/dev/null", Type: 'c', Major: 1, Minor: 3, Permissions: "rwx"},
+	} {
+		c.AllowedDevices = []DeviceEntry{entry}
+		if _, err := DeviceParams(c); err == nil {
+			t.Errorf("Expected an error for device %v", entry)
+		}
+	}
+}
+
+func TestThrottleDeviceCgroupString(t *testing.T) {
+	if _, err := os.Stat("/dev/loop0"); err != nil {
+		t.Skip("/dev/loop0 is not available")
+	}
+	throttle := &ThrottleDevice{Path: "/dev/loop0", Rate: "1m"}
+	if s, err := throttle.CgroupString(); err != nil || s != "7:0 1048576" {
+		t.Fatalf("Expected 7:0 1048576, got %q (%v)", s, err)
+	}
+
+	for _, entry := range []ThrottleDevice{
+		{Path: "/dev/null", Rate: "1m"},
+		{Path: "/dev/loop-missing", Rate: "1m"},
+		{Path: "/dev/loop0", Rate: "fast"},
+		{Path: "/dev/loop0", Rate: "0"},
+	} {
+		if _, err := entry.CgroupString(); err == nil {
+			t.Errorf("Expected an error for %v", entry)
+		}
+	}
+}
+
+func TestRestartPolicyShouldRestart(t *testing.T) {
+	for _, test := range []struct {
+		policy   RestartPolicy
+		exitCode int
+		restarts int
+		restart  bool
+	}{
+		{RestartPolicy{}, 1, 0, false},
+		{RestartPolicy{Name: "no"}, 1, 0, false},
+		{RestartPolicy{Name: "on-failure"}, 0, 0, false},
+		{RestartPolicy{Name: "on-failure"}, 1, 10, true},
+		{RestartPolicy{Name: "on-failure", MaximumRetryCount: 3}, 1, 2, true},
+		{RestartPolicy{Name: "on-failure", MaximumRetryCount: 3}, 1, 3, false},
+		{RestartPolicy{Name: "always"}, 0, 0, true},
+		{RestartPolicy{Name: "always", MaximumRetryCount: 1}, 0, 1, false},
+	} {
+		if restart := test.policy.ShouldRestart(test.exitCode, test.restarts); restart != test.restart {
+			t.Errorf("Expected %v after exit code %d and %d restarts to restart=%t", test.policy, test.exitCode, test.restarts, test.restart)
+		}
+	}
+
+	if err := (RestartPolicy{Name: "sometimes"}).Validate(); err == nil {
+		t.Error("Expected an error for an unknown restart policy")
+	}
+}
+
+func TestWriteEnv(t *testing.T) {
+	rootfs, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootfs)
+
+	if err := WriteEnv(&Command{Rootfs: rootfs}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(rootfs, ".dockerenv")); !os.IsNotExist(err) {
+		t.Fatal("Expected /.dockerenv to be left alone without an explicit environment")
+	}
+
+	if err := WriteEnv(&Command{Rootfs: rootfs, Env: []string{"HOME=/", "FOO=bar"}}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(rootfs, ".dockerenv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `["HOME=/","FOO=bar"]` {
+		t.Fatalf("Unexpected environment %s", data)
+	}
+}
+
+func TestTtyConsoleInitialSize(t *testing.T) {
+	c := &Command{Tty: true, TtyHeight: 40, TtyWidth: 120}
+	tty, err := NewTtyConsole(c, NewPipes(nil, ioutil.Discard, ioutil.Discard, false))
+	if err != nil {
+		t.Skipf("Unable to allocate a pty: %s", err)
+	}
+	defer tty.Close()
+
+	ws, err := term.GetWinsize(tty.Master().Fd())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ws.Height != 40 || ws.Width != 120 {
+		t.Fatalf("Expected a 40x120 tty, got %dx%d", ws.Height, ws.Width)
+	}
+}
+
+func TestParseContainerState(t *testing.T) {
+	for _, state := range []ContainerState{StateStopped, StateStarting, StateRunning, StateStopping, StateAborting, StateFreezing, StateFrozen} {
+		parsed, err := ParseContainerState(state.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed != state {
+			t.Errorf("Expected %s, got %s", state, parsed)
+		}
+	}
+	for _, name := range []string{"", "UNKNOWN", "running"} {
+		if _, err := ParseContainerState(name); err == nil {
+			t.Errorf("Expected an error parsing %q", name)
+		}
+	}
+}
+
+func TestCgroupNamespaceParams(t *testing.T) {
+	c := &Command{ID: "1"}
+	if params := CgroupNamespaceParams(c); len(params) != 0 {
+		t.Fatalf("Expected no params, got %v", params)
+	}
+	c.CgroupNamespace = true
+	params := CgroupNamespaceParams(c)
+	if CgroupNamespaceSupported() != (len(params) == 1 && params[0] == "-cgroupns") {
+		t.Fatalf("Unexpected params %v, cgroup namespaces supported: %v", params, CgroupNamespaceSupported())
+	}
+}
+
+func TestPathParams(t *testing.T) {
+	params, err := PathParams(&Command{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(params) != 4 || params[0] != "-masked-paths" || params[2] != "-readonly-paths" {
+		t.Fatalf("Expected the default masked and read-only paths, got %v", params)
+	}
+
+	// Privileged containers keep /proc/sys writable but not /proc/kcore readable
+	params, err = PathParams(&Command{Privileged: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(params) != 2 || params[0] != "-masked-paths" {
+		t.Fatalf("Expected only the masked paths, got %v", params)
+	}
+
+	params, err = PathParams(&Command{MaskedPaths: []string{}, ReadonlyPaths: []string{"/proc/sys", "/sys"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(params) != 2 || params[0] != "-readonly-paths" || params[1] != "/proc/sys:/sys" {
+		t.Fatalf("Expected the read-only paths given, got %v", params)
+	}
+
+	if _, err := PathParams(&Command{MaskedPaths: []string{"proc/kcore"}}); err == nil {
+		t.Fatal("Expected an error for a relative path")
+	}
+
+	params, err = PathParams(&Command{
+		MaskedPaths:   []string{},
+		ReadonlyPaths: []string{},
+		Mounts:        []Mount{{Destination: "/data"}, {Destination: "/a=b", MountPropagation: "rslave"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(params) != 2 || params[0] != "-propagation" || params[1] != "/data=rprivate:/a=b=rslave" {
+		t.Fatalf("Expected the propagation of the mounts, got %v", params)
+	}
+	propagations, err := ParsePropagations(strings.Split(params[1], ":"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(propagations, map[string]string{"/data": "rprivate", "/a=b": "rslave"}) {
+		t.Fatalf("Expected the propagations back, got %v", propagations)
+	}
+	if _, err := PathParams(&Command{Mounts: []Mount{{Destination: "/data", MountPropagation: "bidirectional"}}}); err == nil {
+		t.Fatal("Expected an error for an invalid mount propagation")
+	}
+	if _, err := ParsePropagations([]string{"/data=bidirectional"}); err == nil {
+		t.Fatal("Expected an error for an invalid propagation")
+	}
+}
+
+func TestParseTasks(t *testing.T) {
+	pids := ParseTasks([]byte("4012\r\n 3998 \n\n41\n4100\t\n"))
+	if !reflect.DeepEqual(pids, []int{4012, 3998, 41, 4100}) {
+		t.Fatalf("Expected the pids without whitespace, got %v", pids)
+	}
+	// A pid read mid-write or garbage doesn't hide the others
+	pids = ParseTasks([]byte("4012\nabc\n-1\n3998\n"))
+	if !reflect.DeepEqual(pids, []int{4012, 3998}) {
+		t.Fatalf("Expected the invalid entries to be skipped, got %v", pids)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	run := func(script string, kill bool) int {
+		c := &Command{}
+		c.Cmd = *exec.Command("/bin/sh", "-c", script)
+		if err := c.Start(); err != nil {
+			t.Fatal(err)
+		}
+		if kill {
+			c.Process.Kill()
+		}
+		c.Wait()
+		return c.ExitCode()
+	}
+	if code := run("exit 0", false); code != 0 {
+		t.Errorf("Expected 0, got %d", code)
+	}
+	if code := run("exit 42", false); code != 42 {
+		t.Errorf("Expected 42, got %d", code)
+	}
+	if code := run("sleep 10", true); code != 128+int(syscall.SIGKILL) {
+		t.Errorf("Expected %d for SIGKILL, got %d", 128+int(syscall.SIGKILL), code)
+	}
+	if code := (&Command{}).ExitCode(); code != -1 {
+		t.Errorf("Expected -1 before the process exited, got %d", code)
+	}
+}
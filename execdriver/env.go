@@ -0,0 +1,20 @@
+package execdriver
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// Write the environment of the container where dockerinit reads it,
+// /.dockerenv in the rootfs, when the command sets one explicitly
+func WriteEnv(c *Command) error {
+	if c.Env == nil {
+		return nil
+	}
+	data, err := json.Marshal(c.Env)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(c.Rootfs, ".dockerenv"), data, 0600)
+}
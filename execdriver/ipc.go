@@ -0,0 +1,28 @@
+package execdriver
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Command.IpcMode sharing the IPC namespace and /dev/shm of the host
+const IpcModeHost = "host"
+
+// Returns the id of the container whose IPC namespace is joined with
+// an IpcMode of "container:<id>", empty otherwise
+func (c *Command) IpcContainer() string {
+	if strings.HasPrefix(c.IpcMode, "container:") {
+		return strings.TrimPrefix(c.IpcMode, "container:")
+	}
+	return ""
+}
+
+func ValidateIpcMode(mode string) error {
+	if mode == "" || mode == IpcModeHost {
+		return nil
+	}
+	if strings.HasPrefix(mode, "container:") && strings.TrimPrefix(mode, "container:") != "" {
+		return nil
+	}
+	return fmt.Errorf("Invalid IPC mode %q, expected host or container:<id>", mode)
+}
@@ -0,0 +1,134 @@
+package lxc
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/dotcloud/docker/execdriver"
+	"github.com/dotcloud/docker/utils"
+	"os/exec"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// AppArmor profile generated for containers with GenerateAppArmor. The
+// rules apply in the container once dockerinit runs, mounts are allowed
+// for its own setup.
+const AppArmorTemplate = `
+#include <tunables/global>
+
+profile {{.Name}} flags=(attach_disconnected,mediate_deleted) {
+  #include <abstractions/base>
+
+  network,
+  capability,
+  file,
+  mount,
+  umount,
+
+  deny @{PROC}/sysrq-trigger rwklx,
+  deny @{PROC}/kcore rwklx,
+  deny @{PROC}/sys/kernel/[^s][^h][^m]* wklx,
+  deny /sys/firmware/** rwklx,
+  deny /sys/kernel/security/** rwklx,
+{{range $m := .Mounts}}
+{{if $m.Writable}}
+  "{{$m.Destination}}/**" rwkl,
+{{else}}
+  deny "{{$m.Destination}}/**" wl,
+{{end}}
+{{end}}
+{{range $dev := .AllowedDevices}}
+{{with $perms := appArmorDevicePerms $dev.Permissions}}
+  "{{$dev.Path}}" {{$perms}},
+{{end}}
+{{end}}
+}
+`
+
+var AppArmorTemplateCompiled *template.Template
+
+// Name of the profile generated for the container id
+func generatedProfileName(id string) string {
+	return "docker-" + id
+}
+
+// The access to a device node of the devices cgroup permissions, mknod
+// has no AppArmor counterpart
+func appArmorDevicePerms(permissions string) string {
+	var perms string
+	if strings.Contains(permissions, "r") {
+		perms += "r"
+	}
+	if strings.Contains(permissions, "w") {
+		perms += "w"
+	}
+	return perms
+}
+
+// Paths are quoted in the rules, one holding a quote, a backslash or a
+// line break would end its rule and start another one
+func validateAppArmorPath(p string) error {
+	if strings.ContainsAny(p, "\"\\") || strings.IndexFunc(p, unicode.IsControl) >= 0 {
+		return fmt.Errorf("Invalid path %q for the AppArmor profile, quotes, backslashes and control characters are not allowed", p)
+	}
+	return nil
+}
+
+// Render the AppArmor profile of c, confining it to its mounts and devices
+func generateAppArmorProfile(c *execdriver.Command) ([]byte, error) {
+	for _, m := range c.Mounts {
+		if err := validateAppArmorPath(m.Destination); err != nil {
+			return nil, err
+		}
+	}
+	for _, dev := range c.AllowedDevices {
+		if err := validateAppArmorPath(dev.Path); err != nil {
+			return nil, err
+		}
+	}
+	var buf bytes.Buffer
+	err := AppArmorTemplateCompiled.Execute(&buf, struct {
+		*execdriver.Command
+		Name string
+	}{
+		Command: c,
+		Name:    generatedProfileName(c.ID),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Load the profile data into the kernel, replacing the one of the same name
+func loadApparmorProfile(name string, data []byte) error {
+	cmd := exec.Command("apparmor_parser", "-r")
+	cmd.Stdin = bytes.NewReader(data)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("Unable to load the AppArmor profile %s: %s (%s)", name, err, bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+// Unload the profile name from the kernel, apparmor_parser only needs its name
+func unloadApparmorProfile(name string) error {
+	cmd := exec.Command("apparmor_parser", "-R")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("profile %s {}\n", name))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("Unable to unload the AppArmor profile %s: %s (%s)", name, err, bytes.TrimSpace(output))
+	}
+	utils.Debugf("Unloaded the AppArmor profile %s", name)
+	return nil
+}
+
+func init() {
+	var err error
+	funcMap := template.FuncMap{
+		"appArmorDevicePerms": appArmorDevicePerms,
+	}
+	AppArmorTemplateCompiled, err = template.New("apparmor").Funcs(funcMap).Parse(AppArmorTemplate)
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,86 @@
+package lxc
+
+import (
+	"github.com/dotcloud/docker/execdriver"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestGenerateAppArmorProfile(t *testing.T) {
+	c := &execdriver.Command{
+		ID: "1",
+		Mounts: []execdriver.Mount{
+			{Source: "/srv/data", Destination: "/data", Writable: true},
+			{Source: "/srv/conf", Destination: "/etc/app"},
+		},
+		AllowedDevices: []execdriver.DeviceEntry{{Path: "/dev/fuse", Type: 'c', Major: 10, Minor: 229, Permissions: "rwm"}},
+	}
+	data, err := generateAppArmorProfile(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile := string(data)
+	for _, rule := range []string{
+		"profile docker-1 flags=(attach_disconnected,mediate_deleted) {",
+		"  \"/data/**\" rwkl,",
+		"  deny \"/etc/app/**\" wl,",
+		"  \"/dev/fuse\" rw,",
+	} {
+		if !strings.Contains(profile, rule+"\n") {
+			t.Errorf("Expected the rule %q in:\n%s", rule, profile)
+		}
+	}
+
+	c.Mounts = []execdriver.Mount{{Source: "/srv/data", Destination: "/my data", Writable: true}}
+	if data, err = generateAppArmorProfile(c); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "  \"/my data/**\" rwkl,\n") {
+		t.Errorf("Expected the destination with a space quoted in:\n%s", data)
+	}
+	for _, dest := range []string{"/data/** rwkl,\n  /**", "/data\" rwkl, \"/", "/data\\"} {
+		c.Mounts = []execdriver.Mount{{Source: "/srv/data", Destination: dest}}
+		if _, err := generateAppArmorProfile(c); err == nil {
+			t.Errorf("Expected an error for the destination %q", dest)
+		}
+	}
+}
+
+func TestLoadApparmorProfile(t *testing.T) {
+	bin, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(bin)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+":"+os.Getenv("PATH"))
+
+	// apparmor_parser recording its flag and the profile it's given
+	script := "#!/bin/sh\necho \"$1\" >> " + path.Join(bin, "calls") + "\ncat >> " + path.Join(bin, "calls") + "\n"
+	if err := ioutil.WriteFile(path.Join(bin, "apparmor_parser"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadApparmorProfile("docker-1", []byte("profile docker-1 {}\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := unloadApparmorProfile("docker-1"); err != nil {
+		t.Fatal(err)
+	}
+	calls, err := ioutil.ReadFile(path.Join(bin, "calls"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "-r\nprofile docker-1 {}\n-R\nprofile docker-1 {}\n"; string(calls) != expected {
+		t.Fatalf("Expected the profile to be loaded then removed, got:\n%s", calls)
+	}
+
+	if err := ioutil.WriteFile(path.Join(bin, "apparmor_parser"), []byte("#!/bin/sh\necho 'syntax error' >&2\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadApparmorProfile("docker-1", nil); err == nil || !strings.Contains(err.Error(), "syntax error") {
+		t.Fatalf("Expected the error of apparmor_parser, got %v", err)
+	}
+}
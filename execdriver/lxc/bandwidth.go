@@ -0,0 +1,70 @@
+package lxc
+
+import (
+	"fmt"
+	"github.com/dotcloud/docker/execdriver"
+	"github.com/dotcloud/docker/utils"
+	"log"
+	"os/exec"
+	"strconv"
+)
+
+// Smallest burst of the bandwidth policers, a few full sized packets
+const minBandwidthBurst = 16 * 1024
+
+// Cap what the container sends on the interfaces with a NetworkBandwidth.
+// Traffic leaving the container enters the host side of the veth pair,
+// it's policed on ingress there. Without tc the container is not shaped.
+func shapeBandwidth(c *execdriver.Command) {
+	for _, n := range c.Interfaces() {
+		if n.NetworkBandwidth <= 0 {
+			continue
+		}
+		if _, err := exec.LookPath("tc"); err != nil {
+			log.Printf("WARNING: tc not found, the bandwidth of %s is not limited: %s", c.ID, err)
+			return
+		}
+		burst := n.NetworkBandwidth / 10
+		if burst < minBandwidthBurst {
+			burst = minBandwidthBurst
+		}
+		// tc reads bps as bytes per second
+		for _, args := range [][]string{
+			{"qdisc", "add", "dev", n.VethName, "handle", "ffff:", "ingress"},
+			{"filter", "add", "dev", n.VethName, "parent", "ffff:", "protocol", "all", "u32", "match", "u32", "0", "0",
+				"police", "rate", strconv.FormatInt(n.NetworkBandwidth, 10) + "bps", "burst", strconv.FormatInt(burst, 10), "drop", "flowid", ":1"},
+		} {
+			if output, err := exec.Command("tc", args...).CombinedOutput(); err != nil {
+				log.Printf("WARNING: Unable to limit the bandwidth of %s on %s: %s (%s)", c.ID, n.VethName, err, output)
+				break
+			}
+		}
+	}
+}
+
+// Remove the policers of shapeBandwidth, they are gone anyway
+// along with the veth pair once the container exited
+func unshapeBandwidth(c *execdriver.Command) {
+	if _, err := exec.LookPath("tc"); err != nil {
+		return
+	}
+	for _, n := range c.Interfaces() {
+		if n.NetworkBandwidth <= 0 {
+			continue
+		}
+		if output, err := exec.Command("tc", "qdisc", "del", "dev", n.VethName, "ingress").CombinedOutput(); err != nil {
+			utils.Debugf("Unable to remove the bandwidth limit of %s on %s: %s (%s)", c.ID, n.VethName, err, output)
+		}
+	}
+}
+
+// A shaped interface is told apart from the others by the name of its veth
+func validateBandwidth(n *execdriver.Network) error {
+	if n.NetworkBandwidth < 0 {
+		return fmt.Errorf("Network bandwidth %d must be positive", n.NetworkBandwidth)
+	}
+	if n.NetworkBandwidth > 0 && n.VethName == "" {
+		return fmt.Errorf("Limiting the network bandwidth requires a veth name")
+	}
+	return nil
+}
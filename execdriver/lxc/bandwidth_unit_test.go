@@ -0,0 +1,62 @@
+package lxc
+
+import (
+	"github.com/dotcloud/docker/execdriver"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestShapeBandwidth(t *testing.T) {
+	bin, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(bin)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin)
+
+	c := &execdriver.Command{
+		ID:       "1",
+		Network:  &execdriver.Network{Bridge: "docker0", VethName: "veth1"},
+		Networks: []*execdriver.Network{{Bridge: "docker1", VethName: "veth1b", NetworkBandwidth: 1 << 20}},
+	}
+	// Without tc the container runs unshaped
+	shapeBandwidth(c)
+	unshapeBandwidth(c)
+
+	calls := path.Join(bin, "calls")
+	if err := ioutil.WriteFile(path.Join(bin, "tc"), []byte("#!/bin/sh\necho \"$@\" >> "+calls+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	shapeBandwidth(c)
+	unshapeBandwidth(c)
+	output, err := ioutil.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"qdisc add dev veth1b handle ffff: ingress",
+		"filter add dev veth1b parent ffff: protocol all u32 match u32 0 0 police rate 1048576bps burst 104857 drop flowid :1",
+		"qdisc del dev veth1b ingress",
+	}
+	if lines := strings.TrimSpace(string(output)); lines != strings.Join(expected, "\n") {
+		t.Fatalf("Expected only the interface with a bandwidth to be shaped, got:\n%s", lines)
+	}
+}
+
+func TestValidateBandwidth(t *testing.T) {
+	for _, n := range []*execdriver.Network{
+		{NetworkBandwidth: 1 << 20},
+		{NetworkBandwidth: -1, VethName: "veth1"},
+	} {
+		if err := validateNetwork(n); err == nil {
+			t.Errorf("Expected an error for %+v", n)
+		}
+	}
+	if err := validateNetwork(&execdriver.Network{NetworkBandwidth: 1 << 20, VethName: "veth1"}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,132 @@
+package lxc
+
+import (
+	"bytes"
+	"github.com/dotcloud/docker/execdriver"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"sync"
+)
+
+// consoleLog is the console.log of a container, moved to console.log.1
+// once it would grow past max bytes. Failing to write it never fails the
+// output of the container, it's only logged.
+type consoleLog struct {
+	sync.Mutex
+	path   string
+	max    int64
+	file   *os.File
+	size   int64
+	failed bool
+}
+
+func openConsoleLog(filename string, max int64) (*consoleLog, error) {
+	l := &consoleLog{path: filename, max: max}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *consoleLog) open() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.file, l.size = f, fi.Size()
+	return nil
+}
+
+func (l *consoleLog) rotate() error {
+	l.file.Close()
+	l.file = nil
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+func (l *consoleLog) Write(p []byte) (int, error) {
+	l.Lock()
+	defer l.Unlock()
+	var err error
+	if l.max > 0 && l.size > 0 && l.size+int64(len(p)) > l.max {
+		err = l.rotate()
+	}
+	if err == nil && l.file != nil {
+		var n int
+		n, err = l.file.Write(p)
+		l.size += int64(n)
+	}
+	if err != nil && !l.failed {
+		log.Printf("WARNING: Unable to write the console log %s: %s", l.path, err)
+		l.failed = true
+	}
+	return len(p), nil
+}
+
+func (l *consoleLog) Close() error {
+	l.Lock()
+	defer l.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+func (d *driver) consoleLogPath(id string) string {
+	return path.Join(d.root, "containers", id, "console.log")
+}
+
+// Returns pipes whose output also goes to the console log of c
+func (d *driver) teeConsoleLog(c *execdriver.Command, pipes *execdriver.Pipes) (*execdriver.Pipes, io.Closer, error) {
+	l, err := openConsoleLog(d.consoleLogPath(c.ID), c.ConsoleLogSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	tee := func(w io.Writer) io.Writer {
+		if w == nil {
+			return l
+		}
+		return io.MultiWriter(w, l)
+	}
+	return &execdriver.Pipes{Stdin: pipes.Stdin, Stdout: tee(pipes.Stdout), Stderr: tee(pipes.Stderr)}, l, nil
+}
+
+// ReadConsoleLog returns the last tail lines the container id output, all
+// of the console log kept when tail is 0 or less
+func (d *driver) ReadConsoleLog(id string, tail int) ([]byte, error) {
+	filename := d.consoleLogPath(id)
+	rotated, err := ioutil.ReadFile(filename + ".1")
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	current, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	data := append(rotated, current...)
+	if tail <= 0 {
+		return data, nil
+	}
+	// Ignore the newline ending the last line
+	end := len(data)
+	if end > 0 && data[end-1] == '\n' {
+		end--
+	}
+	start := end
+	for i := 0; i < tail; i++ {
+		if start = bytes.LastIndex(data[:start], []byte("\n")); start < 0 {
+			return data, nil
+		}
+	}
+	return data[start+1:], nil
+}
@@ -0,0 +1,55 @@
+package lxc
+
+import (
+	"bytes"
+	"github.com/dotcloud/docker/execdriver"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestConsoleLog(t *testing.T) {
+	root, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := os.MkdirAll(path.Join(root, "containers", "1"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	d := &driver{root: root}
+	var stdout bytes.Buffer
+	c := &execdriver.Command{ID: "1", ConsoleLog: true, ConsoleLogSize: 10}
+	pipes, closer, err := d.teeConsoleLog(c, execdriver.NewPipes(nil, &stdout, nil, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"one\n", "two\n", "three\n", "four\n", "five\n"} {
+		pipes.Stdout.Write([]byte(line))
+	}
+	pipes.Stderr.Write([]byte("six\n"))
+	closer.Close()
+
+	if stdout.String() != "one\ntwo\nthree\nfour\nfive\n" {
+		t.Fatalf("Expected the output to still reach stdout, got %q", stdout.String())
+	}
+	// Rotated past 10 bytes, only the last two files are kept
+	data, err := d.ReadConsoleLog("1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "four\nfive\nsix\n" {
+		t.Fatalf("Expected the rotated and current logs, got %q", data)
+	}
+	if data, err = d.ReadConsoleLog("1", 2); err != nil || string(data) != "five\nsix\n" {
+		t.Fatalf("Expected the last 2 lines, got %q (%v)", data, err)
+	}
+	if data, err = d.ReadConsoleLog("1", 10); err != nil || string(data) != "four\nfive\nsix\n" {
+		t.Fatalf("Expected every line kept, got %q (%v)", data, err)
+	}
+	if _, err := d.ReadConsoleLog("2", 1); !os.IsNotExist(err) {
+		t.Fatalf("Expected no console log for another container, got %v", err)
+	}
+}
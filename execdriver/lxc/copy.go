@@ -0,0 +1,145 @@
+package lxc
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// How many symlinks resolving a path may go through, as the kernel's
+const maxSymlinks = 40
+
+// Resolve p inside the container whose root is root, following its symlinks
+// without ever leaving root. An absolute symlink is relative to root and a
+// ".." of a symlink stops at it, as in a chroot, but a p escaping root with
+// ".." is rejected.
+func resolveInRoot(root, p string) (string, error) {
+	depth := 0
+	for _, part := range strings.Split(p, "/") {
+		switch part {
+		case "", ".":
+		case "..":
+			if depth--; depth < 0 {
+				return "", fmt.Errorf("Path %s escapes the root of the container", p)
+			}
+		default:
+			depth++
+		}
+	}
+
+	var (
+		resolved  = "/"
+		remaining = path.Clean("/" + p)
+		links     = 0
+	)
+	for remaining != "" {
+		var part string
+		remaining = strings.TrimLeft(remaining, "/")
+		if i := strings.Index(remaining, "/"); i >= 0 {
+			part, remaining = remaining[:i], remaining[i:]
+		} else {
+			part, remaining = remaining, ""
+		}
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			resolved = path.Dir(resolved)
+			continue
+		}
+
+		next := path.Join(resolved, part)
+		fi, err := os.Lstat(filepath.Join(root, next))
+		if err != nil {
+			if os.IsNotExist(err) {
+				// Nothing to follow, but what remains can still hold a
+				// ".." back into existing directories and their symlinks
+				resolved = next
+				continue
+			}
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		if links++; links > maxSymlinks {
+			return "", fmt.Errorf("Too many symlinks resolving %s", p)
+		}
+		target, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			return "", err
+		}
+		if path.IsAbs(target) {
+			resolved = "/"
+		}
+		remaining = target + remaining
+	}
+	return filepath.Join(root, resolved), nil
+}
+
+// The root of the running container id as seen from the host, which goes
+// through the mount namespace of its init. setns can't enter a mount
+// namespace from the daemon, whose threads share their filesystem context.
+func (d *driver) containerRoot(id string) (string, error) {
+	pid, err := d.runningInitPid(id)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("/proc/%d/root", pid), nil
+}
+
+// CopyToContainer writes content to the file dstPath of the running
+// container id, overwriting it, with its mounts applied so that dstPath can
+// be in a volume
+func (d *driver) CopyToContainer(id, dstPath string, content io.Reader) error {
+	root, err := d.containerRoot(id)
+	if err != nil {
+		return err
+	}
+	filename, err := resolveInRoot(root, dstPath)
+	if err != nil {
+		return err
+	}
+	// The last component was resolved, don't follow one swapped in since
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|syscall.O_NOFOLLOW, 0644)
+	if err != nil {
+		return fmt.Errorf("Unable to copy to %s in %s: %s", dstPath, id, err)
+	}
+	if _, err := io.Copy(f, content); err != nil {
+		f.Close()
+		return fmt.Errorf("Unable to copy to %s in %s: %s", dstPath, id, err)
+	}
+	return f.Close()
+}
+
+// CopyFromContainer opens the file srcPath of the running container id, with
+// its mounts applied, the caller closes it
+func (d *driver) CopyFromContainer(id, srcPath string) (io.ReadCloser, error) {
+	root, err := d.containerRoot(id)
+	if err != nil {
+		return nil, err
+	}
+	filename, err := resolveInRoot(root, srcPath)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filename, os.O_RDONLY|syscall.O_NOFOLLOW, 0)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to copy %s from %s: %s", srcPath, id, err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		f.Close()
+		return nil, fmt.Errorf("Unable to copy %s from %s: not a regular file", srcPath, id)
+	}
+	return f, nil
+}
@@ -0,0 +1,95 @@
+package lxc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestResolveInRoot(t *testing.T) {
+	root, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := os.MkdirAll(path.Join(root, "var", "lib"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{
+		"etc":          "/var/lib",
+		"var/up":       "../../../..",
+		"var/lib/self": ".",
+		"loop":         "loop",
+		"var/escape":   "nope/../../../../../../../../etc/cron.d/evil",
+		"var/back":     "nope/../../etc/hosts",
+	} {
+		if err := os.Symlink(target, path.Join(root, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for p, expected := range map[string]string{
+		"/var/lib/data":    "/var/lib/data",
+		"etc/hosts":        "/var/lib/hosts",
+		"/var/up/etc/x":    "/var/lib/x",
+		"/etc/self/self/y": "/var/lib/y",
+		"/var/../etc":      "/var/lib",
+		"/missing/a/b":     "/missing/a/b",
+		"/var/escape":      "/var/lib/cron.d/evil",
+		"/var/back":        "/var/lib/hosts",
+	} {
+		resolved, err := resolveInRoot(root, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resolved != path.Join(root, expected) {
+			t.Errorf("Expected %s to resolve to %s, got %s", p, expected, strings.TrimPrefix(resolved, root))
+		}
+	}
+	for _, p := range []string{"../etc/passwd", "/var/../../etc", "/loop"} {
+		if _, err := resolveInRoot(root, p); err == nil {
+			t.Errorf("Expected an error resolving %s", p)
+		}
+	}
+}
+
+func TestCopyContainer(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", tmp+":"+os.Getenv("PATH"))
+
+	// The test process stands for the init of the container, / its root
+	script := "#!/bin/sh\nif [ \"$1\" = -s ]; then echo 'State: RUNNING'; else echo 'PID: " + strconv.Itoa(os.Getpid()) + "'; fi\n"
+	if err := ioutil.WriteFile(path.Join(tmp, "lxc-info"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	d := &driver{root: tmp}
+
+	filename := path.Join(tmp, "copied")
+	if err := d.CopyToContainer("1", filename, strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	r, err := d.CopyFromContainer("1", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, []byte("hello")) {
+		t.Fatalf("Expected hello, got %q", data)
+	}
+	if _, err := d.CopyFromContainer("1", tmp); err == nil {
+		t.Fatal("Expected an error copying a directory")
+	}
+}
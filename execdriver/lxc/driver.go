@@ -1,74 +1,319 @@
 package lxc
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/dotcloud/docker/execdriver"
+	"github.com/dotcloud/docker/execdriver/setup"
 	"github.com/dotcloud/docker/pkg/cgroups"
+	"github.com/dotcloud/docker/pkg/mount"
 	"github.com/dotcloud/docker/utils"
+	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
 
-const DriverName = "lxc"
+const (
+	DriverName = "lxc"
+
+	// lxc-attach only runs an arbitrary command after "--" since 0.8.0
+	minAttachVersion = "0.8.0"
+
+	// lxc.id_map appeared in 1.0.0
+	minIDMapVersion = "1.0.0"
+
+	// lxc.cap.keep appeared in 1.0.0
+	minCapKeepVersion = "1.0.0"
+
+	// lxc-start --share-pid appeared in 2.1.0
+	minSharePidVersion = "2.1.0"
+
+	// lxc-start --share-ipc appeared in 1.0.0
+	minShareIpcVersion = "1.0.0"
+
+	// lxc-start --share-uts appeared in 1.0.0
+	minShareUtsVersion = "1.0.0"
+
+	// lxc.autodev and the create= mount option appeared in 1.0.0
+	minAutodevVersion = "1.0.0"
+
+	// lxc.cgroup.dir appeared in 2.1.0
+	minCgroupDirVersion = "2.1.0"
+
+	// Lines of the lxc-start log reported when it fails to start a container
+	maxLogLines = 5
+
+	defaultStartTimeout = 5 * time.Second
+	defaultPollInterval = 50 * time.Millisecond
+	defaultHookTimeout  = 30 * time.Second
+
+	// How often a restored container is checked for its exit, for its
+	// whole lifetime, so much less often than when starting one
+	restorePollInterval = time.Second
+
+	// Delay before the first restart of a container, doubled on each attempt
+	restartBackoff    = 100 * time.Millisecond
+	maxRestartBackoff = time.Minute
+
+	// how long Stop waits for the container to go away after SIGKILL
+	killTimeout = 10 * time.Second
+
+	// how long a canceled run gives the container to exit on SIGTERM
+	cancelStopTimeout = 10 * time.Second
+)
 
 func init() {
 	execdriver.RegisterInitFunc(DriverName, func(args *execdriver.InitArgs) error {
-		if err := setupHostname(args); err != nil {
+		if err := setup.Hostname(args); err != nil {
 			return err
 		}
 
-		if err := setupNetworking(args); err != nil {
+		if err := setup.JoinNetNs(args); err != nil {
 			return err
 		}
 
-		if err := setupCapabilities(args); err != nil {
+		if err := setup.Networking(args); err != nil {
 			return err
 		}
 
-		if err := setupWorkingDirectory(args); err != nil {
+		if err := setup.Devices(args); err != nil {
 			return err
 		}
 
-		if err := changeUser(args); err != nil {
+		if err := setup.Propagation(args); err != nil {
 			return err
 		}
 
-		path, err := exec.LookPath(args.Args[0])
-		if err != nil {
-			log.Printf("Unable to locate %v", args.Args[0])
-			os.Exit(127)
+		if err := setup.Sysctls(args); err != nil {
+			return err
+		}
+
+		if err := setup.Paths(args); err != nil {
+			return err
+		}
+
+		if err := setup.Ulimits(args); err != nil {
+			return err
+		}
+
+		if err := setup.CgroupNamespace(args); err != nil {
+			return err
+		}
+
+		if err := setup.Capabilities(args); err != nil {
+			return err
+		}
+
+		if err := setup.WorkingDirectory(args); err != nil {
+			return err
 		}
-		if err := syscall.Exec(path, args.Args, os.Environ()); err != nil {
-			return fmt.Errorf("dockerinit unable to execute %s - %s", path, err)
+
+		if err := setup.ChangeUser(args); err != nil {
+			return err
+		}
+
+		if err := setup.NoNewPrivileges(args); err != nil {
+			return err
+		}
+
+		if err := setup.Seccomp(args); err != nil {
+			return err
 		}
-		panic("Unreachable")
+
+		return setup.Exec(args)
 	})
 }
 
+// Options tunes the behaviour of the driver, every field
+// left to its zero value falls back to the default
+type Options struct {
+	StartTimeout time.Duration // how long to wait for the container to be RUNNING, defaults to 5s
+	PollInterval time.Duration // how often lxc-info is polled while waiting, defaults to 50ms
+
+	// lxc-info is retried InfoRetries times when it fails, defaults to 3
+	// and negative to disable, waiting InfoBackoff before the first retry
+	// and twice as long before each next one, defaults to 10ms
+	InfoRetries int
+	InfoBackoff time.Duration
+
+	// Verbosity of the lxc-start log of each container, one of debug, info,
+	// warn and error, lxc only logs errors by default
+	LogLevel string
+
+	// Don't wrap lxc-start in "unshare -m" even when / looks shared, for
+	// hosts where the mounts lxc-start makes can't propagate anyway
+	DisableUnshare bool
+
+	HookTimeout time.Duration // how long a lifecycle hook may run before it's killed, defaults to 30s
+
+	// Paths of the lxc tools, to pin a version installed out of PATH or
+	// one of several, each is looked up in PATH when empty
+	LxcStartPath    string
+	LxcInfoPath     string
+	LxcKillPath     string
+	LxcStopPath     string
+	LxcAttachPath   string
+	LxcFreezePath   string
+	LxcUnfreezePath string
+
+	// Fail NewDriver when a cgroup subsystem the limits of the containers
+	// rely on isn't mounted, instead of only warning about it
+	StrictCgroups bool
+}
+
 type driver struct {
-	root       string // root path for the driver to use
-	apparmor   bool
-	sharedRoot bool
+	root         string // root path for the driver to use
+	apparmor     bool
+	sharedRoot   bool
+	startTimeout time.Duration
+	pollInterval time.Duration
+	infoRetries  int
+	infoBackoff  time.Duration
+	logLevel     string // lxc name of the log level, lxc's default when empty
+	hookTimeout  time.Duration
+
+	cgroupLock  sync.Mutex
+	cgroupRoots map[string]string // subsystem -> cgroup of the daemon, resolved once
+	cgroupDirs  map[string]string // container -> cgroup relative to the daemon's when under a CgroupParent
+
+	killedLock sync.Mutex
+	killed     map[string]bool // containers killed since their last Run, not to be restarted
+
+	fsUsageLock sync.Mutex
+	fsUsage     map[string]fsUsageEntry // last computed FsUsage by container
+
+	eventsLock sync.Mutex
+	pollers    map[string]*eventPoller // container -> poller of its Events
+
+	toolPaths map[string]string // lxc tool -> path pinned by the options
+
+	lxcVersion string // version of lxc, detected once by NewDriver
 }
 
-func NewDriver(root string, apparmor bool) (*driver, error) {
+func NewDriver(root string, apparmor bool, options Options) (*driver, error) {
+	toolPaths := make(map[string]string)
+	for name, p := range map[string]string{
+		"lxc-start":    options.LxcStartPath,
+		"lxc-info":     options.LxcInfoPath,
+		"lxc-kill":     options.LxcKillPath,
+		"lxc-stop":     options.LxcStopPath,
+		"lxc-attach":   options.LxcAttachPath,
+		"lxc-freeze":   options.LxcFreezePath,
+		"lxc-unfreeze": options.LxcUnfreezePath,
+	} {
+		if p == "" {
+			continue
+		}
+		if _, err := exec.LookPath(p); err != nil {
+			return nil, fmt.Errorf("Invalid path %s for %s: %s", p, name, err)
+		}
+		toolPaths[name] = p
+	}
 	// setup unconfined symlink
-	if err := linkLxcStart(root); err != nil {
+	if err := linkLxcStart(root, toolPaths["lxc-start"]); err != nil {
+		return nil, err
+	}
+	logLevel, err := lxcLogLevel(options.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	d := &driver{
+		apparmor:     apparmor,
+		root:         root,
+		sharedRoot:   !options.DisableUnshare && rootIsShared(),
+		startTimeout: options.StartTimeout,
+		pollInterval: options.PollInterval,
+		infoRetries:  options.InfoRetries,
+		infoBackoff:  options.InfoBackoff,
+		logLevel:     logLevel,
+		hookTimeout:  options.HookTimeout,
+		toolPaths:    toolPaths,
+	}
+	if d.startTimeout <= 0 {
+		d.startTimeout = defaultStartTimeout
+	}
+	if d.pollInterval <= 0 {
+		d.pollInterval = defaultPollInterval
+	}
+	if d.infoRetries == 0 {
+		d.infoRetries = defaultInfoRetries
+	}
+	if d.infoBackoff <= 0 {
+		d.infoBackoff = defaultInfoBackoff
+	}
+	if d.hookTimeout <= 0 {
+		d.hookTimeout = defaultHookTimeout
+	}
+	d.lxcVersion = d.detectVersion()
+
+	warnings, err := d.Validate()
+	if err == nil && len(warnings) > 0 && options.StrictCgroups {
+		err = fmt.Errorf("Missing cgroup subsystems: %s", strings.Join(warnings, ", "))
+	}
+	if err != nil {
+		if options.StrictCgroups {
+			return nil, err
+		}
+		log.Printf("WARNING: Unable to check the cgroup subsystems: %s", err)
+	}
+	for _, w := range warnings {
+		log.Printf("WARNING: %s", w)
+	}
+	return d, nil
+}
+
+// Cgroup subsystems the resource controls of the containers rely on, with
+// what goes missing without them
+var requiredCgroupSubsystems = []struct {
+	name, missing string
+}{
+	{"memory", "memory limits are not enforced"},
+	{"cpu", "cpu shares and quotas are not enforced"},
+	{"cpuacct", "the cpu usage is not accounted"},
+	{"cpuset", "cpusets are not applied"},
+	{"blkio", "disk I/O limits are not enforced"},
+	{"devices", "containers are not restricted in the devices they access"},
+}
+
+// Validate returns a warning for each of the cgroup subsystems the resource
+// controls rely on which isn't mounted on the host
+func (d *driver) Validate() ([]string, error) {
+	var names []string
+	for _, s := range requiredCgroupSubsystems {
+		names = append(names, s.name)
+	}
+	missing, err := cgroups.MissingSubsystems(names)
+	if err != nil {
 		return nil, err
 	}
-	return &driver{
-		apparmor:   apparmor,
-		root:       root,
-		sharedRoot: rootIsShared(),
-	}, nil
+	var warnings []string
+	for _, s := range requiredCgroupSubsystems {
+		for _, name := range missing {
+			if s.name == name {
+				warnings = append(warnings, fmt.Sprintf("The %s cgroup is not mounted, %s", name, s.missing))
+			}
+		}
+	}
+	return warnings, nil
+}
+
+// The path of the lxc tool name, its bare name to look up in PATH unless
+// the options pinned it
+func (d *driver) tool(name string) string {
+	if p := d.toolPaths[name]; p != "" {
+		return p
+	}
+	return name
 }
 
 func (d *driver) Name() string {
@@ -77,65 +322,263 @@ func (d *driver) Name() string {
 }
 
 func (d *driver) Run(c *execdriver.Command, pipes *execdriver.Pipes, startCallback execdriver.StartCallback) (int, error) {
-	if err := SetTerminal(c, pipes); err != nil {
+	return d.RunWithContext(execdriver.Background, c, pipes, startCallback)
+}
+
+// RunWithContext is Run, stopping the container (SIGTERM, then SIGKILL
+// after cancelStopTimeout) when ctx is canceled. It returns once lxc-start
+// exited, with the error of ctx.
+func (d *driver) RunWithContext(ctx execdriver.Context, c *execdriver.Command, pipes *execdriver.Pipes, startCallback execdriver.StartCallback) (int, error) {
+	if err := c.Validate(); err != nil {
+		return -1, err
+	}
+	if _, err := exec.LookPath(d.tool("lxc-start")); err != nil {
+		return -1, ErrLxcStartNotFound
+	}
+	if err := validateRootfs(c.Rootfs); err != nil {
+		return -1, err
+	}
+	if err := validateCgroupSupport(c.Resources); err != nil {
+		return -1, err
+	}
+	// The limits ignored are only left out of this run, the settings of
+	// the caller are given back untouched
+	resources, hugepageLimits := c.Resources, c.HugepageLimits
+	defer func() {
+		c.Resources, c.HugepageLimits = resources, hugepageLimits
+	}()
+	c.Resources = dropUnsupportedResources(c.Resources)
+	if len(c.HugepageLimits) > 0 {
+		if err := validateHugepageLimits(c.HugepageLimits, "/sys/kernel/mm/hugepages"); err != nil {
+			return -1, err
+		}
+		if _, err := cgroups.FindCgroupMountpoint("hugetlb"); err != nil {
+			log.Printf("WARNING: hugetlb cgroup is not mounted, ignoring the hugepage limits of %s: %s", c.ID, err)
+			c.HugepageLimits = nil
+		}
+	}
+	if err := validateLxcConf(c.LxcConf); err != nil {
+		return -1, err
+	}
+	d.setKilled(c.ID, false)
+	for _, n := range c.Interfaces() {
+		if err := validateNetwork(n); err != nil {
+			return -1, err
+		}
+	}
+	if c.CgroupParent != "" {
+		if err := validateCgroupParent(c.CgroupParent); err != nil {
+			return -1, err
+		}
+		if version := d.version(); !versionAtLeast(version, minCgroupDirVersion) {
+			return -1, fmt.Errorf("lxc %q can't place containers under a cgroup parent, %s or later is required", version, minCgroupDirVersion)
+		}
+	}
+	d.setCgroupDir(c.ID, lxcCgroupDir(c))
+	if c.HostPid {
+		if version := d.version(); !versionAtLeast(version, minSharePidVersion) {
+			return -1, fmt.Errorf("lxc %q can't share the pid namespace of the host, %s or later is required", version, minSharePidVersion)
+		}
+	}
+	if c.IpcMode != "" {
+		if version := d.version(); !versionAtLeast(version, minShareIpcVersion) {
+			return -1, fmt.Errorf("lxc %q can't share IPC namespaces, %s or later is required", version, minShareIpcVersion)
+		}
+	}
+	if c.UTSMode == execdriver.UTSModeHost {
+		if version := d.version(); !versionAtLeast(version, minShareUtsVersion) {
+			return -1, fmt.Errorf("lxc %q can't share the UTS namespace of the host, %s or later is required", version, minShareUtsVersion)
+		}
+	}
+	ipcPid, err := d.ipcPid(c)
+	if err != nil {
+		return -1, err
+	}
+	if c.AppArmorProfile != "" {
+		if d.apparmor {
+			if err := validateAppArmorProfile(c.AppArmorProfile, "/etc/apparmor.d", "/sys/kernel/security/apparmor/profiles"); err != nil {
+				return -1, err
+			}
+		} else {
+			log.Printf("WARNING: AppArmor is not enabled, running %s unconfined instead of with profile %s", c.ID, c.AppArmorProfile)
+		}
+	}
+	if c.GenerateAppArmor && !d.apparmor {
+		log.Printf("WARNING: AppArmor is not enabled, running %s unconfined instead of with a generated profile", c.ID)
+	}
+	if _, err := setup.GetCapabilities(c.CapAdd); err != nil {
+		return -1, err
+	}
+	if _, err := setup.GetCapabilities(c.CapDrop); err != nil {
+		return -1, err
+	}
+	seccompParams, err := execdriver.SeccompParams(c)
+	if err != nil {
+		return -1, err
+	}
+	deviceParams, err := execdriver.DeviceParams(c)
+	if err != nil {
+		return -1, err
+	}
+	ulimitParams, err := execdriver.UlimitParams(c)
+	if err != nil {
+		return -1, err
+	}
+	pathParams, err := execdriver.PathParams(c)
+	if err != nil {
+		return -1, err
+	}
+	netns, err := execdriver.OpenNetNs(c, d.runningInitPid)
+	if err != nil {
+		return -1, err
+	}
+	if netns != nil {
+		defer netns.Close()
+	}
+
+	if c.ConsoleLog {
+		if c.ConsoleLogSize < 0 {
+			return -1, fmt.Errorf("Console log size %d must be positive", c.ConsoleLogSize)
+		}
+		if err := os.MkdirAll(path.Join(d.root, "containers", c.ID), 0700); err != nil {
+			return -1, err
+		}
+		var consoleLog io.Closer
+		if pipes, consoleLog, err = d.teeConsoleLog(c, pipes); err != nil {
+			return -1, err
+		}
+		defer consoleLog.Close()
+	}
+	if err := execdriver.SetTerminal(c, pipes); err != nil {
+		return -1, err
+	}
+	if err := execdriver.WriteEnv(c); err != nil {
+		return -1, err
+	}
+	if c.ReadonlyRootfs {
+		// The mountpoints of the scratch tmpfs can't be created
+		// once the rootfs is read-only
+		for _, dir := range readonlyRootfsScratchDirs {
+			if err := os.MkdirAll(filepath.Join(c.Rootfs, dir), 0755); err != nil {
+				return -1, err
+			}
+		}
+	}
+	if err := d.writeResolvConf(c); err != nil {
+		return -1, err
+	}
+	mountTargets, err := setupMounts(c)
+	if err != nil {
+		return -1, err
+	}
+	if err := setupUserNamespace(c); err != nil {
 		return -1, err
 	}
-	configPath, err := d.generateLXCConfig(c)
+	if c.GenerateAppArmor && d.apparmor {
+		name := generatedProfileName(c.ID)
+		data, err := generateAppArmorProfile(c)
+		if err != nil {
+			return -1, err
+		}
+		if err := loadApparmorProfile(name, data); err != nil {
+			return -1, err
+		}
+		defer func() {
+			if err := unloadApparmorProfile(name); err != nil {
+				log.Printf("WARNING: %s", err)
+			}
+		}()
+	}
+	configPath, err := d.generateLXCConfig(c, ipcPid, mountTargets)
 	if err != nil {
 		return -1, err
 	}
+	// lxc appends to its log, only keep the errors of this start
+	if err := os.MkdirAll(path.Dir(d.logPath(c.ID)), 0700); err != nil {
+		return -1, err
+	}
+	if err := os.Remove(d.logPath(c.ID)); err != nil && !os.IsNotExist(err) {
+		return -1, err
+	}
 	params := []string{
-		"lxc-start",
+		d.tool("lxc-start"),
 		"-n", c.ID,
 		"-f", configPath,
-		"--",
-		c.InitPath,
-		"-driver",
-		DriverName,
+		"-o", d.logPath(c.ID),
 	}
+	if d.logLevel != "" {
+		params = append(params, "-l", d.logLevel)
+	}
+	if c.HostPid {
+		// The host's init stands for its pid namespace
+		params = append(params, "--share-pid", "1")
+	}
+	if ipcPid > 0 {
+		params = append(params, "--share-ipc", strconv.Itoa(ipcPid))
+	}
+	if c.UTSMode == execdriver.UTSModeHost {
+		params = append(params, "--share-uts", "1")
+	}
+	params = append(params, "--")
+	params = append(params, c.InitWrapper...)
+	params = append(params, c.InitPath, "-driver", DriverName)
 
-	if c.Network != nil {
-		params = append(params,
-			"-g", c.Network.Gateway,
-			"-i", fmt.Sprintf("%s/%d", c.Network.IPAddress, c.Network.IPPrefixLen),
-			"-mtu", strconv.Itoa(c.Network.Mtu),
-		)
+	params = append(params, execdriver.NetworkParams(c)...)
+	if netns != nil {
+		// lxc-start passes its inherited descriptors down to dockerinit
+		c.ExtraFiles = append(c.ExtraFiles, netns)
+		params = append(params, "-netns-fd", strconv.Itoa(2+len(c.ExtraFiles)))
 	}
 
 	if c.User != "" {
 		params = append(params, "-u", c.User)
 	}
+	if len(c.GroupAdd) > 0 {
+		params = append(params, "-group-add", strings.Join(c.GroupAdd, ":"))
+	}
 
-	if c.Privileged {
-		if d.apparmor {
-			params[0] = path.Join(d.root, "lxc-start-unconfined")
+	if c.DisableAppArmor && d.apparmor {
+		params[0] = path.Join(d.root, "lxc-start-unconfined")
+	}
 
-		}
+	if c.Privileged {
 		params = append(params, "-privileged")
 	}
 
+	if c.Domainname != "" {
+		params = append(params, "-domain", c.Domainname)
+	}
+	params = append(params, execdriver.UTSParams(c)...)
+
+	if c.NoNewPrivileges {
+		params = append(params, "-no-new-privileges")
+	}
+	params = append(params, seccompParams...)
+	params = append(params, deviceParams...)
+	params = append(params, ulimitParams...)
+	params = append(params, pathParams...)
+	params = append(params, execdriver.SysctlParams(c)...)
+	params = append(params, execdriver.CgroupNamespaceParams(c)...)
+
 	if c.WorkingDir != "" {
 		params = append(params, "-w", c.WorkingDir)
+		if c.CreateWorkingDir {
+			params = append(params, "-create-workdir")
+		}
+	}
+
+	if len(c.CapAdd) > 0 {
+		params = append(params, "-cap-add", strings.Join(c.CapAdd, ":"))
+	}
+
+	if len(c.CapDrop) > 0 {
+		params = append(params, "-cap-drop", strings.Join(c.CapDrop, ":"))
 	}
 
 	params = append(params, "--", c.Entrypoint)
 	params = append(params, c.Arguments...)
 
-	if d.sharedRoot {
-		// lxc-start really needs / to be non-shared, or all kinds of stuff break
-		// when lxc-start unmount things and those unmounts propagate to the main
-		// mount namespace.
-		// What we really want is to clone into a new namespace and then
-		// mount / MS_REC|MS_SLAVE, but since we can't really clone or fork
-		// without exec in go we have to do this horrible shell hack...
-		shellString :=
-			"mount --make-rslave /; exec " +
-				utils.ShellQuoteArguments(params)
-
-		params = []string{
-			"unshare", "-m", "--", "/bin/sh", "-c", shellString,
-		}
-	}
+	params = buildLaunchArgs(params, d.sharedRoot)
 
 	var (
 		name = params[0]
@@ -148,8 +591,48 @@ func (d *driver) Run(c *execdriver.Command, pipes *execdriver.Pipes, startCallba
 	c.Path = aname
 	c.Args = append([]string{name}, arg...)
 
+	// A started exec.Cmd can't be reused, keep the pristine one for restarts
+	launch := c.Cmd
+	for restarts := 0; ; restarts++ {
+		if err := d.runHook("PreStart", c.PreStart, c.ID, 0); err != nil {
+			return -1, err
+		}
+		exitCode, oomKilled, err := d.start(ctx, c, startCallback)
+		state := &execdriver.RunState{Restarts: restarts, LastExitCode: exitCode, FinishedAt: time.Now(), OOMKilled: oomKilled}
+		if saveErr := d.saveRunState(c.ID, state); saveErr != nil {
+			log.Printf("WARNING: Unable to save the run state of %s: %s", c.ID, saveErr)
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return exitCode, ctxErr
+		}
+		if err != nil || !c.RestartPolicy.ShouldRestart(exitCode, restarts) || d.isKilled(c.ID) {
+			return exitCode, err
+		}
+		backoff := restartBackoff << uint(restarts)
+		if backoff <= 0 || backoff > maxRestartBackoff {
+			backoff = maxRestartBackoff
+		}
+		log.Printf("Container %s exited with %d, restarting it in %s (policy %s)", c.ID, exitCode, backoff, c.RestartPolicy.Name)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return exitCode, ctx.Err()
+		}
+		if d.isKilled(c.ID) {
+			return exitCode, nil
+		}
+		c.Cmd = launch
+	}
+}
+
+// Launch lxc-start and block until it exits, returning the exit code and
+// whether the container ran out of memory
+func (d *driver) start(ctx execdriver.Context, c *execdriver.Command, startCallback execdriver.StartCallback) (int, bool, error) {
+	// PreStart ran, PostStop runs even when the container failed to start
+	defer d.runHookLogged("PostStop", c.PostStop, c.ID, 0)
+
 	if err := c.Start(); err != nil {
-		return -1, err
+		return -1, false, err
 	}
 
 	var (
@@ -164,10 +647,25 @@ func (d *driver) Run(c *execdriver.Command, pipes *execdriver.Pipes, startCallba
 		}
 		close(waitLock)
 	}()
+	// Gone with lxc-start, whether ctx is canceled or not
+	go func() {
+		select {
+		case <-ctx.Done():
+			d.stopCanceled(c, waitLock)
+		case <-waitLock:
+		}
+	}()
 
 	// Poll lxc for RUNNING status
-	if err := d.waitForStart(c, waitLock); err != nil {
-		return -1, err
+	if err := d.waitForStart(c, waitLock, &waitErr); err != nil {
+		return -1, false, err
+	}
+	oomKilled := d.watchOOM(c.ID)
+	// The host side of the veth pair only exists once running
+	shapeBandwidth(c)
+	if len(c.PostStart) > 0 {
+		pid, _ := d.runningInitPid(c.ID)
+		d.runHookLogged("PostStart", c.PostStart, c.ID, pid)
 	}
 
 	if startCallback != nil {
@@ -175,101 +673,806 @@ func (d *driver) Run(c *execdriver.Command, pipes *execdriver.Pipes, startCallba
 	}
 
 	<-waitLock
-
-	return getExitCode(c), waitErr
+	return c.ExitCode(), oomKilled(), waitErr
 }
 
-/// Return the exit code of the process
-// if the process has not exited -1 will be returned
-func getExitCode(c *execdriver.Command) int {
-	if c.ProcessState == nil {
-		return -1
+// Stops the container of a canceled run, killing lxc-start itself when
+// lxc can't, so that waitLock is closed in any case
+func (d *driver) stopCanceled(c *execdriver.Command, waitLock chan struct{}) {
+	utils.Debugf("Run of %s canceled, stopping it", c.ID)
+	if err := d.Stop(c, cancelStopTimeout); err != nil {
+		select {
+		case <-waitLock:
+		default:
+			log.Printf("WARNING: Unable to stop %s: %s, killing lxc-start", c.ID, err)
+			c.Process.Kill()
+		}
 	}
-	return c.ProcessState.Sys().(syscall.WaitStatus).ExitStatus()
 }
 
-func (d *driver) Kill(c *execdriver.Command, sig int) error {
-	return d.kill(c, sig)
-}
+// Returns the argv launching lxc-start with params, in a new
+// mount namespace with / made a slave when / is shared
+func buildLaunchArgs(params []string, sharedRoot bool) []string {
+	if sharedRoot {
+		// lxc-start really needs / to be non-shared, or all kinds of stuff break
+		// when lxc-start unmount things and those unmounts propagate to the main
+		// mount namespace.
+		// What we really want is to clone into a new namespace and then
+		// mount / MS_REC|MS_SLAVE, but since we can't really clone or fork
+		// without exec in go we have to do this horrible shell hack...
+		shellString :=
+			"mount --make-rslave /; exec " +
+				utils.ShellQuoteArguments(params)
 
-func (d *driver) Restore(c *execdriver.Command) error {
-	for {
-		output, err := exec.Command("lxc-info", "-n", c.ID).CombinedOutput()
-		if err != nil {
-			return err
-		}
-		if !strings.Contains(string(output), "RUNNING") {
-			return nil
+		params = []string{
+			"unshare", "-m", "--", "/bin/sh", "-c", shellString,
 		}
-		time.Sleep(500 * time.Millisecond)
 	}
+	return params
 }
 
-func (d *driver) version() string {
-	version := ""
-	if output, err := exec.Command("lxc-version").CombinedOutput(); err == nil {
-		outputStr := string(output)
-		if len(strings.SplitN(outputStr, ":", 2)) == 2 {
-			version = strings.TrimSpace(strings.SplitN(outputStr, ":", 2)[1])
-		}
+// Check the resource limits for combinations the kernel would reject
+// once lxc-start tries to apply them
+func validateResources(r *execdriver.Resources) error {
+	if r == nil {
+		return nil
+	}
+	if err := r.Validate(); err != nil {
+		return err
 	}
-	return version
+	return validateCgroupSupport(r)
 }
 
-func (d *driver) kill(c *execdriver.Command, sig int) error {
-	var (
-		err    error
-		output []byte
-	)
-	_, err = exec.LookPath("lxc-kill")
-	if err == nil {
-		output, err = exec.Command("lxc-kill", "-n", c.ID, strconv.Itoa(sig)).CombinedOutput()
-	} else {
-		output, err = exec.Command("lxc-stop", "-k", "-n", c.ID, strconv.Itoa(sig)).CombinedOutput()
+// Check the kernel provides the cgroup files the limits of r are written to
+func validateCgroupSupport(r *execdriver.Resources) error {
+	if r == nil {
+		return nil
 	}
+	if r.PidsLimit > 0 {
+		if _, err := cgroups.FindCgroupMountpoint("pids"); err != nil {
+			return fmt.Errorf("Unable to apply the pids limit, the pids cgroup is not available on this kernel: %s", err)
+		}
+	}
+	if err := validateThrottle("blkio.throttle.read_bps_device", r.BlkioDeviceReadBps); err != nil {
+		return err
+	}
+	if err := validateThrottle("blkio.throttle.write_bps_device", r.BlkioDeviceWriteBps); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Check the throttled devices and that the kernel provides the
+// blkio file their limits are written to
+func validateThrottle(file string, devices []execdriver.ThrottleDevice) error {
+	if len(devices) == 0 {
+		return nil
+	}
+	for _, t := range devices {
+		if _, err := t.CgroupString(); err != nil {
+			return err
+		}
+	}
+	mountpoint, err := cgroups.FindCgroupMountpoint("blkio")
+	if err != nil {
+		return fmt.Errorf("Unable to apply the blkio throttling, the blkio cgroup is not available: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(mountpoint, file)); err != nil {
+		return fmt.Errorf("Unable to apply the blkio throttling, %s is missing, the kernel lacks CONFIG_BLK_DEV_THROTTLING", file)
+	}
+	return nil
+}
+
+// The rootfs is wherever the image is mounted, independently of d.root
+func validateRootfs(rootfs string) error {
+	if rootfs == "" {
+		return fmt.Errorf("No rootfs specified for the container")
+	}
+	fi, err := os.Stat(rootfs)
+	if err != nil {
+		return fmt.Errorf("Invalid rootfs %s: %s", rootfs, err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("Invalid rootfs %s: not a directory", rootfs)
+	}
+	return nil
+}
+
+// The id names the directory of the container under d.root, make sure it
+// cannot point anywhere else before removing it
+func validateID(id string) error {
+	if id == "" || id == "." || strings.Contains(id, "/") || strings.Contains(id, "..") {
+		return fmt.Errorf("Invalid container id %q", id)
+	}
+	return nil
+}
+
+func validateNetwork(n *execdriver.Network) error {
+	if n.VethName != "" {
+		if err := execdriver.ValidateVethName(n.VethName); err != nil {
+			return err
+		}
+	}
+	if err := validateBandwidth(n); err != nil {
+		return err
+	}
+	if n.MacAddress == "" {
+		return nil
+	}
+	if _, err := net.ParseMAC(n.MacAddress); err != nil {
+		return fmt.Errorf("Invalid mac address %s: %s", n.MacAddress, err)
+	}
+	return nil
+}
+
+// Make sure the AppArmor profile name is either defined in profilesDir or
+// already loaded in the kernel, as listed in the loaded file
+func validateAppArmorProfile(name, profilesDir, loaded string) error {
+	if strings.ContainsAny(name, "/ \t\n") {
+		return fmt.Errorf("Invalid AppArmor profile name %q", name)
+	}
+	if _, err := os.Stat(filepath.Join(profilesDir, name)); err == nil {
+		return nil
+	}
+	// Each line of the kernel list reads "<name> (<mode>)"
+	if data, err := ioutil.ReadFile(loaded); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if fields := strings.Fields(line); len(fields) > 0 && fields[0] == name {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("AppArmor profile %s is neither defined in %s nor loaded", name, profilesDir)
+}
+
+// Returns a copy of r without the optional limits whose cgroup subsystem
+// is not mounted on this host so that lxc-start does not refuse to start
+// the container
+func dropUnsupportedResources(r *execdriver.Resources) *execdriver.Resources {
+	if r == nil {
+		return nil
+	}
+	supported := *r
+	if supported.BlkioWeight != 0 {
+		if _, err := cgroups.FindCgroupMountpoint("blkio"); err != nil {
+			log.Printf("WARNING: blkio cgroup is not mounted, ignoring blkio weight: %s", err)
+			supported.BlkioWeight = 0
+		}
+	}
+	return &supported
+}
+
+// Make sure the page size of every limit is one of the hugepage sizes of
+// the kernel, listed in hugepagesDir as hugepages-<size>kB
+func validateHugepageLimits(limits []execdriver.HugepageLimit, hugepagesDir string) error {
+	entries, err := ioutil.ReadDir(hugepagesDir)
 	if err != nil {
-		return fmt.Errorf("Err: %s Output: %s", err, output)
+		return fmt.Errorf("Unable to apply the hugepage limits, the kernel doesn't support hugepages: %s", err)
+	}
+	var available []string
+	for _, e := range entries {
+		var kb int64
+		if _, err := fmt.Sscanf(e.Name(), "hugepages-%dkB", &kb); err == nil {
+			available = append(available, hugepageSizeName(kb))
+		}
+	}
+	for _, h := range limits {
+		if h.Limit < 0 {
+			return fmt.Errorf("Hugepage limit %d of page size %s must be positive", h.Limit, h.PageSize)
+		}
+		found := false
+		for _, size := range available {
+			if size == h.PageSize {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("Unsupported hugepage size %q (available: %s)", h.PageSize, strings.Join(available, ", "))
+		}
 	}
 	return nil
 }
 
-func (d *driver) waitForStart(c *execdriver.Command, waitLock chan struct{}) error {
+// Returns the name of a hugepage size of kb in the hugetlb cgroup, e.g. "2MB"
+func hugepageSizeName(kb int64) string {
+	switch {
+	case kb >= 1<<20 && kb%(1<<20) == 0:
+		return fmt.Sprintf("%dGB", kb>>20)
+	case kb >= 1<<10 && kb%(1<<10) == 0:
+		return fmt.Sprintf("%dMB", kb>>10)
+	}
+	return fmt.Sprintf("%dKB", kb)
+}
+
+// Kill signals the init of the container and then every process left in
+// its cgroup, which catches the ones reparented outside of the init's tree
+func (d *driver) Kill(c *execdriver.Command, sig int) error {
+	d.setKilled(c.ID, true)
+	if err := d.kill(c, sig); err != nil {
+		return err
+	}
+	d.signalTasks(c.ID, sig)
+	return nil
+}
+
+// Send sig to every task of the cgroup of the container. The tasks file
+// is read right before signaling so that no stale, maybe reused, pid is hit.
+func (d *driver) signalTasks(id string, sig int) {
+	pids, err := d.GetPidsForContainer(id)
+	if err != nil {
+		// The cgroup is already gone along with the container
+		utils.Debugf("Unable to list the processes of container %s: %s", id, err)
+		return
+	}
+	for _, pid := range pids {
+		if err := syscall.Kill(pid, syscall.Signal(sig)); err != nil && err != syscall.ESRCH {
+			log.Printf("WARNING: Unable to send signal %d to process %d of container %s: %s", sig, pid, id, err)
+		}
+	}
+}
+
+func (d *driver) setKilled(id string, killed bool) {
+	d.killedLock.Lock()
+	defer d.killedLock.Unlock()
+
+	if !killed {
+		delete(d.killed, id)
+		return
+	}
+	if d.killed == nil {
+		d.killed = make(map[string]bool)
+	}
+	d.killed[id] = true
+}
+
+func (d *driver) isKilled(id string) bool {
+	d.killedLock.Lock()
+	defer d.killedLock.Unlock()
+	return d.killed[id]
+}
+
+// Signal delivers sig to the init process of the container, e.g. SIGHUP
+// to have it reload its configuration, without waiting for it to exit
+func (d *driver) Signal(c *execdriver.Command, sig int) error {
+	return d.kill(c, sig)
+}
+
+// Exec runs processArgs inside the namespaces of the already running
+// container c with lxc-attach and returns the exit code of the process
+func (d *driver) Exec(c *execdriver.Command, processArgs []string, pipes *execdriver.Pipes) (int, error) {
+	cmd, err := d.attachCommand(c.ID, processArgs)
+	if err != nil {
+		return -1, err
+	}
+	if pipes.Stdin != nil {
+		cmd.Stdin = pipes.Stdin
+	}
+	cmd.Stdout = pipes.Stdout
+	cmd.Stderr = pipes.Stderr
+
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return -1, err
+		}
+	}
+	return execdriver.ExitStatus(cmd.ProcessState), nil
+}
+
+// Probe runs processArgs in the running container id, for health checks,
+// and returns its exit code, its output is discarded. The probe and
+// lxc-attach are killed when it didn't exit within timeout, Probe then
+// returns a *ProbeTimeoutError.
+func (d *driver) Probe(id string, processArgs []string, timeout time.Duration) (int, error) {
+	cmd, err := d.attachCommand(id, processArgs)
+	if err != nil {
+		return -1, err
+	}
+	if err := cmd.Start(); err != nil {
+		return -1, err
+	}
+	waitErr := make(chan error, 1)
+	go func() {
+		waitErr <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-waitErr:
+		if err != nil {
+			if _, ok := err.(*exec.ExitError); !ok {
+				return -1, err
+			}
+		}
+		return execdriver.ExitStatus(cmd.ProcessState), nil
+	case <-time.After(timeout):
+		killTree(cmd.Process.Pid)
+		<-waitErr
+		return -1, &ProbeTimeoutError{ID: id, Timeout: timeout}
+	}
+}
+
+// Kill pid and its descendants, the processes lxc-attach runs in the
+// container are among them and would survive it otherwise. They are killed
+// until none is left, as one may have forked while its parent was killed.
+func killTree(pid int) {
+	for i := 0; i < 10; i++ {
+		pids := descendants(pid)
+		if len(pids) == 0 {
+			break
+		}
+		for _, p := range pids {
+			syscall.Kill(p, syscall.SIGKILL)
+		}
+	}
+	syscall.Kill(pid, syscall.SIGKILL)
+}
+
+// Returns the live processes descending from pid, from the parent of
+// every process in /proc
+func descendants(pid int) []int {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+	children := make(map[int][]int)
+	for _, entry := range entries {
+		p, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		stat, err := ioutil.ReadFile(path.Join("/proc", entry.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+		// pid (comm) state ppid ..., comm may hold spaces and parentheses
+		fields := strings.Fields(string(stat[bytes.LastIndex(stat, []byte(")"))+1:]))
+		if len(fields) < 2 || fields[0] == "Z" {
+			continue
+		}
+		if ppid, err := strconv.Atoi(fields[1]); err == nil {
+			children[ppid] = append(children[ppid], p)
+		}
+	}
+
+	var pids []int
+	for queue := append([]int(nil), children[pid]...); len(queue) > 0; queue = queue[1:] {
+		pids = append(pids, queue[0])
+		queue = append(queue, children[queue[0]]...)
+	}
+	return pids
+}
+
+// Returns the lxc-attach command running processArgs in the container id
+func (d *driver) attachCommand(id string, processArgs []string) (*exec.Cmd, error) {
+	if len(processArgs) == 0 {
+		return nil, fmt.Errorf("No command specified to run in container %s", id)
+	}
+	if _, err := exec.LookPath(d.tool("lxc-attach")); err != nil {
+		return nil, fmt.Errorf("Unable to exec in container %s: %s", id, err)
+	}
+	if version := d.version(); !versionAtLeast(version, minAttachVersion) {
+		return nil, fmt.Errorf("lxc-attach from lxc %q is too old to run commands, %s or later is required", version, minAttachVersion)
+	}
+	return exec.Command(d.tool("lxc-attach"), append([]string{"-n", id, "--"}, processArgs...)...), nil
+}
+
+// Stop sends SIGTERM to the container and escalates to SIGKILL if it
+// is still RUNNING once timeout has elapsed
+func (d *driver) Stop(c *execdriver.Command, timeout time.Duration) error {
+	d.setKilled(c.ID, true)
+	defer unshapeBandwidth(c)
+	if len(c.PreStop) > 0 {
+		pid, _ := d.runningInitPid(c.ID)
+		d.runHookLogged("PreStop", c.PreStop, c.ID, pid)
+	}
+	if err := d.kill(c, int(syscall.SIGTERM)); err != nil {
+		return err
+	}
+	stopped, err := d.waitNotRunning(c.ID, timeout)
+	if err != nil || stopped {
+		return err
+	}
+
+	log.Printf("Container %s failed to exit within %s of SIGTERM - using the force", c.ID, timeout)
+	if err := d.kill(c, int(syscall.SIGKILL)); err != nil {
+		return err
+	}
+	d.signalTasks(c.ID, int(syscall.SIGKILL))
+	if stopped, err = d.waitNotRunning(c.ID, killTimeout); err != nil {
+		return err
+	}
+	if !stopped {
+		return fmt.Errorf("Container %s is still running %s after SIGKILL", c.ID, killTimeout)
+	}
+	return nil
+}
+
+// Terminate is a hard stop for emergencies: it SIGKILLs the container and
+// returns as soon as the signal is sent, without waiting for it to exit.
+// With remove, the directory of the container is deleted right away, for
+// flows like "docker rm -f" which don't wait for Run to return.
+func (d *driver) Terminate(c *execdriver.Command, remove bool) error {
+	d.setKilled(c.ID, true)
+	defer unshapeBandwidth(c)
+	if len(c.PreStop) > 0 {
+		pid, _ := d.runningInitPid(c.ID)
+		d.runHookLogged("PreStop", c.PreStop, c.ID, pid)
+	}
+	err := d.kill(c, int(syscall.SIGKILL))
+	d.signalTasks(c.ID, int(syscall.SIGKILL))
+	if remove {
+		rmErr := validateID(c.ID)
+		if rmErr == nil {
+			rmErr = os.RemoveAll(path.Join(d.root, "containers", c.ID))
+		}
+		if err == nil {
+			err = rmErr
+		}
+	}
+	return err
+}
+
+// Poll lxc-info until the container is no longer RUNNING, returns false
+// if it still is once timeout has elapsed
+func (d *driver) waitNotRunning(id string, timeout time.Duration) (bool, error) {
+	for now := time.Now(); ; {
+		state, err := d.State(id)
+		if err != nil {
+			return false, err
+		}
+		if state != execdriver.StateRunning {
+			return true, nil
+		}
+		if time.Since(now) >= timeout {
+			return false, nil
+		}
+		time.Sleep(d.pollInterval)
+	}
+}
+
+func (d *driver) Pause(c *execdriver.Command) error {
+	return d.setFrozen(c.ID, d.tool("lxc-freeze"), "FROZEN")
+}
+
+func (d *driver) Unpause(c *execdriver.Command) error {
+	return d.setFrozen(c.ID, d.tool("lxc-unfreeze"), "THAWED")
+}
+
+// setFrozen moves the container's freezer cgroup to state using the given
+// lxc tool, or by writing freezer.state directly when the tool is missing,
+// and then waits for the freezer to confirm the transition
+func (d *driver) setFrozen(id, tool, state string) error {
+	cgroupDir, err := d.findCgroupDir("freezer", id)
+	if err != nil {
+		return err
+	}
+	stateFile := filepath.Join(cgroupDir, "freezer.state")
+
+	if _, err := exec.LookPath(tool); err == nil {
+		if output, err := exec.Command(tool, "-n", id).CombinedOutput(); err != nil {
+			return fmt.Errorf("Err: %s Output: %s", err, output)
+		}
+	} else if err := ioutil.WriteFile(stateFile, []byte(state), 0); err != nil {
+		return err
+	}
+
+	// Freezing is not instantaneous, the kernel reports FREEZING
+	// until every task in the cgroup has been stopped
+	var current string
+	for i := 0; i < 20; i++ {
+		data, err := ioutil.ReadFile(stateFile)
+		if err != nil {
+			return err
+		}
+		if current = strings.TrimSpace(string(data)); current == state {
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return fmt.Errorf("Container %s freezer state is %s, expected %s", id, current, state)
+}
+
+// Restore re-attaches to a container started by a previous daemon and waits
+// for it to exit. Its processes are not our children so their exit status
+// can't be collected and -1 is returned once lxc stops reporting it running.
+func (d *driver) Restore(c *execdriver.Command) (int, error) {
+	return -1, d.waitStopped(c.ID)
+}
+
+// waitStopped polls lxc-info until the container is neither running nor
+// known to lxc anymore, which covers a container already gone on restore
+func (d *driver) waitStopped(id string) error {
+	for {
+		state, err := d.State(id)
+		if err != nil {
+			return err
+		}
+		if state != execdriver.StateRunning {
+			return nil
+		}
+		time.Sleep(restorePollInterval)
+	}
+}
+
+// WaitStopped blocks until the container id is STOPPED or unknown to lxc.
+// Unlike polling IsRunning it also waits for a STOPPING or ABORTING
+// container to be torn down, its interfaces and cgroups freed, e.g. before
+// starting it again. Returns execdriver.ErrWaitTimeoutReached when the
+// container is still around once timeout has elapsed.
+func (d *driver) WaitStopped(id string, timeout time.Duration) error {
+	for now := time.Now(); ; {
+		state, err := d.State(id)
+		if err != nil {
+			return err
+		}
+		if state == execdriver.StateStopped {
+			return nil
+		}
+		if time.Since(now) >= timeout {
+			return execdriver.ErrWaitTimeoutReached
+		}
+		time.Sleep(d.pollInterval)
+	}
+}
+
+// Resize sets the size of the tty of a running container, e.g. when
+// the window of the client attached to it changes
+func (d *driver) Resize(c *execdriver.Command, height, width int) error {
+	if _, ok := c.Terminal.(execdriver.TtyTerminal); !ok {
+		return fmt.Errorf("Container %s has no tty to resize", c.ID)
+	}
+	return c.Terminal.Resize(height, width)
+}
+
+// Clean removes the directory holding the generated config of
+// the container once it is not running anymore
+func (d *driver) Clean(id string) error {
+	if err := validateID(id); err != nil {
+		return err
+	}
+	state, err := d.State(id)
+	if err != nil {
+		return err
+	}
+	if state == execdriver.StateRunning {
+		return fmt.Errorf("Container %s is running, stop it before cleaning it up", id)
+	}
+	// Left loaded when the daemon went away while the container ran
+	if name := generatedProfileName(id); d.apparmor && d.configValue(id, "lxc.aa_profile") == name {
+		if err := unloadApparmorProfile(name); err != nil {
+			utils.Debugf("%s", err)
+		}
+	}
+	return os.RemoveAll(path.Join(d.root, "containers", id))
+}
+
+// List returns the ids of the containers the driver generated a config
+// for, running or not, e.g. to reconcile them with the daemon after a crash.
+// Their states are then given by State.
+func (d *driver) List() ([]string, error) {
+	dirs, err := ioutil.ReadDir(path.Join(d.root, "containers"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var ids []string
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(path.Join(d.root, "containers", dir.Name(), "config.lxc")); err == nil {
+			ids = append(ids, dir.Name())
+		}
+	}
+	return ids, nil
+}
+
+// Capabilities reports the features usable with the detected
+// lxc version and the cgroup subsystems mounted on this host
+func (d *driver) Capabilities() execdriver.DriverCapabilities {
+	var (
+		version = d.version()
+		caps    execdriver.DriverCapabilities
+	)
+	if _, err := exec.LookPath(d.tool("lxc-attach")); err == nil {
+		caps.Exec = versionAtLeast(version, minAttachVersion)
+	}
+	if _, err := os.Stat("/proc/self/ns/user"); err == nil {
+		caps.UserNamespaces = versionAtLeast(version, minIDMapVersion)
+	}
+	if root, err := d.cgroupRoot("memory"); err == nil {
+		_, err = os.Stat(filepath.Join(root, "memory.memsw.limit_in_bytes"))
+		caps.MemorySwap = err == nil
+	}
+	for subsystem, supported := range map[string]*bool{
+		"freezer": &caps.Pause,
+		"cpuset":  &caps.CpusetCgroup,
+		"blkio":   &caps.BlkioCgroup,
+		"pids":    &caps.PidsCgroup,
+	} {
+		_, err := cgroups.FindCgroupMountpoint(subsystem)
+		*supported = err == nil
+	}
+	return caps
+}
+
+// The version of lxc, as detected when the driver was created
+func (d *driver) version() string {
+	return d.lxcVersion
+}
+
+func (d *driver) detectVersion() string {
+	// lxc-version is gone since lxc 1.0 where the version is reported by
+	// the tools themselves. lxc-start comes first, it may be pinned to
+	// another version than the one of the tools in PATH.
+	for _, args := range [][]string{{d.tool("lxc-start"), "--version"}, {"lxc-version"}} {
+		if output, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err == nil {
+			if version := parseVersion(string(output)); version != "" {
+				return version
+			}
+		}
+	}
+	return ""
+}
+
+// Extract the version from the output of "lxc-version", e.g.
+// "lxc version: 0.9.0", or from the bare "1.0.7" of "lxc-start --version"
+func parseVersion(output string) string {
+	output = strings.TrimSpace(output)
+	if parts := strings.SplitN(output, ":", 2); len(parts) == 2 {
+		output = strings.TrimSpace(parts[1])
+	}
+	if fields := strings.Fields(output); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
+
+// Returns true if the lxc version is at least min, an unparsable
+// version is considered too old
+func versionAtLeast(version, min string) bool {
+	v, err := utils.ParseRelease(version)
+	if err != nil {
+		return false
+	}
+	m, err := utils.ParseRelease(min)
+	if err != nil {
+		return false
+	}
+	return utils.CompareKernelVersion(v, m) >= 0
+}
+
+func (d *driver) kill(c *execdriver.Command, sig int) error {
 	var (
 		err    error
 		output []byte
 	)
+	_, err = exec.LookPath(d.tool("lxc-kill"))
+	if err == nil {
+		output, err = exec.Command(d.tool("lxc-kill"), "-n", c.ID, strconv.Itoa(sig)).CombinedOutput()
+	} else if sig == int(syscall.SIGKILL) {
+		output, err = exec.Command(d.tool("lxc-stop"), "-k", "-n", c.ID).CombinedOutput()
+	} else {
+		// lxc-kill is gone since lxc 1.0 and lxc-stop can only
+		// terminate, signal the init of the container ourselves
+		var pid int
+		if pid, output, err = d.initPid(c.ID); err == nil {
+			err = syscall.Kill(pid, syscall.Signal(sig))
+		}
+	}
+	if err != nil {
+		return &KillError{ID: c.ID, Signal: sig, Err: err, Output: output}
+	}
+	return nil
+}
+
+// waitForStart polls lxc-info until the container is RUNNING. waitErr holds
+// the error of the Wait goroutine and must only be read once waitLock is closed.
+func (d *driver) waitForStart(c *execdriver.Command, waitLock chan struct{}, waitErr *error) error {
+	state := execdriver.StateUnknown
 	// We wait for the container to be fully running.
-	// Timeout after 5 seconds. In case of broken pipe, just retry.
+	// Timeout after d.startTimeout, State retries failed lxc-info calls.
 	// Note: The container can run and finish correctly before
 	// the end of this loop
-	for now := time.Now(); time.Since(now) < 5*time.Second; {
+	for now := time.Now(); time.Since(now) < d.startTimeout; {
 		select {
 		case <-waitLock:
-			// If the process dies while waiting for it, just return
-			return nil
-			if c.ProcessState != nil && c.ProcessState.Exited() {
+			// If the process dies while waiting for it, it either ran to
+			// completion, which is fine, or waiting on it failed altogether
+			if c.ProcessState != nil {
+				// A container exiting non-zero before it was seen
+				// RUNNING can't be told apart from lxc-start failing
+				// to launch it, don't pass its code off as the app's
+				if !c.ProcessState.Success() {
+					return &LaunchError{ID: c.ID, ExitCode: execdriver.ExitStatus(c.ProcessState), Log: d.lastLogLines(c.ID)}
+				}
 				return nil
 			}
+			if *waitErr != nil {
+				return *waitErr
+			}
+			return execdriver.ErrNotRunning
 		default:
 		}
 
-		output, err = d.getInfo(c.ID)
-		if err != nil {
-			output, err = d.getInfo(c.ID)
-			if err != nil {
-				return err
-			}
+		var err error
+		if state, err = d.State(c.ID); err != nil {
+			return err
 		}
-		if strings.Contains(string(output), "RUNNING") {
+		if state == execdriver.StateRunning {
 			return nil
 		}
-		time.Sleep(50 * time.Millisecond)
+		time.Sleep(d.pollInterval)
+	}
+	// Callers compare against ErrNotRunning, the details are only logged
+	if logged := d.lastLogLines(c.ID); logged != "" {
+		log.Printf("Container %s not running after %s, last state: %s, lxc-start errors: %s", c.ID, d.startTimeout, state, logged)
+	} else {
+		log.Printf("Container %s not running after %s, last state: %s", c.ID, d.startTimeout, state)
 	}
 	return execdriver.ErrNotRunning
 }
 
-func (d *driver) getInfo(id string) ([]byte, error) {
-	return exec.Command("lxc-info", "-s", "-n", id).CombinedOutput()
+// Where lxc-start logs its own errors, apart from the output of the container
+func (d *driver) logPath(id string) string {
+	return path.Join(d.root, "containers", id, "lxc-start.log")
+}
+
+var logLevels = map[string]string{
+	"debug":   "DEBUG",
+	"info":    "INFO",
+	"warn":    "WARN",
+	"warning": "WARN",
+	"error":   "ERROR",
+}
+
+// Returns the lxc-start -l value of a log level, empty for the default
+func lxcLogLevel(level string) (string, error) {
+	if level == "" {
+		return "", nil
+	}
+	if name, ok := logLevels[strings.ToLower(level)]; ok {
+		return name, nil
+	}
+	return "", fmt.Errorf("Invalid lxc log level %q, expected debug, info, warn or error", level)
+}
+
+// Returns the last lines lxc-start logged, joined on a single line
+func (d *driver) lastLogLines(id string) string {
+	data, err := ioutil.ReadFile(d.logPath(id))
+	if err != nil {
+		return ""
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > maxLogLines {
+		lines = lines[len(lines)-maxLogLines:]
+	}
+	return strings.Join(lines, "; ")
+}
+
+// Returns the host pid of the init process of the container along
+// with the lxc-info output it was read from
+func (d *driver) initPid(id string) (int, []byte, error) {
+	output, err := exec.Command(d.tool("lxc-info"), "-p", "-n", id).CombinedOutput()
+	if err != nil {
+		return -1, output, err
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) == 2 && strings.ToLower(strings.TrimSpace(parts[0])) == "pid" {
+			if pid, err := strconv.Atoi(strings.TrimSpace(parts[1])); err == nil && pid > 0 {
+				return pid, output, nil
+			}
+		}
+	}
+	return -1, output, fmt.Errorf("No pid found for container %s", id)
 }
 
 type info struct {
@@ -278,17 +1481,12 @@ type info struct {
 }
 
 func (i *info) IsRunning() bool {
-	var running bool
-
-	output, err := i.driver.getInfo(i.ID)
+	state, err := i.driver.State(i.ID)
 	if err != nil {
-		utils.Errorf("Error getting info for lxc container %s: %s (%s)", i.ID, err, output)
+		utils.Errorf("%s", err)
 		return false
 	}
-	if strings.Contains(string(output), "RUNNING") {
-		running = true
-	}
-	return running
+	return state == execdriver.StateRunning
 }
 
 func (d *driver) Info(id string) execdriver.Info {
@@ -298,49 +1496,178 @@ func (d *driver) Info(id string) execdriver.Info {
 	}
 }
 
+// Returns the cgroup directory of the container for the given subsystem
+func (d *driver) findCgroupDir(subsystem, id string) (string, error) {
+	root, err := d.cgroupRoot(subsystem)
+	if err != nil {
+		return "", err
+	}
+
+	if rel := d.cgroupDir(id); rel != "" {
+		return filepath.Join(root, rel), nil
+	}
+	dir := filepath.Join(root, id)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		// With more recent lxc versions use, cgroup will be in lxc/
+		dir = filepath.Join(root, "lxc", id)
+	}
+	return dir, nil
+}
+
+// Returns the lxc.cgroup.dir of the container, empty when lxc picks it
+func lxcCgroupDir(c *execdriver.Command) string {
+	if c.CgroupParent == "" {
+		return ""
+	}
+	return path.Join(strings.Trim(c.CgroupParent, "/"), c.ID)
+}
+
+// The cgroup parent is relative to the cgroup of the daemon, it can't
+// escape it
+func validateCgroupParent(parent string) error {
+	clean := path.Clean(strings.Trim(parent, "/"))
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("Invalid cgroup parent %q", parent)
+	}
+	return nil
+}
+
+func (d *driver) setCgroupDir(id, dir string) {
+	d.cgroupLock.Lock()
+	defer d.cgroupLock.Unlock()
+	if d.cgroupDirs == nil {
+		d.cgroupDirs = make(map[string]string)
+	}
+	d.cgroupDirs[id] = dir
+}
+
+// Returns the cgroup of the container relative to the daemon's when it was
+// started under a CgroupParent, from its config if it was by a previous daemon
+func (d *driver) cgroupDir(id string) string {
+	d.cgroupLock.Lock()
+	defer d.cgroupLock.Unlock()
+	if dir, ok := d.cgroupDirs[id]; ok {
+		return dir
+	}
+	dir := d.configValue(id, "lxc.cgroup.dir")
+	if d.cgroupDirs == nil {
+		d.cgroupDirs = make(map[string]string)
+	}
+	d.cgroupDirs[id] = dir
+	return dir
+}
+
+// Returns the value of key in the lxc config the container id was last
+// started with, "" when it isn't set
+func (d *driver) configValue(id, key string) string {
+	var value string
+	if data, err := ioutil.ReadFile(path.Join(d.root, "containers", id, "config.lxc")); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if parts := strings.SplitN(line, "=", 2); len(parts) == 2 && strings.TrimSpace(parts[0]) == key {
+				value = strings.TrimSpace(parts[1])
+			}
+		}
+	}
+	return value
+}
+
+// Returns the cgroup the daemon runs in for the given subsystem. Looking it
+// up means parsing both /proc/self/mountinfo and /proc/self/cgroup so the
+// result is kept until the directory disappears, e.g. hierarchy unmounted.
+func (d *driver) cgroupRoot(subsystem string) (string, error) {
+	d.cgroupLock.Lock()
+	defer d.cgroupLock.Unlock()
+
+	if root, ok := d.cgroupRoots[subsystem]; ok {
+		if _, err := os.Stat(root); err == nil {
+			return root, nil
+		}
+		delete(d.cgroupRoots, subsystem)
+	}
+
+	root, err := findCgroupRoot(subsystem)
+	if err != nil {
+		return "", err
+	}
+	if d.cgroupRoots == nil {
+		d.cgroupRoots = make(map[string]string)
+	}
+	d.cgroupRoots[subsystem] = root
+	return root, nil
+}
+
+func findCgroupRoot(subsystem string) (string, error) {
+	cgroupRoot, err := cgroups.FindCgroupMountpoint(subsystem)
+	if err != nil {
+		return "", err
+	}
+
+	cgroupDir, err := cgroups.GetThisCgroupDir(subsystem)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cgroupRoot, cgroupDir), nil
+}
+
 func (d *driver) GetPidsForContainer(id string) ([]int, error) {
 	pids := []int{}
 
 	// memory is chosen randomly, any cgroup used by docker works
-	subsystem := "memory"
-
-	cgroupRoot, err := cgroups.FindCgroupMountpoint(subsystem)
+	cgroupDir, err := d.findCgroupDir("memory", id)
 	if err != nil {
 		return pids, err
 	}
 
-	cgroupDir, err := cgroups.GetThisCgroupDir(subsystem)
+	output, err := ioutil.ReadFile(filepath.Join(cgroupDir, "tasks"))
 	if err != nil {
 		return pids, err
 	}
+	return execdriver.ParseTasks(output), nil
+}
 
-	filename := filepath.Join(cgroupRoot, cgroupDir, id, "tasks")
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		// With more recent lxc versions use, cgroup will be in lxc/
-		filename = filepath.Join(cgroupRoot, cgroupDir, "lxc", id, "tasks")
+// Like GetContainerInitPid, failing when the container is not running
+func (d *driver) runningInitPid(id string) (int, error) {
+	state, err := d.State(id)
+	if err != nil {
+		return -1, err
 	}
+	if state != execdriver.StateRunning {
+		return -1, fmt.Errorf("Container %s is not running", id)
+	}
+	return d.GetContainerInitPid(id)
+}
 
-	output, err := ioutil.ReadFile(filename)
+// GetContainerInitPid returns the host pid of the init process of the
+// container, as reported by lxc-info or else the lowest pid in its cgroup.
+// The latter is only a guess as pids could have wrapped around.
+func (d *driver) GetContainerInitPid(id string) (int, error) {
+	if pid, _, err := d.initPid(id); err == nil {
+		return pid, nil
+	}
+	pids, err := d.GetPidsForContainer(id)
 	if err != nil {
-		return pids, err
+		return -1, err
 	}
-	for _, p := range strings.Split(string(output), "\n") {
-		if len(p) == 0 {
-			continue
-		}
-		pid, err := strconv.Atoi(p)
-		if err != nil {
-			return pids, fmt.Errorf("Invalid pid '%s': %s", p, err)
+	if len(pids) == 0 {
+		return -1, fmt.Errorf("No process found for container %s", id)
+	}
+	lowest := pids[0]
+	for _, pid := range pids[1:] {
+		if pid < lowest {
+			lowest = pid
 		}
-		pids = append(pids, pid)
 	}
-	return pids, nil
+	return lowest, nil
 }
 
-func linkLxcStart(root string) error {
-	sourcePath, err := exec.LookPath("lxc-start")
+// Link lxc-start-unconfined to startPath, lxc-start in PATH when empty
+func linkLxcStart(root, startPath string) error {
+	if startPath == "" {
+		startPath = "lxc-start"
+	}
+	sourcePath, err := exec.LookPath(startPath)
 	if err != nil {
-		return err
+		return ErrLxcStartNotFound
 	}
 	targetPath := path.Join(root, "lxc-start-unconfined")
 
@@ -354,37 +1681,357 @@ func linkLxcStart(root string) error {
 	return os.Symlink(sourcePath, targetPath)
 }
 
-// TODO: This can be moved to the mountinfo reader in the mount pkg
 func rootIsShared() bool {
-	if data, err := ioutil.ReadFile("/proc/self/mountinfo"); err == nil {
-		for _, line := range strings.Split(string(data), "\n") {
-			cols := strings.Split(line, " ")
-			if len(cols) >= 6 && cols[4] == "/" {
-				return strings.HasPrefix(cols[6], "shared")
-			}
-		}
+	mounts, err := mount.GetMounts()
+	if err != nil {
+		// No idea, probably safe to assume so
+		return true
 	}
+	return isSharedRoot(mounts)
+}
 
-	// No idea, probably safe to assume so
-	return true
+// Whether / is a shared mount, going by the last mount on / as it
+// hides the ones before it
+func isSharedRoot(mounts []*mount.MountInfo) bool {
+	var root *mount.MountInfo
+	for _, m := range mounts {
+		if m.Mountpoint == "/" {
+			root = m
+		}
+	}
+	if root == nil {
+		return true
+	}
+	for _, field := range strings.Fields(root.Optional) {
+		if strings.HasPrefix(field, "shared:") {
+			return true
+		}
+	}
+	return false
 }
 
-func (d *driver) generateLXCConfig(c *execdriver.Command) (string, error) {
+// The config is written to a temporary file renamed into place once
+// complete so that a crash or a full disk never leaves a truncated one.
+// ipcPid is the init whose IPC namespace c joins as resolved by Run, the
+// one lxc-start is given, and mountTargets the mountpoints setupMounts
+// created for the mounts of c.
+func (d *driver) generateLXCConfig(c *execdriver.Command, ipcPid int, mountTargets map[string]string) (string, error) {
 	root := path.Join(d.root, "containers", c.ID, "config.lxc")
-	fo, err := os.Create(root)
+	tmp := root + ".tmp"
+	fo, err := os.Create(tmp)
 	if err != nil {
-		return "", err
+		return "", &ConfigError{ID: c.ID, Err: err}
 	}
-	defer fo.Close()
 
-	if err := LxcTemplateCompiled.Execute(fo, struct {
+	err = d.executeTemplate(fo, c, ipcPid, mountTargets)
+	if err == nil {
+		err = fo.Sync()
+	}
+	if closeErr := fo.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, root)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", &ConfigError{ID: c.ID, Err: err}
+	}
+	return root, nil
+}
+
+// RenderConfig returns the lxc config c would be started with, without
+// writing it to the container directory, e.g. to diff configs in tests
+func (d *driver) RenderConfig(c *execdriver.Command) ([]byte, error) {
+	ipcPid, err := d.ipcPid(c)
+	if err != nil {
+		return nil, &ConfigError{ID: c.ID, Err: err}
+	}
+	mountTargets, err := resolveMounts(c)
+	if err != nil {
+		return nil, &ConfigError{ID: c.ID, Err: err}
+	}
+	var buf bytes.Buffer
+	if err := d.executeTemplate(&buf, c, ipcPid, mountTargets); err != nil {
+		return nil, &ConfigError{ID: c.ID, Err: err}
+	}
+	return buf.Bytes(), nil
+}
+
+func (d *driver) executeTemplate(w io.Writer, c *execdriver.Command, ipcPid int, mountTargets map[string]string) error {
+	capKeep, capDrop, err := d.lxcCapabilities(c)
+	if err != nil {
+		return err
+	}
+	// The propagation is rendered as a mount option as is
+	for i := range c.Mounts {
+		if err := execdriver.ValidateMountPropagation(c.Mounts[i].Propagation()); err != nil {
+			return err
+		}
+	}
+	// POSIX shared memory lives in /dev/shm, not in the IPC namespace
+	var shmSource string
+	if c.IpcMode == execdriver.IpcModeHost {
+		shmSource = "/dev/shm"
+	} else if ipcPid > 0 {
+		shmSource = fmt.Sprintf("/proc/%d/root/dev/shm", ipcPid)
+	}
+	profile := c.AppArmorProfile
+	if c.GenerateAppArmor && d.apparmor {
+		profile = generatedProfileName(c.ID)
+	}
+	return LxcTemplateCompiled.Execute(w, struct {
 		*execdriver.Command
-		AppArmor bool
+		AppArmor   bool
+		ResolvConf string
+		LxcCapKeep []string
+		LxcCapDrop []string
+		ShmSource  string
+		LxcAutodev bool
+		CgroupDir  string
+
+		AppArmorProfile string            // the generated one in place of the one of Command
+		MountTargets    map[string]string // the mountpoints in the rootfs by destination
 	}{
-		Command:  c,
-		AppArmor: d.apparmor,
-	}); err != nil {
-		return "", err
+		Command:    c,
+		AppArmor:   d.apparmor,
+		ResolvConf: d.resolvConfPath(c),
+		LxcCapKeep: capKeep,
+		LxcCapDrop: capDrop,
+		ShmSource:  shmSource,
+		LxcAutodev: d.autodev(c),
+		CgroupDir:  lxcCgroupDir(c),
+
+		AppArmorProfile: profile,
+		MountTargets:    mountTargets,
+	})
+}
+
+// Whether lxc populates /dev, when asked to and supported by its version.
+// Older versions keep the /dev of the rootfs.
+func (d *driver) autodev(c *execdriver.Command) bool {
+	if !c.AutoDev {
+		return false
 	}
-	return root, nil
+	if version := d.version(); !versionAtLeast(version, minAutodevVersion) {
+		log.Printf("WARNING: lxc %q does not support lxc.autodev, %s keeps the /dev of its rootfs", version, c.ID)
+		return false
+	}
+	return true
+}
+
+// Returns the pid whose IPC namespace the container shares, 0 when
+// it gets its own
+func (d *driver) ipcPid(c *execdriver.Command) (int, error) {
+	if c.IpcMode == execdriver.IpcModeHost {
+		return 1, nil
+	}
+	if id := c.IpcContainer(); id != "" {
+		pid, err := d.runningInitPid(id)
+		if err != nil {
+			return -1, fmt.Errorf("Unable to join the IPC namespace of container %s: %s", id, err)
+		}
+		return pid, nil
+	}
+	return 0, nil
+}
+
+// Capabilities for lxc to keep or drop before dockerinit runs. A keep
+// list also takes away the capabilities we don't know about, it is used
+// whenever lxc supports it except for privileged containers which keep
+// everything but what was explicitly dropped.
+func (d *driver) lxcCapabilities(c *execdriver.Command) (keep, drop []string, err error) {
+	if !c.Privileged && versionAtLeast(d.version(), minCapKeepVersion) {
+		keep, err = setup.EarlyKeepCapabilities(c.Privileged, c.CapAdd, c.CapDrop)
+		return keep, nil, err
+	}
+	drop, err = setup.EarlyDropCapabilities(c.Privileged, c.CapAdd, c.CapDrop)
+	return nil, drop, err
+}
+
+// Reject the raw config lines which would silently override
+// settings of the generated config
+func validateLxcConf(conf []execdriver.KeyValuePair) error {
+	var conflicts []string
+	for _, pair := range conf {
+		// Each pair is rendered on a line of its own, another line would add
+		// a key out of these checks
+		if strings.ContainsAny(pair.Key, "\r\n") || strings.ContainsAny(pair.Value, "\r\n") {
+			return fmt.Errorf("Invalid lxc config %q = %q, line breaks are not allowed", pair.Key, pair.Value)
+		}
+		key := strings.TrimSpace(pair.Key)
+		if !strings.HasPrefix(key, "lxc.") {
+			return fmt.Errorf("Invalid lxc config key %q, expected lxc.*", pair.Key)
+		}
+		for _, managed := range managedLxcKeys {
+			if strings.HasPrefix(key, managed) {
+				conflicts = append(conflicts, key)
+				break
+			}
+		}
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("The lxc config keys %s are managed by the %s driver and can't be set", strings.Join(conflicts, ", "), DriverName)
+	}
+	return nil
+}
+
+// Resolve the destinations of the bind and tmpfs mounts and of the
+// allowed devices in the rootfs.
+// The symlinks of the image must not lead a mountpoint out of it, so
+// the config mounts on the resolved paths rather than on the destinations
+// lxc would resolve from the host.
+func resolveMounts(c *execdriver.Command) (map[string]string, error) {
+	targets := make(map[string]string)
+	for _, m := range c.Mounts {
+		if !filepath.IsAbs(m.Destination) {
+			return nil, fmt.Errorf("Invalid bind mount destination %s: the path must be absolute", m.Destination)
+		}
+		target, err := resolveInRoot(c.Rootfs, m.Destination)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid bind mount destination %s: %s", m.Destination, err)
+		}
+		targets[m.Destination] = target
+	}
+	for dest := range c.Tmpfs {
+		if !filepath.IsAbs(dest) {
+			return nil, fmt.Errorf("Invalid tmpfs destination %s: the path must be absolute", dest)
+		}
+		target, err := resolveInRoot(c.Rootfs, dest)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid tmpfs destination %s: %s", dest, err)
+		}
+		targets[dest] = target
+	}
+	for _, dev := range c.AllowedDevices {
+		target, err := resolveInRoot(c.Rootfs, dev.Path)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid device %s: %s", dev.Path, err)
+		}
+		targets[dev.Path] = target
+	}
+	return targets, nil
+}
+
+// Make sure the sources of the bind mounts exist and create the
+// mountpoints of the bind and tmpfs mounts and of the allowed devices in
+// the rootfs, returned by destination
+func setupMounts(c *execdriver.Command) (map[string]string, error) {
+	targets, err := resolveMounts(c)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range c.Mounts {
+		fi, err := os.Stat(m.Source)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid bind mount source %s: %s", m.Source, err)
+		}
+		if err := createMountpoint(targets[m.Destination], fi.IsDir()); err != nil {
+			return nil, err
+		}
+	}
+	for dest := range c.Tmpfs {
+		if err := os.MkdirAll(targets[dest], 0755); err != nil {
+			return nil, err
+		}
+	}
+	// Device nodes get bind mounted over an empty file, an existing
+	// node of the image is mounted over
+	for _, dev := range c.AllowedDevices {
+		if err := createMountpoint(targets[dev.Path], false); err != nil {
+			return nil, err
+		}
+	}
+	return targets, nil
+}
+
+// Create the target of a bind mount, a directory or an empty file to
+// mount a single file over, e.g. /etc/hosts. target is resolved in the
+// rootfs already, a symlink of the image swapped in since isn't followed.
+func createMountpoint(target string, dir bool) error {
+	if dir {
+		return os.MkdirAll(target, 0755)
+	}
+	if fi, err := os.Lstat(target); err == nil {
+		if fi.IsDir() {
+			return fmt.Errorf("Unable to bind mount a file over the directory %s", target)
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("Unable to bind mount a file over the symlink %s", target)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|syscall.O_NOFOLLOW, 0644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// When the ids are remapped, give the rootfs to the host ids
+// container root is mapped to so that it can still own it
+func setupUserNamespace(c *execdriver.Command) error {
+	if len(c.UidMappings) == 0 && len(c.GidMappings) == 0 {
+		return nil
+	}
+	if _, err := os.Stat("/proc/self/ns/user"); err != nil {
+		return fmt.Errorf("User namespaces are not enabled in this kernel, unable to remap the ids of %s", c.ID)
+	}
+	uid, err := hostIDFor(c.UidMappings, 0)
+	if err != nil {
+		return fmt.Errorf("Invalid uid mappings: %s", err)
+	}
+	gid, err := hostIDFor(c.GidMappings, 0)
+	if err != nil {
+		return fmt.Errorf("Invalid gid mappings: %s", err)
+	}
+	return os.Lchown(c.Rootfs, uid, gid)
+}
+
+// Returns the host id the container id is mapped to. Without any
+// mapping for that kind of id, it is left untouched.
+func hostIDFor(mappings []execdriver.IDMap, id int) (int, error) {
+	if len(mappings) == 0 {
+		return id, nil
+	}
+	for _, m := range mappings {
+		if id >= m.ContainerID && id < m.ContainerID+m.Size {
+			return m.HostID + id - m.ContainerID, nil
+		}
+	}
+	return -1, fmt.Errorf("container id %d is not mapped", id)
+}
+
+// Returns the path of the resolv.conf generated for the container
+// or an empty string when it keeps the one it was created with
+func (d *driver) resolvConfPath(c *execdriver.Command) string {
+	if len(c.Dns) == 0 && len(c.DnsSearch) == 0 {
+		return ""
+	}
+	return path.Join(d.root, "containers", c.ID, "resolv.conf")
+}
+
+// Write the resolv.conf for the custom dns settings of the container.
+// It is bind mounted over /etc/resolv.conf in the container rather than
+// written in place as the rootfs copy can itself be a bind mount of the host's.
+func (d *driver) writeResolvConf(c *execdriver.Command) error {
+	p := d.resolvConfPath(c)
+	if p == "" {
+		return nil
+	}
+	var content bytes.Buffer
+	for _, dns := range c.Dns {
+		fmt.Fprintf(&content, "nameserver %s\n", dns)
+	}
+	if len(c.DnsSearch) > 0 {
+		fmt.Fprintf(&content, "search %s\n", strings.Join(c.DnsSearch, " "))
+	}
+	if err := ioutil.WriteFile(p, content.Bytes(), 0644); err != nil {
+		return err
+	}
+	// Enforce the mode in case the file already existed or the umask is stricter
+	return os.Chmod(p, 0644)
 }
@@ -0,0 +1,1441 @@
+package lxc
+
+import (
+	"fmt"
+	"github.com/dotcloud/docker/execdriver"
+	"github.com/dotcloud/docker/pkg/cgroups"
+	"github.com/dotcloud/docker/pkg/mount"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWaitForStartProcessExited(t *testing.T) {
+	if _, err := exec.LookPath("true"); err != nil {
+		t.Skip("true is not available")
+	}
+	d := &driver{startTimeout: defaultStartTimeout, pollInterval: defaultPollInterval}
+	c := &execdriver.Command{ID: "1"}
+	c.Cmd = *exec.Command("true")
+
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		waitErr  error
+		waitLock = make(chan struct{})
+	)
+	go func() {
+		c.Wait()
+		close(waitLock)
+	}()
+	<-waitLock
+
+	if err := d.waitForStart(c, waitLock, &waitErr); err != nil {
+		t.Fatalf("Expected no error for a process that exited before RUNNING, got %s", err)
+	}
+}
+
+func TestWaitForStartTimeout(t *testing.T) {
+	root, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	info := path.Join(root, "lxc-info")
+	if err := ioutil.WriteFile(info, []byte("#!/bin/sh\necho 'State: STARTING'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	d := &driver{
+		root:         root,
+		startTimeout: 50 * time.Millisecond,
+		pollInterval: 10 * time.Millisecond,
+		infoRetries:  1,
+		toolPaths:    map[string]string{"lxc-info": info},
+	}
+	c := &execdriver.Command{ID: "1"}
+	c.Cmd = *exec.Command("sleep", "10")
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Process.Kill()
+
+	var waitErr error
+	if err := d.waitForStart(c, make(chan struct{}), &waitErr); err != execdriver.ErrNotRunning {
+		t.Fatalf("Expected ErrNotRunning once the start timed out, got %v", err)
+	}
+}
+
+func TestWaitForStartLaunchFailed(t *testing.T) {
+	root, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	d := &driver{root: root, startTimeout: defaultStartTimeout, pollInterval: defaultPollInterval}
+	if err := os.MkdirAll(path.Join(root, "containers", "1"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	var log []string
+	for i := 1; i <= 8; i++ {
+		log = append(log, fmt.Sprintf("lxc-start 1400000000.000 ERROR lxc_confile - line %d", i))
+	}
+	if err := ioutil.WriteFile(d.logPath("1"), []byte(strings.Join(log, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &execdriver.Command{ID: "1"}
+	c.Cmd = *exec.Command("/bin/sh", "-c", "exit 1")
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		waitErr  error
+		waitLock = make(chan struct{})
+	)
+	go func() {
+		c.Wait()
+		close(waitLock)
+	}()
+	<-waitLock
+
+	err = d.waitForStart(c, waitLock, &waitErr)
+	if err == nil {
+		t.Fatal("Expected an error when lxc-start logged errors before RUNNING")
+	}
+	if !strings.Contains(err.Error(), "line 8") || strings.Contains(err.Error(), "line 3") {
+		t.Fatalf("Expected the last %d lines of the log in the error, got %s", maxLogLines, err)
+	}
+}
+
+func TestReadCpuacctStat(t *testing.T) {
+	root, err := ioutil.TempDir("", "TestReadCpuacctStat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	filename := path.Join(root, "cpuacct.stat")
+	if err := ioutil.WriteFile(filename, []byte("user 250\nsystem 42\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	user, system, err := readCpuacctStat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != 2500000000 || system != 420000000 {
+		t.Fatalf("Unexpected cpu times user=%d system=%d", user, system)
+	}
+}
+
+func TestDropUnsupportedResources(t *testing.T) {
+	r := &execdriver.Resources{BlkioWeight: 500}
+	supported := dropUnsupportedResources(r)
+	if r.BlkioWeight != 500 {
+		t.Fatalf("Expected the resources of the caller to be left untouched, got a weight of %d", r.BlkioWeight)
+	}
+	_, err := cgroups.FindCgroupMountpoint("blkio")
+	if expected := map[bool]uint16{true: 500, false: 0}[err == nil]; supported.BlkioWeight != expected {
+		t.Fatalf("Expected a blkio weight of %d, got %d", expected, supported.BlkioWeight)
+	}
+	if dropUnsupportedResources(nil) != nil {
+		t.Fatal("Expected no resources back without any")
+	}
+}
+
+func TestValidateResourcesBlkioWeight(t *testing.T) {
+	for weight, valid := range map[uint16]bool{
+		0:    true,
+		9:    false,
+		10:   true,
+		500:  true,
+		1000: true,
+		1001: false,
+	} {
+		if err := validateResources(&execdriver.Resources{BlkioWeight: weight}); (err == nil) != valid {
+			t.Errorf("Unexpected result for blkio weight %d: %v", weight, err)
+		}
+	}
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	for version, expected := range map[string]bool{
+		"0.7.5":     false,
+		"0.8.0":     true,
+		"0.8.0-rc1": true,
+		"0.9.0":     true,
+		"1.0.7":     true,
+		"":          false,
+		"unknown":   false,
+	} {
+		if versionAtLeast(version, "0.8.0") != expected {
+			t.Errorf("Expected versionAtLeast(%q, 0.8.0) to be %v", version, expected)
+		}
+	}
+}
+
+func TestWriteResolvConf(t *testing.T) {
+	root, err := ioutil.TempDir("", "TestWriteResolvConf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	os.MkdirAll(path.Join(root, "containers", "1"), 0777)
+	d := &driver{root: root}
+
+	c := &execdriver.Command{ID: "1"}
+	if err := d.writeResolvConf(c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path.Join(root, "containers", "1", "resolv.conf")); !os.IsNotExist(err) {
+		t.Fatal("Expected no resolv.conf without custom dns settings")
+	}
+
+	c.Dns = []string{"8.8.8.8"}
+	if err := d.writeResolvConf(c); err != nil {
+		t.Fatal(err)
+	}
+	c.Dns = []string{"10.0.0.1", "10.0.0.2"}
+	c.DnsSearch = []string{"example.com", "corp"}
+	if err := d.writeResolvConf(c); err != nil {
+		t.Fatal(err)
+	}
+
+	p := d.resolvConfPath(c)
+	content, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "nameserver 10.0.0.1\nnameserver 10.0.0.2\nsearch example.com corp\n"
+	if string(content) != expected {
+		t.Fatalf("Expected %q, got %q", expected, content)
+	}
+	fi, err := os.Stat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0644 {
+		t.Fatalf("Expected mode 0644, got %s", fi.Mode())
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	for output, expected := range map[string]string{
+		"lxc version: 0.7.5\n":  "0.7.5",
+		"lxc version: 0.9.0":    "0.9.0",
+		"lxc version:  1.0.0  ": "1.0.0",
+		"1.0.7\n":               "1.0.7",
+		" 1.1.5 ":               "1.1.5",
+		"2.0.0.rc2\n":           "2.0.0.rc2",
+		"":                      "",
+		"lxc version:":          "",
+	} {
+		if version := parseVersion(output); version != expected {
+			t.Errorf("Expected %q from %q, got %q", expected, output, version)
+		}
+	}
+}
+
+func TestSetupMounts(t *testing.T) {
+	root, err := ioutil.TempDir("", "TestSetupMounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	var (
+		rootfs = path.Join(root, "rootfs")
+		source = path.Join(root, "config")
+	)
+	os.MkdirAll(rootfs, 0755)
+	os.MkdirAll(source, 0755)
+
+	c := &execdriver.Command{
+		Rootfs: rootfs,
+		Mounts: []execdriver.Mount{{Source: source, Destination: "/etc/app"}},
+	}
+	if _, err := setupMounts(c); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(path.Join(rootfs, "etc", "app")); err != nil || !fi.IsDir() {
+		t.Fatalf("Expected the mountpoint to be created: %v", err)
+	}
+
+	// Single files are mounted over an empty file
+	hosts := path.Join(root, "hosts")
+	if err := ioutil.WriteFile(hosts, []byte("127.0.0.1 localhost\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c.Mounts = []execdriver.Mount{{Source: hosts, Destination: "/etc/hosts"}}
+	if _, err := setupMounts(c); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(path.Join(rootfs, "etc", "hosts")); err != nil || !fi.Mode().IsRegular() {
+		t.Fatalf("Expected the mountpoint to be a regular file: %v", err)
+	}
+	c.Mounts = []execdriver.Mount{{Source: hosts, Destination: "/etc/app"}}
+	if _, err := setupMounts(c); err == nil {
+		t.Fatal("Expected an error mounting a file over a directory")
+	}
+
+	c.Mounts = []execdriver.Mount{{Source: path.Join(root, "missing"), Destination: "/missing"}}
+	if _, err := setupMounts(c); err == nil {
+		t.Fatal("Expected an error for a missing bind mount source")
+	}
+
+	c.Mounts = []execdriver.Mount{{Source: source, Destination: "/../outside"}}
+	if _, err := setupMounts(c); err == nil {
+		t.Fatal("Expected an error for a destination out of the rootfs")
+	}
+
+	// Symlinks of the image are resolved inside the rootfs
+	if err := os.Symlink(root, path.Join(rootfs, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	c.Mounts = []execdriver.Mount{{Source: source, Destination: "/escape/created"}}
+	if _, err := setupMounts(c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path.Join(root, "created")); err == nil {
+		t.Fatal("Expected the mountpoint not to be created out of the rootfs")
+	}
+	if _, err := os.Stat(path.Join(rootfs, root, "created")); err != nil {
+		t.Fatalf("Expected the mountpoint to be created in the rootfs: %v", err)
+	}
+
+	c.Mounts = []execdriver.Mount{{Source: hosts, Destination: "/escape/hosts"}}
+	if _, err := setupMounts(c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path.Join(root, "hosts.created")); err == nil {
+		t.Fatal("Expected the file mountpoint not to be created out of the rootfs")
+	}
+	target := path.Join(rootfs, "etc", "swapped")
+	if err := os.Symlink(path.Join(root, "hosts.created"), target); err != nil {
+		t.Fatal(err)
+	}
+	if err := createMountpoint(target, false); err == nil {
+		t.Fatal("Expected an error creating a file mountpoint over a symlink")
+	}
+	if _, err := os.Stat(path.Join(root, "hosts.created")); err == nil {
+		t.Fatal("Expected the symlink of the mountpoint not to be followed")
+	}
+
+	c.Mounts = nil
+	c.Tmpfs = map[string]string{"tmp": ""}
+	if _, err := setupMounts(c); err == nil {
+		t.Fatal("Expected an error for a relative tmpfs destination")
+	}
+	c.Tmpfs = map[string]string{"/escape/tmp": ""}
+	if _, err := setupMounts(c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path.Join(root, "tmp")); err == nil {
+		t.Fatal("Expected the tmpfs mountpoint not to be created out of the rootfs")
+	}
+}
+
+func TestHostIDFor(t *testing.T) {
+	mappings := []execdriver.IDMap{
+		{ContainerID: 0, HostID: 100000, Size: 1000},
+		{ContainerID: 1000, HostID: 1000, Size: 1},
+	}
+	for id, expected := range map[int]int{
+		0:    100000,
+		999:  100999,
+		1000: 1000,
+	} {
+		hostID, err := hostIDFor(mappings, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hostID != expected {
+			t.Errorf("Expected %d to be mapped to %d, got %d", id, expected, hostID)
+		}
+	}
+	if _, err := hostIDFor(mappings, 1001); err == nil {
+		t.Fatal("Expected an error for an unmapped id")
+	}
+	if hostID, err := hostIDFor(nil, 0); err != nil || hostID != 0 {
+		t.Fatalf("Expected ids to be untouched without mappings, got %d (%v)", hostID, err)
+	}
+}
+
+func BenchmarkFindCgroupDir(b *testing.B) {
+	d := &driver{}
+	if _, err := d.findCgroupDir("memory", "1"); err != nil {
+		b.Skip(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := d.findCgroupDir("memory", "1"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFindCgroupDirUncached(b *testing.B) {
+	if _, err := findCgroupRoot("memory"); err != nil {
+		b.Skip(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := findCgroupRoot("memory"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestRestoreContainerGone(t *testing.T) {
+	for _, script := range []string{
+		"echo 'state:   STOPPED'",
+		"echo \"$3 doesn't exist\"; exit 1",
+	} {
+		bin, err := ioutil.TempDir("", "docker-test-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(bin)
+		if err := ioutil.WriteFile(path.Join(bin, "lxc-info"), []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Setenv("PATH", os.Getenv("PATH"))
+		os.Setenv("PATH", bin+":"+os.Getenv("PATH"))
+
+		d := &driver{pollInterval: time.Millisecond}
+		exitCode, err := d.Restore(&execdriver.Command{ID: "1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exitCode != -1 {
+			t.Fatalf("Expected exit code -1, got %d", exitCode)
+		}
+	}
+}
+
+func TestSignalTrapped(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// Stand-in for the init of the container, trapping SIGHUP
+	trapped, ready := path.Join(tmp, "trapped"), path.Join(tmp, "ready")
+	cmd := exec.Command("/bin/sh", "-c", "trap 'touch "+trapped+"' HUP; touch "+ready+"; while true; do sleep 0.1; done")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+
+	// Don't signal before the trap is installed
+	for i := 0; ; i++ {
+		if _, err := os.Stat(ready); err == nil {
+			break
+		}
+		if i == 100 {
+			t.Fatal("The shell did not start")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// Without lxc-kill the signal goes to the pid reported by lxc-info
+	if err := ioutil.WriteFile(path.Join(tmp, "lxc-info"), []byte(fmt.Sprintf("#!/bin/sh\necho 'PID:   %d'\n", cmd.Process.Pid)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", tmp)
+
+	d := &driver{}
+	if err := d.Signal(&execdriver.Command{ID: "1"}, int(syscall.SIGHUP)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; ; i++ {
+		if _, err := os.Stat(trapped); err == nil {
+			break
+		}
+		if i == 100 {
+			t.Fatal("The SIGHUP handler was not triggered")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err := cmd.Process.Signal(syscall.Signal(0)); err != nil {
+		t.Fatalf("Expected the process to survive SIGHUP: %s", err)
+	}
+}
+
+func TestGetContainerInitPid(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// lxc-info fails, the pid comes from the nested lxc/<id> cgroup
+	if err := ioutil.WriteFile(path.Join(tmp, "lxc-info"), []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", tmp)
+
+	cgroup := path.Join(tmp, "cgroup")
+	if err := os.MkdirAll(path.Join(cgroup, "lxc", "1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(cgroup, "lxc", "1", "tasks"), []byte("4012\n3998\n4100\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d := &driver{cgroupRoots: map[string]string{"memory": cgroup}}
+	pid, err := d.GetContainerInitPid("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pid != 3998 {
+		t.Fatalf("Expected pid 3998, got %d", pid)
+	}
+
+	if err := ioutil.WriteFile(path.Join(tmp, "lxc-info"), []byte("#!/bin/sh\necho 'pid:   4012'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if pid, err = d.GetContainerInitPid("1"); err != nil {
+		t.Fatal(err)
+	}
+	if pid != 4012 {
+		t.Fatalf("Expected pid 4012 from lxc-info, got %d", pid)
+	}
+}
+
+func TestCapabilitiesLxcVersion(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", tmp)
+
+	if err := ioutil.WriteFile(path.Join(tmp, "lxc-attach"), []byte("#!/bin/sh\nexit 0\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	d := &driver{lxcVersion: "0.7.5"}
+	if caps := d.Capabilities(); caps.Exec || caps.UserNamespaces {
+		t.Fatalf("Expected lxc 0.7.5 to support neither exec nor user namespaces, got %+v", caps)
+	}
+
+	d.lxcVersion = "0.9.0"
+	if caps := d.Capabilities(); !caps.Exec || caps.UserNamespaces {
+		t.Fatalf("Expected lxc 0.9.0 to support exec only, got %+v", caps)
+	}
+
+	// Without lxc-attach there is no way to exec, whatever the version
+	if err := os.Remove(path.Join(tmp, "lxc-attach")); err != nil {
+		t.Fatal(err)
+	}
+	if caps := d.Capabilities(); caps.Exec {
+		t.Fatalf("Expected no exec support without lxc-attach, got %+v", caps)
+	}
+}
+
+func TestClean(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	bin := path.Join(tmp, "bin")
+	if err := os.Mkdir(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin)
+
+	setState := func(state string) {
+		if err := ioutil.WriteFile(path.Join(bin, "lxc-info"), []byte("#!/bin/sh\necho 'state:   "+state+"'\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d := &driver{root: tmp}
+	dir := path.Join(tmp, "containers", "1")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	setState("RUNNING")
+	if err := d.Clean("1"); err == nil {
+		t.Fatal("Expected an error cleaning up a running container")
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Fatalf("Expected the directory of a running container to be kept: %s", err)
+	}
+
+	setState("STOPPED")
+	if err := d.Clean("1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("Expected %s to be removed", dir)
+	}
+	if err := d.Clean("1"); err != nil {
+		t.Fatalf("Expected cleaning up twice to succeed: %s", err)
+	}
+
+	// Nothing outside of the directory of a container is removed
+	for _, id := range []string{"", ".", "..", "../..", "1/../.."} {
+		if err := d.Clean(id); err == nil {
+			t.Errorf("Expected an error cleaning up the container %q", id)
+		}
+	}
+	if _, err := os.Stat(path.Join(tmp, "containers")); err != nil {
+		t.Fatalf("Expected the containers directory to be kept: %s", err)
+	}
+}
+
+func TestBuildLaunchArgs(t *testing.T) {
+	params := []string{"lxc-start", "-n", "1", "--", "/.dockerinit", "--", "echo", "hello world"}
+
+	if args := buildLaunchArgs(params, false); strings.Join(args, "|") != strings.Join(params, "|") {
+		t.Fatalf("Expected the params unchanged when / is not shared, got %v", args)
+	}
+
+	args := buildLaunchArgs(params, true)
+	expected := []string{"unshare", "-m", "--", "/bin/sh", "-c", "mount --make-rslave /; exec lxc-start -n 1 -- /.dockerinit -- echo 'hello world'"}
+	if strings.Join(args, "|") != strings.Join(expected, "|") {
+		t.Fatalf("Expected %q, got %q", expected, args)
+	}
+}
+
+func TestNewDriverDisableUnshare(t *testing.T) {
+	root, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	d, err := NewDriver(root, false, Options{DisableUnshare: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.sharedRoot {
+		t.Fatal("Expected lxc-start not to be wrapped in unshare")
+	}
+}
+
+// Run c with stand-ins for the lxc tools, returning the arguments
+// lxc-start was given, space separated
+func runRecordingArgs(t *testing.T, c *execdriver.Command) string {
+	root, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// Stand-ins recording the arguments of lxc-start
+	bin := path.Join(root, "bin")
+	if err := os.Mkdir(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for tool, script := range map[string]string{
+		"lxc-start": "if [ \"$1\" = --version ]; then echo 2.1.0; exit 0; fi\nfor arg; do echo \"$arg\"; done > " + path.Join(root, "args"),
+		"lxc-info":  "echo 'state:   STOPPED'",
+	} {
+		if err := ioutil.WriteFile(path.Join(bin, tool), []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+":"+os.Getenv("PATH"))
+
+	d, err := NewDriver(root, false, Options{DisableUnshare: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(path.Join(root, "containers", "1"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(path.Join(root, "rootfs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	c.ID = "1"
+	c.Rootfs = path.Join(root, "rootfs")
+	if _, err := d.Run(c, execdriver.NewPipes(nil, ioutil.Discard, ioutil.Discard, false), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := ioutil.ReadFile(path.Join(root, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Join(strings.Split(strings.TrimSpace(string(output)), "\n"), " ")
+}
+
+func TestRunInitWrapper(t *testing.T) {
+	args := runRecordingArgs(t, &execdriver.Command{
+		InitPath:    "/.dockerinit",
+		InitWrapper: []string{"strace", "-f"},
+		User:        "nobody",
+		Entrypoint:  "true",
+	})
+	if !strings.Contains(args, " -- strace -f /.dockerinit -driver lxc -u nobody ") {
+		t.Fatalf("Expected dockerinit and its flags after the wrapper, got %s", args)
+	}
+}
+
+func TestRunHostPid(t *testing.T) {
+	args := runRecordingArgs(t, &execdriver.Command{
+		InitPath:   "/.dockerinit",
+		Entrypoint: "true",
+		HostPid:    true,
+	})
+	if !strings.Contains(args, " --share-pid 1 -- /.dockerinit ") {
+		t.Fatalf("Expected lxc-start to share the pid namespace of the host, got %s", args)
+	}
+}
+
+func TestResize(t *testing.T) {
+	d := &driver{}
+	c := &execdriver.Command{ID: "1"}
+	if err := execdriver.SetTerminal(c, execdriver.NewPipes(nil, ioutil.Discard, ioutil.Discard, false)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Resize(c, 24, 80); err == nil {
+		t.Fatal("Expected an error resizing a container without tty")
+	}
+
+	c = &execdriver.Command{ID: "1", Tty: true}
+	if err := execdriver.SetTerminal(c, execdriver.NewPipes(nil, ioutil.Discard, ioutil.Discard, false)); err != nil {
+		t.Skipf("Unable to allocate a pty: %s", err)
+	}
+	defer c.Terminal.Close()
+	if err := d.Resize(c, 50, 132); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKillSignalsEveryTask(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// Stand-ins for the init of the container and an orphaned worker
+	var procs []*exec.Cmd
+	for i := 0; i < 2; i++ {
+		cmd := exec.Command("sleep", "60")
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer cmd.Process.Kill()
+		procs = append(procs, cmd)
+	}
+
+	if err := ioutil.WriteFile(path.Join(tmp, "lxc-info"), []byte(fmt.Sprintf("#!/bin/sh\necho 'pid:   %d'\n", procs[0].Process.Pid)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", tmp)
+
+	cgroup := path.Join(tmp, "cgroup")
+	if err := os.MkdirAll(path.Join(cgroup, "lxc", "1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	tasks := fmt.Sprintf("%d\n%d\n", procs[0].Process.Pid, procs[1].Process.Pid)
+	if err := ioutil.WriteFile(path.Join(cgroup, "lxc", "1", "tasks"), []byte(tasks), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d := &driver{cgroupRoots: map[string]string{"memory": cgroup}}
+	if err := d.Kill(&execdriver.Command{ID: "1"}, int(syscall.SIGTERM)); err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range procs {
+		err := cmd.Wait()
+		if ws, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); !ok || !ws.Signaled() || ws.Signal() != syscall.SIGTERM {
+			t.Fatalf("Expected process %d to be terminated by SIGTERM, got %v", cmd.Process.Pid, err)
+		}
+	}
+}
+
+func TestFsUsage(t *testing.T) {
+	root, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	dir := path.Join(root, "containers", "1")
+	if err := os.MkdirAll(path.Join(dir, "logs"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(dir, "config.lxc"), make([]byte, 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(dir, "logs", "json"), make([]byte, 24), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Hard links are only counted once
+	if err := os.Link(path.Join(dir, "config.lxc"), path.Join(dir, "config.lxc.bak")); err != nil {
+		t.Fatal(err)
+	}
+	// The rootfs mounted in the container directory is left out
+	if err := os.MkdirAll(path.Join(dir, "rootfs", "usr"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(dir, "rootfs", "usr", "big"), make([]byte, 4096), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d := &driver{root: root}
+	size, err := d.FsUsage("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 1024 {
+		t.Fatalf("Expected 1024 bytes, got %d", size)
+	}
+
+	// Served from the cache right after
+	if err := ioutil.WriteFile(path.Join(dir, "logs", "json"), make([]byte, 1024), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if size, err = d.FsUsage("1"); err != nil || size != 1024 {
+		t.Fatalf("Expected the cached 1024 bytes, got %d (%v)", size, err)
+	}
+
+	if _, err := d.FsUsage("2"); err == nil {
+		t.Fatal("Expected an error for an unknown container")
+	}
+}
+
+func TestParseState(t *testing.T) {
+	for output, expected := range map[string]execdriver.ContainerState{
+		"state:   RUNNING\n":         execdriver.StateRunning,
+		"State:          FROZEN\n":   execdriver.StateFrozen,
+		"Name: 1\nState: STOPPING\n": execdriver.StateStopping,
+	} {
+		state, err := parseState([]byte(output))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state != expected {
+			t.Errorf("Expected %s from %q, got %s", expected, output, state)
+		}
+	}
+	for _, output := range []string{"", "state: SLEEPING", "pid: 4012"} {
+		if _, err := parseState([]byte(output)); err == nil {
+			t.Errorf("Expected an error parsing %q", output)
+		}
+	}
+}
+
+func TestGetStateRetries(t *testing.T) {
+	bin, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(bin)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+":"+os.Getenv("PATH"))
+
+	// lxc-info fails the first two times it is run
+	failed := path.Join(bin, "failed")
+	script := fmt.Sprintf("#!/bin/sh\nif [ $(cat %s 2>/dev/null | wc -c) -lt 2 ]; then echo -n x >> %s; exit 1; fi\necho 'state:   RUNNING'\n", failed, failed)
+	if err := ioutil.WriteFile(path.Join(bin, "lxc-info"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	d := &driver{infoRetries: 1, infoBackoff: time.Millisecond}
+	if _, err := d.State("1"); err == nil {
+		t.Fatal("Expected an error once the retries are exhausted")
+	}
+	d.infoRetries = 2
+	os.Remove(failed)
+	state, err := d.State("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != execdriver.StateRunning {
+		t.Fatalf("Expected RUNNING, got %s", state)
+	}
+}
+
+func TestLxcLogLevel(t *testing.T) {
+	for level, expected := range map[string]string{"": "", "debug": "DEBUG", "Warn": "WARN", "error": "ERROR"} {
+		name, err := lxcLogLevel(level)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != expected {
+			t.Errorf("Expected %q for %q, got %q", expected, level, name)
+		}
+	}
+	if _, err := lxcLogLevel("trace"); err == nil {
+		t.Fatal("Expected an error with an unsupported log level")
+	}
+}
+
+func TestList(t *testing.T) {
+	root, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	d := &driver{root: root}
+	if ids, err := d.List(); err != nil || len(ids) != 0 {
+		t.Fatalf("Expected no containers, got %v (%v)", ids, err)
+	}
+	for _, id := range []string{"1", "2", "3"} {
+		if err := os.MkdirAll(path.Join(root, "containers", id), 0700); err != nil {
+			t.Fatal(err)
+		}
+		// Without a config the container was never started by the driver
+		if id != "2" {
+			if err := ioutil.WriteFile(path.Join(root, "containers", id, "config.lxc"), nil, 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	ids, err := d.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ids, ",") != "1,3" {
+		t.Fatalf("Expected containers 1 and 3, got %v", ids)
+	}
+}
+
+func TestRunIpcModeHost(t *testing.T) {
+	args := runRecordingArgs(t, &execdriver.Command{
+		InitPath:   "/.dockerinit",
+		Entrypoint: "true",
+		IpcMode:    execdriver.IpcModeHost,
+	})
+	if !strings.Contains(args, " --share-ipc 1 -- /.dockerinit ") {
+		t.Fatalf("Expected lxc-start to share the IPC namespace of the host, got %s", args)
+	}
+}
+
+func TestRunUTSModeHost(t *testing.T) {
+	args := runRecordingArgs(t, &execdriver.Command{
+		InitPath:   "/.dockerinit",
+		Entrypoint: "true",
+		UTSMode:    execdriver.UTSModeHost,
+	})
+	if !strings.Contains(args, " --share-uts 1 -- /.dockerinit ") || !strings.Contains(args, " -host-uts ") {
+		t.Fatalf("Expected lxc-start to share the UTS namespace of the host and dockerinit to keep its hostname, got %s", args)
+	}
+}
+
+func TestIsSharedRoot(t *testing.T) {
+	for _, test := range []struct {
+		mounts []*mount.MountInfo
+		shared bool
+	}{
+		{[]*mount.MountInfo{{Mountpoint: "/proc", Optional: "shared:5"}, {Mountpoint: "/"}}, false},
+		{[]*mount.MountInfo{{Mountpoint: "/", Optional: "master:7 shared:1"}}, true},
+		{[]*mount.MountInfo{{Mountpoint: "/", Optional: "master:7"}}, false},
+		// The rootfs mount is hidden by the real one
+		{[]*mount.MountInfo{{Mountpoint: "/", Optional: "shared:1"}, {Mountpoint: "/", Optional: ""}}, false},
+		{nil, true},
+	} {
+		if shared := isSharedRoot(test.mounts); shared != test.shared {
+			t.Errorf("Expected shared %v for %v, got %v", test.shared, test.mounts, shared)
+		}
+	}
+}
+
+func TestGetPidsForContainerCgroupParent(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	cgroup := path.Join(tmp, "cgroup")
+	if err := os.MkdirAll(path.Join(cgroup, "docker-batch", "1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(cgroup, "docker-batch", "1", "tasks"), []byte("4012\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Started by a previous daemon, the cgroup is read back from the config
+	if err := os.MkdirAll(path.Join(tmp, "containers", "1"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(tmp, "containers", "1", "config.lxc"), []byte("lxc.cgroup.dir = docker-batch/1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	d := &driver{root: tmp, cgroupRoots: map[string]string{"memory": cgroup}}
+	pids, err := d.GetPidsForContainer("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pids) != 1 || pids[0] != 4012 {
+		t.Fatalf("Expected pid 4012 from the cgroup under the parent, got %v", pids)
+	}
+
+	for _, parent := range []string{"/", "..", "../escape"} {
+		if err := validateCgroupParent(parent); err == nil {
+			t.Errorf("Expected an error for the cgroup parent %q", parent)
+		}
+	}
+	if dir := lxcCgroupDir(&execdriver.Command{ID: "2", CgroupParent: "/docker-batch/"}); dir != "docker-batch/2" {
+		t.Fatalf("Expected docker-batch/2, got %s", dir)
+	}
+}
+
+func TestRunLaunchFailed(t *testing.T) {
+	root, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// lxc-start rejecting its config, as it would a bad one
+	bin := path.Join(root, "bin")
+	if err := os.Mkdir(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for tool, script := range map[string]string{
+		"lxc-start": "while [ $# -gt 0 ]; do if [ \"$1\" = -o ]; then echo 'lxc-start ERROR lxc_confile - invalid config' > \"$2\"; fi; shift; done; exit 1",
+		"lxc-info":  "echo 'state:   STOPPED'",
+	} {
+		if err := ioutil.WriteFile(path.Join(bin, tool), []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+":"+os.Getenv("PATH"))
+
+	d, err := NewDriver(root, false, Options{DisableUnshare: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(path.Join(root, "containers", "1"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(path.Join(root, "rootfs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	c := &execdriver.Command{ID: "1", Rootfs: path.Join(root, "rootfs"), InitPath: "/.dockerinit", Entrypoint: "true"}
+	exitCode, err := d.Run(c, execdriver.NewPipes(nil, ioutil.Discard, ioutil.Discard, false), nil)
+	if exitCode != -1 {
+		t.Fatalf("Expected no exit code for the container, got %d", exitCode)
+	}
+	launchErr, ok := err.(*LaunchError)
+	if !ok {
+		t.Fatalf("Expected a launch error, got %v", err)
+	}
+	if launchErr.ExitCode != 1 || !strings.Contains(launchErr.Log, "invalid config") {
+		t.Fatalf("Expected the exit code and the log of lxc-start, got %v", launchErr)
+	}
+}
+
+func TestTerminate(t *testing.T) {
+	root, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	bin := path.Join(root, "bin")
+	if err := os.Mkdir(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(bin, "lxc-stop"), []byte("#!/bin/sh\necho \"$@\" > "+path.Join(root, "args")+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin)
+
+	d := &driver{root: root, cgroupRoots: map[string]string{"memory": path.Join(root, "cgroup")}}
+	dir := path.Join(root, "containers", "1")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Terminate(&execdriver.Command{ID: "1"}, true); err != nil {
+		t.Fatal(err)
+	}
+	output, err := ioutil.ReadFile(path.Join(root, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args := strings.TrimSpace(string(output)); args != "-k -n 1" {
+		t.Fatalf("Expected lxc-stop -k -n 1, got %s", args)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("Expected the directory of the container to be removed: %v", err)
+	}
+	if !d.isKilled("1") {
+		t.Fatal("Expected a terminated container not to be restarted")
+	}
+}
+
+func TestRunStateRestarts(t *testing.T) {
+	root, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// A container seen RUNNING which then exits with 3
+	bin := path.Join(root, "bin")
+	if err := os.Mkdir(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for tool, script := range map[string]string{
+		"lxc-start": "[ \"$1\" = --version ] && exit 1; sleep 0.2; exit 3",
+		"lxc-info":  "echo 'state:   RUNNING'",
+	} {
+		if err := ioutil.WriteFile(path.Join(bin, tool), []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+":"+os.Getenv("PATH"))
+
+	d, err := NewDriver(root, false, Options{DisableUnshare: true, PollInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(path.Join(root, "containers", "1"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(path.Join(root, "rootfs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if state, err := d.GetState("1"); err != nil || state.Restarts != 0 || !state.FinishedAt.IsZero() {
+		t.Fatalf("Expected the zero state before the first run, got %v (%v)", state, err)
+	}
+
+	c := &execdriver.Command{
+		ID:            "1",
+		Rootfs:        path.Join(root, "rootfs"),
+		InitPath:      "/.dockerinit",
+		Entrypoint:    "true",
+		RestartPolicy: execdriver.RestartPolicy{Name: "on-failure", MaximumRetryCount: 2},
+	}
+	exitCode, err := d.Run(c, execdriver.NewPipes(nil, ioutil.Discard, ioutil.Discard, false), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exitCode != 3 {
+		t.Fatalf("Expected exit code 3, got %d", exitCode)
+	}
+
+	// Read back as a new daemon would
+	d, err = NewDriver(root, false, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := d.GetState("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Restarts != 2 || state.LastExitCode != 3 || state.FinishedAt.IsZero() {
+		t.Fatalf("Expected 2 restarts and exit code 3, got %+v", state)
+	}
+}
+
+type cancelContext struct {
+	done chan struct{}
+}
+
+func (c *cancelContext) Done() <-chan struct{} { return c.done }
+
+func (c *cancelContext) Err() error {
+	select {
+	case <-c.done:
+		return fmt.Errorf("canceled")
+	default:
+		return nil
+	}
+}
+
+func TestRunWithContextCanceled(t *testing.T) {
+	root, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// A long running container, RUNNING for as long as lxc-start lives
+	bin := path.Join(root, "bin")
+	if err := os.Mkdir(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	pidFile := path.Join(root, "pid")
+	for tool, script := range map[string]string{
+		"lxc-start": "[ \"$1\" = --version ] && exit 1; echo $$ > " + pidFile + "; exec sleep 30",
+		"lxc-info":  "pid=$(cat " + pidFile + "); if kill -0 $pid 2>/dev/null; then echo 'state:   RUNNING'; echo \"pid:   $pid\"; else echo 'state:   STOPPED'; fi",
+	} {
+		if err := ioutil.WriteFile(path.Join(bin, tool), []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+":"+os.Getenv("PATH"))
+
+	d, err := NewDriver(root, false, Options{DisableUnshare: true, PollInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(path.Join(root, "containers", "1"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(path.Join(root, "rootfs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := &cancelContext{done: make(chan struct{})}
+	c := &execdriver.Command{
+		ID:            "1",
+		Rootfs:        path.Join(root, "rootfs"),
+		InitPath:      "/.dockerinit",
+		Entrypoint:    "true",
+		RestartPolicy: execdriver.RestartPolicy{Name: "always"},
+	}
+	started := func(*execdriver.Command) { close(ctx.done) }
+	errc := make(chan error, 1)
+	go func() {
+		_, err := d.RunWithContext(ctx, c, execdriver.NewPipes(nil, ioutil.Discard, ioutil.Discard, false), started)
+		errc <- err
+	}()
+	select {
+	case err := <-errc:
+		if err == nil || err.Error() != "canceled" {
+			t.Fatalf("Expected the error of the context, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run didn't return once canceled")
+	}
+	if c.ProcessState == nil {
+		t.Fatal("Expected lxc-start to be waited for")
+	}
+}
+
+func TestValidateHugepageLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, size := range []string{"hugepages-64kB", "hugepages-2048kB", "hugepages-1048576kB"} {
+		if err := os.Mkdir(path.Join(dir, size), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		limit execdriver.HugepageLimit
+		valid bool
+	}{
+		{execdriver.HugepageLimit{PageSize: "64KB", Limit: 1 << 20}, true},
+		{execdriver.HugepageLimit{PageSize: "2MB", Limit: 1 << 30}, true},
+		{execdriver.HugepageLimit{PageSize: "1GB", Limit: 1 << 30}, true},
+		{execdriver.HugepageLimit{PageSize: "2MB", Limit: -1}, false},
+		{execdriver.HugepageLimit{PageSize: "16MB", Limit: 1 << 30}, false},
+		{execdriver.HugepageLimit{PageSize: "2048kB"}, false},
+	} {
+		if err := validateHugepageLimits([]execdriver.HugepageLimit{test.limit}, dir); (err == nil) != test.valid {
+			t.Errorf("Unexpected result for hugepage limit %+v: %v", test.limit, err)
+		}
+	}
+	if err := validateHugepageLimits([]execdriver.HugepageLimit{{PageSize: "2MB"}}, path.Join(dir, "missing")); err == nil {
+		t.Error("Expected an error without hugepage support")
+	}
+}
+
+func TestProbe(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// lxc-attach running the probe as its child, after "-n <id> --"
+	if err := ioutil.WriteFile(path.Join(tmp, "lxc-attach"), []byte("#!/bin/sh\nshift 3; \"$@\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", tmp+":"+os.Getenv("PATH"))
+
+	d := &driver{lxcVersion: "1.0.5"}
+	if exitCode, err := d.Probe("1", []string{"sh", "-c", "echo unhealthy; exit 3"}, time.Second); err != nil || exitCode != 3 {
+		t.Fatalf("Expected the probe to exit with 3, got %d (%v)", exitCode, err)
+	}
+	start := time.Now()
+	pidfile := path.Join(tmp, "probe.pid")
+	_, err = d.Probe("1", []string{"sh", "-c", "echo $$ > " + pidfile + "; exec sleep 10"}, 200*time.Millisecond)
+	if _, ok := err.(*ProbeTimeoutError); !ok {
+		t.Fatalf("Expected a probe timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Expected the hung probe to be killed, it took %s", elapsed)
+	}
+	content, err := ioutil.ReadFile(pidfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; ; i++ {
+		// Once killed it is left as a zombie until reaped
+		stat, err := ioutil.ReadFile(path.Join("/proc", strconv.Itoa(pid), "stat"))
+		if err != nil || strings.Contains(string(stat), ") Z ") {
+			break
+		}
+		if i == 50 {
+			t.Fatalf("Expected the probe %d to be killed along with lxc-attach", pid)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if _, err := d.Probe("1", nil, time.Second); err == nil {
+		t.Fatal("Expected an error without a command")
+	}
+}
+
+func TestValidateRootfs(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := ioutil.WriteFile(path.Join(tmp, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateRootfs(tmp); err != nil {
+		t.Fatal(err)
+	}
+	for _, rootfs := range []string{"", path.Join(tmp, "missing"), path.Join(tmp, "file")} {
+		if err := validateRootfs(rootfs); err == nil {
+			t.Errorf("Expected an error for the rootfs %q", rootfs)
+		}
+	}
+}
+
+func TestWaitStopped(t *testing.T) {
+	bin, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(bin)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+":"+os.Getenv("PATH"))
+
+	// STOPPING for the first three calls of lxc-info
+	calls := path.Join(bin, "calls")
+	script := fmt.Sprintf("#!/bin/sh\necho -n x >> %s\nif [ $(wc -c < %s) -le 3 ]; then echo 'state:   STOPPING'; else echo 'state:   STOPPED'; fi\n", calls, calls)
+	if err := ioutil.WriteFile(path.Join(bin, "lxc-info"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	d := &driver{infoRetries: 1, infoBackoff: time.Millisecond, pollInterval: time.Millisecond}
+	if info := d.Info("1"); info.IsRunning() {
+		t.Fatal("Expected a STOPPING container not to be running")
+	}
+	if err := d.WaitStopped("1", 0); err != execdriver.ErrWaitTimeoutReached {
+		t.Fatalf("Expected the wait to time out while STOPPING, got %v", err)
+	}
+	if err := d.WaitStopped("1", time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPinnedToolPaths(t *testing.T) {
+	root, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// Versioned tools out of PATH
+	startPath, infoPath, attachPath := path.Join(root, "lxc-start-1.0"), path.Join(root, "lxc-info-1.0"), path.Join(root, "lxc-attach-1.0")
+	if err := ioutil.WriteFile(startPath, []byte("#!/bin/sh\necho 1.0.7\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(attachPath, []byte("#!/bin/sh\nexit 0\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Older tools left in PATH
+	bin := path.Join(root, "bin")
+	if err := os.Mkdir(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(bin, "lxc-version"), []byte("#!/bin/sh\necho 'lxc version: 0.9.0'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+":"+os.Getenv("PATH"))
+	if err := ioutil.WriteFile(infoPath, []byte("#!/bin/sh\necho 'State: FROZEN'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewDriver(root, false, Options{LxcInfoPath: path.Join(root, "missing")}); err == nil {
+		t.Fatal("Expected an error for a missing lxc-info")
+	}
+	d, err := NewDriver(root, false, Options{LxcStartPath: startPath, LxcInfoPath: infoPath, LxcAttachPath: attachPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target, err := os.Readlink(path.Join(root, "lxc-start-unconfined")); err != nil || target != startPath {
+		t.Fatalf("Expected lxc-start-unconfined to link to %s, got %s (%v)", startPath, target, err)
+	}
+	if state, err := d.State("1"); err != nil || state != execdriver.StateFrozen {
+		t.Fatalf("Expected the state from the pinned lxc-info, got %s (%v)", state, err)
+	}
+	if tool := d.tool("lxc-kill"); tool != "lxc-kill" {
+		t.Fatalf("Expected lxc-kill to be looked up in PATH, got %s", tool)
+	}
+	if version := d.version(); version != "1.0.7" {
+		t.Fatalf("Expected the version of the pinned lxc-start, got %q", version)
+	}
+	if cmd, err := d.attachCommand("1", []string{"true"}); err != nil || cmd.Path != attachPath {
+		t.Fatalf("Expected the pinned lxc-attach to run the command, got %v (%v)", cmd, err)
+	}
+}
+
+func TestStrictCgroups(t *testing.T) {
+	root, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	defer func(required []struct{ name, missing string }) {
+		requiredCgroupSubsystems = required
+	}(requiredCgroupSubsystems)
+	requiredCgroupSubsystems = []struct{ name, missing string }{{"nonexistent", "nothing works"}}
+
+	d, err := NewDriver(root, false, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	warnings, err := d.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "nonexistent") {
+		t.Fatalf("Expected a warning about the missing subsystem, got %v", warnings)
+	}
+	if _, err := NewDriver(root, false, Options{StrictCgroups: true}); err == nil || !strings.Contains(err.Error(), "nothing works") {
+		t.Fatalf("Expected the missing subsystem to fail a strict driver, got %v", err)
+	}
+}
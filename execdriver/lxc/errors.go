@@ -0,0 +1,62 @@
+package lxc
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrLxcStartNotFound = errors.New("lxc-start not found, make sure lxc is installed and in your PATH")
+)
+
+// ConfigError is returned when the lxc config of a container
+// can't be generated
+type ConfigError struct {
+	ID  string
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("Unable to generate the lxc config of %s: %s", e.ID, e.Err)
+}
+
+// LaunchError is returned when lxc-start exits non-zero before the
+// container was seen RUNNING. ExitCode is the one of lxc-start, not of the
+// process of the container.
+type LaunchError struct {
+	ID       string
+	ExitCode int
+	Log      string // last lines lxc-start logged
+}
+
+func (e *LaunchError) Error() string {
+	if e.Log == "" {
+		return fmt.Sprintf("lxc-start exited with %d before %s was running", e.ExitCode, e.ID)
+	}
+	return fmt.Sprintf("lxc-start exited with %d before %s was running: %s", e.ExitCode, e.ID, e.Log)
+}
+
+// ProbeTimeoutError is returned when a probe is still running once its
+// timeout elapsed, as opposed to failing to run at all
+type ProbeTimeoutError struct {
+	ID      string
+	Timeout time.Duration
+}
+
+func (e *ProbeTimeoutError) Error() string {
+	return fmt.Sprintf("Probe of %s timed out after %s", e.ID, e.Timeout)
+}
+
+// KillError is returned when the lxc tools fail to deliver
+// a signal to the container
+type KillError struct {
+	ID     string
+	Signal int
+	Err    error
+	Output []byte
+}
+
+func (e *KillError) Error() string {
+	return fmt.Sprintf("Unable to send signal %d to %s: Err: %s Output: %s", e.Signal, e.ID, e.Err, e.Output)
+}
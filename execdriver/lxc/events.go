@@ -0,0 +1,214 @@
+package lxc
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/dotcloud/docker/execdriver"
+	"github.com/dotcloud/docker/utils"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How many events a subscriber may lag behind before they are dropped
+const eventsBuffer = 64
+
+// eventPoller watches one container for all the subscribers to its events
+type eventPoller struct {
+	subscribers map[int]chan execdriver.StateEvent
+	next        int
+	stop        chan struct{}
+}
+
+// What the poller last saw of a container
+type eventsSnapshot struct {
+	state    execdriver.ContainerState
+	underOom bool
+	oomKills int64
+}
+
+// Events subscribes to the state changes of the container id, e.g. RUNNING,
+// STOPPING then STOPPED, and to it hitting its memory limit. The container
+// is polled once for all its subscribers until the last one cancels. The
+// returned func cancels the subscription and closes the channel, a
+// subscriber not keeping up misses events.
+func (d *driver) Events(id string) (<-chan execdriver.StateEvent, func(), error) {
+	// State retries lxc-info, the initial state of a new poller is read
+	// without holding up the events of every other container
+	var (
+		p     *eventPoller
+		last  *eventsSnapshot
+		found bool
+	)
+	for {
+		d.eventsLock.Lock()
+		if p, found = d.pollers[id]; found || last != nil {
+			break
+		}
+		d.eventsLock.Unlock()
+
+		state, err := d.State(id)
+		if err != nil {
+			return nil, nil, err
+		}
+		snapshot := d.oomSnapshot(id)
+		snapshot.state = state
+		last = &snapshot
+	}
+	defer d.eventsLock.Unlock()
+
+	if !found {
+		p = &eventPoller{subscribers: make(map[int]chan execdriver.StateEvent), stop: make(chan struct{})}
+		if d.pollers == nil {
+			d.pollers = make(map[string]*eventPoller)
+		}
+		d.pollers[id] = p
+		go d.pollEvents(id, p, *last)
+	}
+	events := make(chan execdriver.StateEvent, eventsBuffer)
+	n := p.next
+	p.next++
+	p.subscribers[n] = events
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			d.eventsLock.Lock()
+			defer d.eventsLock.Unlock()
+			delete(p.subscribers, n)
+			close(events)
+			if len(p.subscribers) == 0 {
+				close(p.stop)
+				delete(d.pollers, id)
+			}
+		})
+	}
+	return events, cancel, nil
+}
+
+func (d *driver) pollEvents(id string, p *eventPoller, last eventsSnapshot) {
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-time.After(d.pollInterval):
+		}
+		current := d.oomSnapshot(id)
+		state, err := d.State(id)
+		if err != nil {
+			utils.Debugf("Unable to poll the state of %s: %s", id, err)
+			state = last.state
+		}
+		current.state = state
+
+		if (current.underOom && !last.underOom) || current.oomKills > last.oomKills {
+			d.publishEvent(p, execdriver.StateEvent{ID: id, OOM: true, Time: time.Now()})
+		}
+		if current.state != last.state {
+			d.publishEvent(p, execdriver.StateEvent{ID: id, State: current.state, Time: time.Now()})
+		}
+		last = current
+	}
+}
+
+func (d *driver) publishEvent(p *eventPoller, event execdriver.StateEvent) {
+	d.eventsLock.Lock()
+	defer d.eventsLock.Unlock()
+	for _, events := range p.subscribers {
+		select {
+		case events <- event:
+		default:
+			utils.Debugf("Dropped the event %+v of a subscriber not keeping up", event)
+		}
+	}
+}
+
+// The OOM state of the container, zero when it has no memory cgroup
+func (d *driver) oomSnapshot(id string) eventsSnapshot {
+	var snapshot eventsSnapshot
+	dir, err := d.findCgroupDir("memory", id)
+	if err != nil {
+		return snapshot
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "memory.oom_control"))
+	if err != nil {
+		return snapshot
+	}
+	snapshot.underOom, snapshot.oomKills = parseOomControl(data)
+	return snapshot
+}
+
+// Parse memory.oom_control, oom_kill is only reported by kernels 4.13+
+func parseOomControl(data []byte) (underOom bool, oomKills int64) {
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "under_oom":
+			underOom = value != 0
+		case "oom_kill":
+			oomKills = value
+		}
+	}
+	return underOom, oomKills
+}
+
+// How long to wait for the memory cgroup of an exited container to go
+const oomWatchGrace = time.Second
+
+// Watch the memory cgroup of the running container id for OOMs, the
+// returned func reports whether there was one once the container exited.
+// The cgroup may be removed before an OOM counter is read again, the
+// notifications are what catch the OOM killing the main process.
+func (d *driver) watchOOM(id string) func() bool {
+	before := d.oomSnapshot(id)
+	dir, err := d.findCgroupDir("memory", id)
+	if err != nil {
+		return func() bool { return false }
+	}
+	notifications, err := notifyOOM(dir)
+	if err != nil {
+		utils.Debugf("Unable to watch %s for OOMs: %s", id, err)
+		return func() bool {
+			after := d.oomSnapshot(id)
+			return after.oomKills > before.oomKills || after.underOom
+		}
+	}
+
+	var (
+		lock     sync.Mutex
+		notified bool
+		removed  = make(chan struct{})
+	)
+	go func() {
+		for _ = range notifications {
+			lock.Lock()
+			notified = true
+			lock.Unlock()
+		}
+		close(removed)
+	}()
+	return func() bool {
+		after := d.oomSnapshot(id)
+		if after.oomKills > before.oomKills || after.underOom {
+			return true
+		}
+		select {
+		case <-removed:
+		case <-time.After(oomWatchGrace):
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		return notified
+	}
+}
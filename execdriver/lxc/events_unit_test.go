@@ -0,0 +1,131 @@
+package lxc
+
+import (
+	"github.com/dotcloud/docker/execdriver"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", tmp+":"+os.Getenv("PATH"))
+
+	state := path.Join(tmp, "state")
+	setState := func(s string) {
+		if err := ioutil.WriteFile(state, []byte("State: "+s+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setState("RUNNING")
+	if err := ioutil.WriteFile(path.Join(tmp, "lxc-info"), []byte("#!/bin/sh\ncat "+state+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	memory := path.Join(tmp, "memory")
+	if err := os.MkdirAll(path.Join(memory, "1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	oomControl := path.Join(memory, "1", "memory.oom_control")
+	if err := ioutil.WriteFile(oomControl, []byte("oom_kill_disable 0\nunder_oom 0\noom_kill 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d := &driver{root: tmp, pollInterval: 10 * time.Millisecond, cgroupRoots: map[string]string{"memory": memory}}
+
+	first, cancelFirst, err := d.Events("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, cancelSecond, err := d.Events("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.pollers) != 1 {
+		t.Fatalf("Expected a single poller for the subscribers, got %d", len(d.pollers))
+	}
+	next := func(events <-chan execdriver.StateEvent) execdriver.StateEvent {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for an event")
+		}
+		return execdriver.StateEvent{}
+	}
+
+	if err := ioutil.WriteFile(oomControl, []byte("oom_kill_disable 0\nunder_oom 0\noom_kill 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, events := range []<-chan execdriver.StateEvent{first, second} {
+		if event := next(events); !event.OOM || event.ID != "1" {
+			t.Fatalf("Expected an OOM event, got %+v", event)
+		}
+	}
+
+	cancelFirst()
+	if _, ok := <-first; ok {
+		t.Fatal("Expected the channel of a canceled subscription to be closed")
+	}
+	for _, s := range []execdriver.ContainerState{execdriver.StateStopping, execdriver.StateStopped} {
+		setState(s.String())
+		if event := next(second); event.State != s {
+			t.Fatalf("Expected %s, got %+v", s, event)
+		}
+	}
+
+	cancelSecond()
+	cancelSecond()
+	if len(d.pollers) != 0 {
+		t.Fatal("Expected the poller to stop with its last subscriber")
+	}
+}
+
+func TestParseOomControl(t *testing.T) {
+	underOom, kills := parseOomControl([]byte("oom_kill_disable 1\nunder_oom 1\noom_kill 3\n"))
+	if !underOom || kills != 3 {
+		t.Fatalf("Expected under_oom and 3 kills, got %v and %d", underOom, kills)
+	}
+	if underOom, kills = parseOomControl([]byte("oom_kill_disable 0\nunder_oom 0\n")); underOom || kills != 0 {
+		t.Fatalf("Expected no OOM, got %v and %d", underOom, kills)
+	}
+}
+
+func TestWatchOOM(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	memory := path.Join(tmp, "memory")
+	if err := os.MkdirAll(path.Join(memory, "1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	oomControl := path.Join(memory, "1", "memory.oom_control")
+	if err := ioutil.WriteFile(oomControl, []byte("oom_kill_disable 0\nunder_oom 0\noom_kill 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d := &driver{root: tmp, cgroupRoots: map[string]string{"memory": memory}}
+
+	oomKilled := d.watchOOM("1")
+	if err := ioutil.WriteFile(oomControl, []byte("oom_kill_disable 0\nunder_oom 0\noom_kill 3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !oomKilled() {
+		t.Fatal("Expected the OOM kill counted while running to be reported")
+	}
+	if err := os.MkdirAll(path.Join(tmp, "containers", "1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.saveRunState("1", &execdriver.RunState{LastExitCode: 137, OOMKilled: true}); err != nil {
+		t.Fatal(err)
+	}
+	if oom, err := d.WasOOMKilled("1"); err != nil || !oom {
+		t.Fatalf("Expected the saved OOM kill, got %v (%v)", oom, err)
+	}
+}
@@ -0,0 +1,66 @@
+package lxc
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Run the hook of the container id on the host, pid is the one of its init
+// or 0 when it isn't running. The hook is killed along with the processes it
+// started when it takes longer than d.hookTimeout.
+func (d *driver) runHook(name string, hook []string, id string, pid int) error {
+	if len(hook) == 0 {
+		return nil
+	}
+	// A file rather than a pipe, Wait would also wait for a daemon the hook
+	// started in a session of its own, out of reach of the kill, to close it
+	output, err := ioutil.TempFile("", "docker-hook-")
+	if err != nil {
+		return fmt.Errorf("Unable to run the %s hook of %s: %s", name, id, err)
+	}
+	defer output.Close()
+	os.Remove(output.Name())
+
+	cmd := exec.Command(hook[0], hook[1:]...)
+	cmd.Env = append(os.Environ(), "DOCKER_CONTAINER_ID="+id)
+	if pid > 0 {
+		cmd.Env = append(cmd.Env, "DOCKER_CONTAINER_PID="+strconv.Itoa(pid))
+	}
+	cmd.Stdout, cmd.Stderr = output, output
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("Unable to run the %s hook of %s: %s", name, id, err)
+	}
+	waitErr := make(chan error, 1)
+	go func() {
+		waitErr <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-waitErr:
+		if err != nil {
+			output.Seek(0, 0)
+			logged, _ := ioutil.ReadAll(output)
+			return fmt.Errorf("The %s hook of %s failed: %s (%s)", name, id, err, bytes.TrimSpace(logged))
+		}
+		return nil
+	case <-time.After(d.hookTimeout):
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-waitErr
+		return fmt.Errorf("The %s hook of %s timed out after %s", name, id, d.hookTimeout)
+	}
+}
+
+// Run a hook whose failure doesn't change the outcome of the container
+func (d *driver) runHookLogged(name string, hook []string, id string, pid int) {
+	if err := d.runHook(name, hook, id, pid); err != nil {
+		log.Printf("WARNING: %s", err)
+	}
+}
@@ -0,0 +1,61 @@
+package lxc
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunHook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	d := &driver{hookTimeout: time.Second}
+
+	env := path.Join(dir, "env")
+	if err := d.runHook("PostStart", []string{"sh", "-c", "echo $DOCKER_CONTAINER_ID $DOCKER_CONTAINER_PID > " + env}, "1", 42); err != nil {
+		t.Fatal(err)
+	}
+	output, err := ioutil.ReadFile(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := strings.TrimSpace(string(output)); s != "1 42" {
+		t.Fatalf("Expected the id and pid of the container in the environment of the hook, got %q", s)
+	}
+
+	if err := d.runHook("PreStart", nil, "1", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.runHook("PreStart", []string{"sh", "-c", "echo no; exit 1"}, "1", 0); err == nil || !strings.Contains(err.Error(), "no") {
+		t.Fatalf("Expected the failure of the hook with its output, got %v", err)
+	}
+
+	// The hook is killed with the children holding its output
+	d.hookTimeout = 100 * time.Millisecond
+	start := time.Now()
+	if err := d.runHook("PreStop", []string{"sh", "-c", "sleep 10 & sleep 10"}, "1", 0); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("Expected the hook to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Expected the hook to be killed at its timeout, it took %s", elapsed)
+	}
+
+	// A daemon holding the output of the hook doesn't block it
+	if _, err := exec.LookPath("setsid"); err != nil {
+		t.Skip("setsid is required to start a daemon from the hook")
+	}
+	start = time.Now()
+	if err := d.runHook("PreStop", []string{"sh", "-c", "setsid sleep 10 & sleep 10"}, "1", 0); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("Expected the hook to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Expected the hook to return at its timeout despite its daemon, it took %s", elapsed)
+	}
+}
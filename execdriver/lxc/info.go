@@ -0,0 +1,67 @@
+package lxc
+
+import (
+	"fmt"
+	"github.com/dotcloud/docker/execdriver"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	defaultInfoRetries = 3
+	defaultInfoBackoff = 10 * time.Millisecond
+	maxInfoBackoff     = time.Second
+)
+
+// Parse the output of lxc-info -s, "State: RUNNING" with lxc 1.0 and
+// "state:   RUNNING" with older versions
+func parseState(output []byte) (execdriver.ContainerState, error) {
+	for _, line := range strings.Split(string(output), "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || strings.ToLower(strings.TrimSpace(parts[0])) != "state" {
+			continue
+		}
+		return execdriver.ParseContainerState(strings.TrimSpace(parts[1]))
+	}
+	return execdriver.StateUnknown, fmt.Errorf("No state found in lxc-info output %q", strings.TrimSpace(string(output)))
+}
+
+// State returns the state of the container as reported by lxc-info, which
+// is retried with an exponential backoff when it fails. A container lxc
+// does not know about is STOPPED.
+func (d *driver) State(id string) (execdriver.ContainerState, error) {
+	var (
+		backoff = d.infoBackoff
+		err     error
+	)
+	for attempt := 0; ; attempt++ {
+		var output []byte
+		output, err = exec.Command(d.tool("lxc-info"), "-s", "-n", id).CombinedOutput()
+		if err != nil && isUnknownContainer(output) {
+			return execdriver.StateStopped, nil
+		}
+		if err == nil {
+			var state execdriver.ContainerState
+			if state, err = parseState(output); err == nil {
+				return state, nil
+			}
+		} else {
+			err = fmt.Errorf("%s (%s)", err, strings.TrimSpace(string(output)))
+		}
+		if attempt >= d.infoRetries {
+			break
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxInfoBackoff {
+			backoff = maxInfoBackoff
+		}
+	}
+	return execdriver.StateUnknown, fmt.Errorf("Error getting info for lxc container %s: %s", id, err)
+}
+
+// lxc 1.0 refuses to report on a container which is not defined
+// in its lxcpath nor running, older versions just say STOPPED
+func isUnknownContainer(output []byte) bool {
+	return strings.Contains(string(output), "doesn't exist") || strings.Contains(string(output), "does not exist")
+}
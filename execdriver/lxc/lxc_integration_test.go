@@ -0,0 +1,151 @@
+package lxc_test
+
+import (
+	"bytes"
+	"github.com/dotcloud/docker/execdriver"
+	"github.com/dotcloud/docker/execdriver/lxc"
+	"github.com/dotcloud/docker/sysinit"
+	"github.com/dotcloud/docker/utils"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+// These tests start containers with the lxc tools of the host, the test
+// binary standing for dockerinit in them
+
+func init() {
+	// Hack to run sys init during unit testing
+	if selfPath := utils.SelfPath(); selfPath == "/.dockerinit" {
+		sysinit.SysInit()
+	}
+}
+
+type testContainers struct {
+	driver execdriver.Driver
+	root   string
+	mounts []execdriver.Mount // the binaries of the host and dockerinit
+}
+
+// Returns a driver along with the mounts making a rootfs out of the
+// binaries of the host, skips the test without root or lxc
+func newTestContainers(t *testing.T) *testContainers {
+	if os.Getuid() != 0 {
+		t.Skip("Starting containers requires root")
+	}
+	root, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := lxc.NewDriver(root, false, lxc.Options{})
+	if err != nil {
+		os.RemoveAll(root)
+		t.Skipf("Unable to create the lxc driver: %s", err)
+	}
+	if d.Name() == lxc.DriverName+"-" {
+		os.RemoveAll(root)
+		t.Skip("lxc is not installed")
+	}
+
+	containers := &testContainers{driver: d, root: root}
+	for _, dir := range []string{"/bin", "/sbin", "/lib", "/lib64", "/usr"} {
+		if _, err := os.Stat(dir); err == nil {
+			containers.mounts = append(containers.mounts, execdriver.Mount{Source: dir, Destination: dir})
+		}
+	}
+	containers.mounts = append(containers.mounts, execdriver.Mount{Source: utils.SelfPath(), Destination: "/.dockerinit"})
+	return containers
+}
+
+func (tc *testContainers) cleanup() {
+	os.RemoveAll(tc.root)
+}
+
+// Returns a command running script in a new rootfs of its own
+func (tc *testContainers) command(t *testing.T, id, script string) *execdriver.Command {
+	rootfs := path.Join(tc.root, id)
+	for _, dir := range []string{"proc", "sys", "dev/pts", "dev/shm", "etc", "tmp", "run"} {
+		if err := os.MkdirAll(path.Join(rootfs, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(path.Join(tc.root, "containers", id), 0700); err != nil {
+		t.Fatal(err)
+	}
+	return &execdriver.Command{
+		ID:         id,
+		Rootfs:     rootfs,
+		InitPath:   "/.dockerinit",
+		Entrypoint: "/bin/sh",
+		Arguments:  []string{"-c", script},
+		Mounts:     append([]execdriver.Mount(nil), tc.mounts...),
+	}
+}
+
+func (tc *testContainers) run(t *testing.T, c *execdriver.Command) (string, int) {
+	var output bytes.Buffer
+	exitCode, err := tc.driver.Run(c, execdriver.NewPipes(nil, &output, &output, false), nil)
+	if err != nil {
+		t.Fatalf("Unable to run %s: %s (%s)", c.ID, err, output.String())
+	}
+	return output.String(), exitCode
+}
+
+func TestRunReadonlyRootfs(t *testing.T) {
+	tc := newTestContainers(t)
+	defer tc.cleanup()
+
+	volume := path.Join(tc.root, "volume")
+	if err := os.Mkdir(volume, 0755); err != nil {
+		t.Fatal(err)
+	}
+	c := tc.command(t, "docker-test-readonly", "touch /probe; echo written > /data/file && echo volume written")
+	c.ReadonlyRootfs = true
+	c.Mounts = append(c.Mounts, execdriver.Mount{Source: volume, Destination: "/data", Writable: true})
+
+	output, _ := tc.run(t, c)
+	if !strings.Contains(output, "Read-only file system") {
+		t.Errorf("Expected writing to / to fail with EROFS, got %q", output)
+	}
+	if _, err := os.Stat(path.Join(c.Rootfs, "probe")); err == nil {
+		t.Error("Expected nothing to be written to the rootfs")
+	}
+	if !strings.Contains(output, "volume written") {
+		t.Errorf("Expected the volume to stay writable, got %q", output)
+	}
+	if content, err := ioutil.ReadFile(path.Join(volume, "file")); err != nil || string(content) != "written\n" {
+		t.Errorf("Expected the file written to the volume, got %q (%v)", content, err)
+	}
+}
+
+func TestRunIpcContainerShm(t *testing.T) {
+	tc := newTestContainers(t)
+	defer tc.cleanup()
+
+	a := tc.command(t, "docker-test-ipc-a", "touch /dev/shm/marker; sleep 30")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tc.driver.Run(a, execdriver.NewPipes(nil, ioutil.Discard, ioutil.Discard, false), nil)
+	}()
+	defer func() {
+		tc.driver.Kill(a, 9)
+		<-done
+	}()
+	for i := 0; !tc.driver.Info(a.ID).IsRunning(); i++ {
+		if i == 100 {
+			t.Fatalf("Container %s did not start", a.ID)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// The segment of the first container shows up in the second one
+	b := tc.command(t, "docker-test-ipc-b", "for i in 1 2 3 4 5 6 7 8 9 10; do [ -e /dev/shm/marker ] && echo found && exit 0; sleep 1; done; echo missing")
+	b.IpcMode = "container:" + a.ID
+	if output, _ := tc.run(t, b); !strings.Contains(output, "found") {
+		t.Fatalf("Expected the /dev/shm of %s to be shared, got %q", a.ID, output)
+	}
+}
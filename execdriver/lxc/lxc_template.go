@@ -7,20 +7,52 @@ import (
 )
 
 const LxcTemplate = `
-{{if .Network}}
+{{if .HostNetworking}}
+# share the network of the host
+lxc.network.type = none
+{{else}}
+{{with $interfaces := .Interfaces}}
 # network configuration
+{{range $i, $network := $interfaces}}
 lxc.network.type = veth
-lxc.network.link = {{.Network.Bridge}}
-lxc.network.name = eth0
+lxc.network.link = {{$network.Bridge}}
+lxc.network.name = eth{{$i}}
+{{if $network.VethName}}
+lxc.network.veth.pair = {{$network.VethName}}
+{{end}}
+{{if $network.MacAddress}}
+lxc.network.hwaddr = {{$network.MacAddress}}
+{{end}}
+{{if eq $network.Gateway "auto"}}
+lxc.network.mtu = {{$network.Mtu}}
+lxc.network.ipv4 = {{$network.IPAddress}}/{{$network.IPPrefixLen}}
+lxc.network.ipv4.gateway = auto
+{{end}}
+{{end}}
+{{else}}
+{{if .JoinsNetNs}}
+# network namespace joined by dockerinit
 {{else}}
 # network is disabled (-n=false)
+{{end}}
 lxc.network.type = empty
 lxc.network.flags = up
 {{end}}
+{{end}}
 
 # root filesystem
 {{$ROOTFS := .Rootfs}}
 lxc.rootfs = {{$ROOTFS}}
+{{if .ReadonlyRootfs}}
+lxc.rootfs.options = ro
+{{end}}
+
+{{range $value := .UidMappings}}
+lxc.id_map = u {{$value.ContainerID}} {{$value.HostID}} {{$value.Size}}
+{{end}}
+{{range $value := .GidMappings}}
+lxc.id_map = g {{$value.ContainerID}} {{$value.HostID}} {{$value.Size}}
+{{end}}
 
 # use a dedicated pts for the container (and limit the number of pseudo terminal
 # available)
@@ -32,7 +64,12 @@ lxc.console = none
 # no controlling tty at all
 lxc.tty = 1
 
-{{if .Privileged}}
+{{if .LxcAutodev}}
+# minimal /dev populated by lxc instead of the one of the rootfs
+lxc.autodev = 1
+{{end}}
+
+{{if and .Privileged (not .AllowedDevices)}}
 lxc.cgroup.devices.allow = a
 {{else}}
 # no implicit access to devices
@@ -64,6 +101,10 @@ lxc.cgroup.devices.allow = c 10:200 rwm
 
 # rtc
 #lxc.cgroup.devices.allow = c 254:0 rwm
+
+{{range $dev := .AllowedDevices}}
+lxc.cgroup.devices.allow = {{$dev.CgroupString}}
+{{end}}
 {{end}}
 
 # standard mount point
@@ -81,32 +122,128 @@ lxc.mount.entry = proc {{escapeFstabSpaces $ROOTFS}}/proc proc nosuid,nodev,noex
 lxc.mount.entry = sysfs {{escapeFstabSpaces $ROOTFS}}/sys sysfs nosuid,nodev,noexec 0 0
 
 {{if .Tty}}
-lxc.mount.entry = {{.Console}} {{escapeFstabSpaces $ROOTFS}}/dev/console none bind,rw 0 0
+lxc.mount.entry = {{.Console}} {{escapeFstabSpaces $ROOTFS}}/dev/console none bind,rw{{if .LxcAutodev}},create=file{{end}} 0 0
 {{end}}
 
-lxc.mount.entry = devpts {{escapeFstabSpaces $ROOTFS}}/dev/pts devpts newinstance,ptmxmode=0666,nosuid,noexec 0 0
-lxc.mount.entry = shm {{escapeFstabSpaces $ROOTFS}}/dev/shm tmpfs size=65536k,nosuid,nodev,noexec 0 0
+lxc.mount.entry = devpts {{escapeFstabSpaces $ROOTFS}}/dev/pts devpts newinstance,ptmxmode=0666,nosuid,noexec{{if .LxcAutodev}},create=dir{{end}} 0 0
+{{if .ShmSource}}
+lxc.mount.entry = {{escapeFstabSpaces .ShmSource}} {{escapeFstabSpaces $ROOTFS}}/dev/shm none bind{{if .LxcAutodev}},create=dir{{end}} 0 0
+{{else}}
+lxc.mount.entry = shm {{escapeFstabSpaces $ROOTFS}}/dev/shm tmpfs {{shmSizeOption .ShmSize}},nosuid,nodev,noexec{{if .LxcAutodev}},create=dir{{end}} 0 0
+{{end}}
+
+{{range $value := .Mounts}}
+lxc.mount.entry = {{escapeFstabSpaces $value.Source}} {{escapeFstabSpaces (index $.MountTargets $value.Destination)}} none bind,{{if $value.Writable}}rw{{else}}ro{{end}},{{$value.Propagation}} 0 0
+{{end}}
+
+{{range $dev := .AllowedDevices}}
+lxc.mount.entry = {{escapeFstabSpaces $dev.Path}} {{escapeFstabSpaces (index $.MountTargets $dev.Path)}} none bind{{if $.LxcAutodev}},create=file{{end}} 0 0
+{{end}}
+
+{{range $dest, $options := .Tmpfs}}
+lxc.mount.entry = tmpfs {{escapeFstabSpaces (index $.MountTargets $dest)}} tmpfs {{tmpfsOptions $options}} 0 0
+{{end}}
+
+{{if .ResolvConf}}
+# resolv.conf generated for the custom dns settings
+lxc.mount.entry = {{escapeFstabSpaces .ResolvConf}} {{escapeFstabSpaces $ROOTFS}}/etc/resolv.conf none bind,ro 0 0
+{{end}}
+
+{{if .ReadonlyRootfs}}
+# keep the usual scratch directories writable on top of the read-only rootfs
+{{range $dir := readonlyRootfsScratchDirs}}
+lxc.mount.entry = tmpfs {{escapeFstabSpaces $ROOTFS}}{{$dir}} tmpfs rw,nosuid,nodev,mode=1777 0 0
+{{end}}
+{{end}}
 
-{{if .Privileged}}
+{{if .AppArmorProfile}}
+{{if .AppArmor}}
+lxc.aa_profile = {{.AppArmorProfile}}
+{{else}}
+lxc.aa_profile = unconfined
+{{end}}
+{{else}}
+{{if .DisableAppArmor}}
 {{if .AppArmor}}
 lxc.aa_profile = unconfined
 {{else}}
 #lxc.aa_profile = unconfined
 {{end}}
 {{end}}
+{{end}}
+
+# capabilities lxc can take away, dockerinit drops the rest once it set up the container
+{{if .LxcCapKeep}}
+lxc.cap.keep = {{join .LxcCapKeep " "}}
+{{end}}
+{{if .LxcCapDrop}}
+lxc.cap.drop = {{join .LxcCapDrop " "}}
+{{end}}
+
+{{if .StartAuto}}
+lxc.start.auto = 1
+{{end}}
+{{if .StartOrder}}
+lxc.start.order = {{.StartOrder}}
+{{end}}
+
+{{if .CgroupDir}}
+# cgroup under the CgroupParent
+lxc.cgroup.dir = {{.CgroupDir}}
+{{end}}
 
 # limits
 {{if .Resources}}
 {{if .Resources.Memory}}
 lxc.cgroup.memory.limit_in_bytes = {{.Resources.Memory}}
-lxc.cgroup.memory.soft_limit_in_bytes = {{.Resources.Memory}}
 {{with $memSwap := getMemorySwap .Resources}}
 lxc.cgroup.memory.memsw.limit_in_bytes = {{$memSwap}}
 {{end}}
+{{if .Resources.OomKillDisable}}
+lxc.cgroup.memory.oom_control = 1
 {{end}}
+{{end}}
+{{if .Resources.MemoryReservation}}
+lxc.cgroup.memory.soft_limit_in_bytes = {{.Resources.MemoryReservation}}
+{{else}}{{if .Resources.Memory}}
+lxc.cgroup.memory.soft_limit_in_bytes = {{.Resources.Memory}}
+{{end}}{{end}}
 {{if .Resources.CpuShares}}
 lxc.cgroup.cpu.shares = {{.Resources.CpuShares}}
 {{end}}
+{{if .Resources.CpuPeriod}}
+lxc.cgroup.cpu.cfs_period_us = {{.Resources.CpuPeriod}}
+{{end}}
+{{if .Resources.CpuQuota}}
+lxc.cgroup.cpu.cfs_quota_us = {{.Resources.CpuQuota}}
+{{end}}
+{{if .Resources.CpusetCpus}}
+lxc.cgroup.cpuset.cpus = {{.Resources.CpusetCpus}}
+{{end}}
+{{if .Resources.CpusetMems}}
+lxc.cgroup.cpuset.mems = {{.Resources.CpusetMems}}
+{{end}}
+{{if .Resources.BlkioWeight}}
+lxc.cgroup.blkio.weight = {{.Resources.BlkioWeight}}
+{{end}}
+{{range $t := .Resources.BlkioDeviceReadBps}}
+lxc.cgroup.blkio.throttle.read_bps_device = {{$t.CgroupString}}
+{{end}}
+{{range $t := .Resources.BlkioDeviceWriteBps}}
+lxc.cgroup.blkio.throttle.write_bps_device = {{$t.CgroupString}}
+{{end}}
+{{if gt .Resources.PidsLimit 0}}
+lxc.cgroup.pids.max = {{.Resources.PidsLimit}}
+{{end}}
+{{end}}
+{{with .MemorySwappiness}}
+lxc.cgroup.memory.swappiness = {{.}}
+{{end}}
+{{if .KernelMemory}}
+lxc.cgroup.memory.kmem.limit_in_bytes = {{.KernelMemory}}
+{{end}}
+{{range $h := .HugepageLimits}}
+lxc.cgroup.hugetlb.{{$h.PageSize}}.limit_in_bytes = {{$h.Limit}}
 {{end}}
 
 {{if .Config}}
@@ -114,22 +251,67 @@ lxc.cgroup.cpu.shares = {{.Resources.CpuShares}}
 {{$value}}
 {{end}}
 {{end}}
+
+{{range $pair := .LxcConf}}
+{{$pair.Key}} = {{$pair.Value}}
+{{end}}
 `
 
 var LxcTemplateCompiled *template.Template
 
+// Keys of the config the driver sets itself, matched as prefixes,
+// which can't be overridden through Command.LxcConf. The cgroup
+// subsystems are the ones Resources and AllowedDevices model, the
+// others can still be tuned. lxc.mount.entry only adds mounts and
+// lxc.console is left for logging the console to a file.
+var managedLxcKeys = []string{
+	"lxc.rootfs",
+	"lxc.network.",
+	"lxc.id_map",
+	"lxc.aa_profile",
+	"lxc.pivotdir",
+	"lxc.cap.",
+	"lxc.autodev",
+	"lxc.cgroup.dir",
+	"lxc.cgroup.memory.",
+	"lxc.cgroup.cpu.",
+	"lxc.cgroup.cpuset.",
+	"lxc.cgroup.blkio.",
+	"lxc.cgroup.pids.",
+	"lxc.cgroup.hugetlb.",
+	"lxc.cgroup.devices.",
+	"lxc.tty",
+	"lxc.pts",
+	"lxc.start.auto",
+	"lxc.start.order",
+}
+
+// Directories mounted as tmpfs when the rootfs is read-only
+var readonlyRootfsScratchDirs = []string{"/tmp", "/run"}
+
 // Escape spaces in strings according to the fstab documentation, which is the
 // format for "lxc.mount.entry" lines in lxc.conf. See also "man 5 fstab".
 func escapeFstabSpaces(field string) string {
 	return strings.Replace(field, " ", "\\040", -1)
 }
 
+// Mount options of a tmpfs, defaulting to a non executable scratch space
+func tmpfsOptions(options string) string {
+	if options == "" {
+		return "rw,noexec,nosuid"
+	}
+	return options
+}
+
 func getMemorySwap(v *execdriver.Resources) int64 {
 	// By default, MemorySwap is set to twice the size of RAM.
 	// If you want to omit MemorySwap, set it to `-1'.
 	if v.MemorySwap < 0 {
 		return 0
 	}
+	if v.MemorySwap > 0 {
+		return v.MemorySwap
+	}
 	return v.Memory * 2
 }
 
@@ -138,6 +320,12 @@ func init() {
 	funcMap := template.FuncMap{
 		"getMemorySwap":     getMemorySwap,
 		"escapeFstabSpaces": escapeFstabSpaces,
+		"tmpfsOptions":      tmpfsOptions,
+		"shmSizeOption":     execdriver.ShmSizeOption,
+		"join":              strings.Join,
+		"readonlyRootfsScratchDirs": func() []string {
+			return readonlyRootfsScratchDirs
+		},
 	}
 	LxcTemplateCompiled, err = template.New("lxc").Funcs(funcMap).Parse(LxcTemplate)
 	if err != nil {
@@ -33,7 +33,7 @@ func TestLXCConfig(t *testing.T) {
 		cpu    = cpuMin + rand.Intn(cpuMax-cpuMin)
 	)
 
-	driver, err := NewDriver(root, false)
+	driver, err := NewDriver(root, false, Options{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -44,10 +44,7 @@ func TestLXCConfig(t *testing.T) {
 			CpuShares: int64(cpu),
 		},
 	}
-	p, err := driver.generateLXCConfig(command)
-	if err != nil {
-		t.Fatal(err)
-	}
+	p := newTestConfig(t, driver, command)
 	grepFile(t, p,
 		fmt.Sprintf("lxc.cgroup.memory.limit_in_bytes = %d", mem))
 
@@ -55,19 +52,140 @@ func TestLXCConfig(t *testing.T) {
 		fmt.Sprintf("lxc.cgroup.memory.memsw.limit_in_bytes = %d", mem*2))
 }
 
-func TestCustomLxcConfig(t *testing.T) {
-	root, err := ioutil.TempDir("", "TestCustomLxcConfig")
-	if err != nil {
+func TestLXCConfigMemorySwap(t *testing.T) {
+	driver := newTestDriver(t, false)
+	defer os.RemoveAll(driver.root)
+	command := &execdriver.Command{
+		ID: "1",
+		Resources: &execdriver.Resources{
+			Memory:     33554432,
+			MemorySwap: 67108864,
+		},
+	}
+	p := newTestConfig(t, driver, command)
+	grepFile(t, p, "lxc.cgroup.memory.memsw.limit_in_bytes = 67108864")
+
+	command.Resources.MemorySwap = -1
+	p = newTestConfig(t, driver, command)
+	grepFileNot(t, p, "lxc.cgroup.memory.memsw.limit_in_bytes")
+}
+
+func TestValidateResourcesMemorySwap(t *testing.T) {
+	if err := validateResources(&execdriver.Resources{MemorySwap: 67108864}); err == nil {
+		t.Fatal("Expected an error for a swap limit without a memory limit")
+	}
+	if err := validateResources(&execdriver.Resources{MemorySwap: -1}); err != nil {
 		t.Fatal(err)
 	}
-	defer os.RemoveAll(root)
+	if err := validateResources(&execdriver.Resources{Memory: 33554432, MemorySwap: 67108864}); err != nil {
+		t.Fatal(err)
+	}
+}
 
-	os.MkdirAll(path.Join(root, "containers", "1"), 0777)
+func TestLXCConfigMemoryReservation(t *testing.T) {
+	driver := newTestDriver(t, false)
+	defer os.RemoveAll(driver.root)
+	command := &execdriver.Command{
+		ID: "1",
+		Resources: &execdriver.Resources{
+			Memory:            67108864,
+			MemoryReservation: 33554432,
+		},
+	}
+	p := newTestConfig(t, driver, command)
+	grepFile(t, p, "lxc.cgroup.memory.limit_in_bytes = 67108864")
+	grepFile(t, p, "lxc.cgroup.memory.soft_limit_in_bytes = 33554432")
 
-	driver, err := NewDriver(root, false)
-	if err != nil {
+	// Without a reservation the soft limit is the memory limit, as before
+	command.Resources.MemoryReservation = 0
+	p = newTestConfig(t, driver, command)
+	grepFile(t, p, "lxc.cgroup.memory.soft_limit_in_bytes = 67108864")
+
+	command.Resources.Memory = 0
+	p = newTestConfig(t, driver, command)
+	grepFileNot(t, p, "lxc.cgroup.memory.soft_limit_in_bytes")
+}
+
+func TestValidateResourcesMemoryReservation(t *testing.T) {
+	if err := validateResources(&execdriver.Resources{Memory: 33554432, MemoryReservation: 67108864}); err == nil {
+		t.Fatal("Expected an error for a reservation above the memory limit")
+	}
+	if err := validateResources(&execdriver.Resources{Memory: 33554432, MemoryReservation: 33554432}); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateResources(&execdriver.Resources{MemoryReservation: 33554432}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLXCConfigBlkioWeight(t *testing.T) {
+	driver := newTestDriver(t, false)
+	defer os.RemoveAll(driver.root)
+	command := &execdriver.Command{
+		ID:        "1",
+		Resources: &execdriver.Resources{BlkioWeight: 500},
+	}
+	p := newTestConfig(t, driver, command)
+	grepFile(t, p, "lxc.cgroup.blkio.weight = 500")
+
+	command.Resources.BlkioWeight = 0
+	p = newTestConfig(t, driver, command)
+	grepFileNot(t, p, "lxc.cgroup.blkio.weight")
+}
+
+func TestLXCConfigCpuQuota(t *testing.T) {
+	driver := newTestDriver(t, false)
+	defer os.RemoveAll(driver.root)
+	// Half a core
+	command := &execdriver.Command{
+		ID: "1",
+		Resources: &execdriver.Resources{
+			CpuPeriod: 100000,
+			CpuQuota:  50000,
+		},
+	}
+	if err := validateResources(command.Resources); err != nil {
 		t.Fatal(err)
 	}
+	p := newTestConfig(t, driver, command)
+	grepFile(t, p, "lxc.cgroup.cpu.cfs_period_us = 100000")
+	grepFile(t, p, "lxc.cgroup.cpu.cfs_quota_us = 50000")
+
+	for _, r := range []*execdriver.Resources{
+		{CpuPeriod: 999},
+		{CpuPeriod: 1000001},
+		{CpuPeriod: 100000, CpuQuota: -1},
+	} {
+		if err := validateResources(r); err == nil {
+			t.Errorf("Expected an error for cpu period %d and quota %d", r.CpuPeriod, r.CpuQuota)
+		}
+	}
+}
+
+func TestLXCConfigOomKillDisable(t *testing.T) {
+	driver := newTestDriver(t, false)
+	defer os.RemoveAll(driver.root)
+	command := &execdriver.Command{
+		ID: "1",
+		Resources: &execdriver.Resources{
+			Memory: 33554432,
+		},
+	}
+	p := newTestConfig(t, driver, command)
+	grepFileNot(t, p, "lxc.cgroup.memory.oom_control")
+
+	command.Resources.OomKillDisable = true
+	p = newTestConfig(t, driver, command)
+	grepFile(t, p, "lxc.cgroup.memory.oom_control = 1")
+
+	if err := validateResources(&execdriver.Resources{OomKillDisable: true}); err == nil {
+		t.Fatal("Expected an error when disabling the OOM killer without a memory limit")
+	}
+}
+
+func TestCustomLxcConfig(t *testing.T) {
+	driver := newTestDriver(t, false)
+	defer os.RemoveAll(driver.root)
 	command := &execdriver.Command{
 		ID:         "1",
 		Privileged: false,
@@ -77,10 +195,7 @@ func TestCustomLxcConfig(t *testing.T) {
 		},
 	}
 
-	p, err := driver.generateLXCConfig(command)
-	if err != nil {
-		t.Fatal(err)
-	}
+	p := newTestConfig(t, driver, command)
 
 	grepFile(t, p, "lxc.utsname = docker")
 	grepFile(t, p, "lxc.cgroup.cpuset.cpus = 0,1")
@@ -106,6 +221,46 @@ func grepFile(t *testing.T, path string, pattern string) {
 	t.Fatalf("grepFile: pattern \"%s\" not found in \"%s\"", pattern, path)
 }
 
+func grepFileNot(t *testing.T, path string, pattern string) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), pattern) {
+		t.Fatalf("grepFileNot: pattern \"%s\" unexpectedly found in \"%s\"", pattern, path)
+	}
+}
+
+// Returns a driver in a temporary root holding the directory of
+// container 1, the caller removes the root
+func newTestDriver(t *testing.T, apparmor bool) *driver {
+	root, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(path.Join(root, "containers", "1"), 0777)
+
+	d, err := NewDriver(root, apparmor, Options{})
+	if err != nil {
+		os.RemoveAll(root)
+		t.Fatal(err)
+	}
+	return d
+}
+
+// Writes the config of c and returns its path
+func newTestConfig(t *testing.T, d *driver, c *execdriver.Command) string {
+	mountTargets, err := resolveMounts(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := d.generateLXCConfig(c, 0, mountTargets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
 func TestEscapeFstabSpaces(t *testing.T) {
 	var testInputs = map[string]string{
 		" ":                      "\\040",
@@ -123,3 +278,691 @@ func TestEscapeFstabSpaces(t *testing.T) {
 		}
 	}
 }
+
+func TestLXCConfigCpuset(t *testing.T) {
+	driver := newTestDriver(t, false)
+	defer os.RemoveAll(driver.root)
+	command := &execdriver.Command{
+		ID: "1",
+		Resources: &execdriver.Resources{
+			CpusetCpus: "0-2,7",
+		},
+	}
+	p := newTestConfig(t, driver, command)
+	grepFile(t, p, "lxc.cgroup.cpuset.cpus = 0-2,7")
+	grepFileNot(t, p, "lxc.cgroup.cpuset.mems")
+
+	command.Resources.CpusetMems = "0,1"
+	p = newTestConfig(t, driver, command)
+	grepFile(t, p, "lxc.cgroup.cpuset.mems = 0,1")
+}
+
+func TestLXCConfigReadonlyRootfs(t *testing.T) {
+	driver := newTestDriver(t, false)
+	defer os.RemoveAll(driver.root)
+	command := &execdriver.Command{
+		ID:     "1",
+		Rootfs: "/rootfs",
+	}
+	p := newTestConfig(t, driver, command)
+	grepFileNot(t, p, "lxc.rootfs.options")
+
+	command.ReadonlyRootfs = true
+	p = newTestConfig(t, driver, command)
+	grepFile(t, p, "lxc.rootfs.options = ro")
+	grepFile(t, p, "lxc.mount.entry = tmpfs /rootfs/tmp tmpfs rw,nosuid,nodev,mode=1777 0 0")
+	grepFile(t, p, "lxc.mount.entry = tmpfs /rootfs/run tmpfs rw,nosuid,nodev,mode=1777 0 0")
+}
+
+func TestLXCConfigPidsLimit(t *testing.T) {
+	driver := newTestDriver(t, false)
+	defer os.RemoveAll(driver.root)
+	command := &execdriver.Command{
+		ID: "1",
+		Resources: &execdriver.Resources{
+			PidsLimit: 512,
+		},
+	}
+	p := newTestConfig(t, driver, command)
+	grepFile(t, p, "lxc.cgroup.pids.max = 512")
+
+	command.Resources.PidsLimit = -1
+	p = newTestConfig(t, driver, command)
+	grepFileNot(t, p, "lxc.cgroup.pids.max")
+}
+
+func TestLXCConfigMounts(t *testing.T) {
+	driver := newTestDriver(t, false)
+	defer os.RemoveAll(driver.root)
+	command := &execdriver.Command{
+		ID:     "1",
+		Rootfs: "/rootfs",
+		Mounts: []execdriver.Mount{
+			{Source: "/etc/app", Destination: "/etc/app"},
+			{Source: "/srv/my data", Destination: "/data", Writable: true},
+		},
+	}
+	p := newTestConfig(t, driver, command)
+	grepFile(t, p, "lxc.mount.entry = /etc/app /rootfs/etc/app none bind,ro,rprivate 0 0")
+	grepFile(t, p, "lxc.mount.entry = /srv/my\\040data /rootfs/data none bind,rw,rprivate 0 0")
+
+	command.Mounts[1].MountPropagation = "rshared"
+	p = newTestConfig(t, driver, command)
+	grepFile(t, p, "lxc.mount.entry = /srv/my\\040data /rootfs/data none bind,rw,rshared 0 0")
+
+	command.Mounts[1].MountPropagation = "bogus"
+	if _, err := driver.RenderConfig(command); err == nil {
+		t.Fatal("Expected an error rendering an invalid mount propagation")
+	}
+	if _, err := driver.generateLXCConfig(command, 0, nil); err == nil {
+		t.Fatal("Expected an error writing an invalid mount propagation")
+	}
+}
+
+func TestLXCConfigTmpfs(t *testing.T) {
+	driver := newTestDriver(t, false)
+	defer os.RemoveAll(driver.root)
+	command := &execdriver.Command{
+		ID:     "1",
+		Rootfs: "/rootfs",
+		Tmpfs: map[string]string{
+			"/tmp":     "rw,size=64m",
+			"/scratch": "",
+		},
+	}
+	p := newTestConfig(t, driver, command)
+	grepFile(t, p, "lxc.mount.entry = tmpfs /rootfs/tmp tmpfs rw,size=64m 0 0")
+	grepFile(t, p, "lxc.mount.entry = tmpfs /rootfs/scratch tmpfs rw,noexec,nosuid 0 0")
+}
+
+func TestLXCConfigMountsSymlink(t *testing.T) {
+	driver := newTestDriver(t, false)
+	defer os.RemoveAll(driver.root)
+
+	var (
+		rootfs = path.Join(driver.root, "rootfs")
+		host   = path.Join(driver.root, "host")
+		hosts  = path.Join(driver.root, "hosts")
+	)
+	os.MkdirAll(rootfs, 0755)
+	os.MkdirAll(host, 0755)
+	if err := ioutil.WriteFile(hosts, []byte("127.0.0.1 localhost\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Symlinks of the image pointing at a directory of the host
+	if err := os.Symlink(host, path.Join(rootfs, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(host, path.Join(rootfs, "etc")); err != nil {
+		t.Fatal(err)
+	}
+	command := &execdriver.Command{
+		ID:     "1",
+		Rootfs: rootfs,
+		Mounts: []execdriver.Mount{
+			{Source: driver.root, Destination: "/escape/created"},
+			{Source: hosts, Destination: "/etc/hosts"},
+		},
+		Tmpfs: map[string]string{"/escape/tmp": ""},
+	}
+	mountTargets, err := setupMounts(command)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := driver.generateLXCConfig(command, 0, mountTargets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The entries mount on the mountpoints created in the rootfs
+	grepFile(t, p, "lxc.mount.entry = "+driver.root+" "+path.Join(rootfs, host, "created")+" none bind,ro,rprivate 0 0")
+	grepFile(t, p, "lxc.mount.entry = "+hosts+" "+path.Join(rootfs, host, "hosts")+" none bind,ro,rprivate 0 0")
+	grepFile(t, p, "lxc.mount.entry = tmpfs "+path.Join(rootfs, host, "tmp")+" tmpfs ")
+	grepFileNot(t, p, path.Join(rootfs, "escape"))
+	grepFileNot(t, p, path.Join(rootfs, "etc", "hosts"))
+	if _, err := os.Stat(path.Join(rootfs, host, "hosts")); err != nil {
+		t.Fatalf("Expected the rendered mountpoint to be the created one: %v", err)
+	}
+}
+
+func TestLXCConfigError(t *testing.T) {
+	root, err := ioutil.TempDir("", "TestLXCConfigError")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	driver, err := NewDriver(root, false, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The container directory does not exist
+	_, err = driver.generateLXCConfig(&execdriver.Command{ID: "1"}, 0, nil)
+	if _, ok := err.(*ConfigError); !ok {
+		t.Fatalf("Expected a *ConfigError, got %#v", err)
+	}
+}
+
+func TestRenderConfig(t *testing.T) {
+	root, err := ioutil.TempDir("", "TestRenderConfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	driver, err := NewDriver(root, false, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	command := &execdriver.Command{
+		ID:        "1",
+		Network:   &execdriver.Network{Bridge: "docker0"},
+		Resources: &execdriver.Resources{Memory: 33554432},
+	}
+	rendered, err := driver.RenderConfig(command)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Nothing is written to the container directory
+	if _, err := os.Stat(path.Join(root, "containers", "1")); !os.IsNotExist(err) {
+		t.Fatalf("Expected no container directory, got %v", err)
+	}
+
+	os.MkdirAll(path.Join(root, "containers", "1"), 0777)
+	p := newTestConfig(t, driver, command)
+	written, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != string(rendered) {
+		t.Fatalf("Expected the rendered config to match the written one:\n%s\n---\n%s", rendered, written)
+	}
+}
+
+func TestLXCConfigAtomicWrite(t *testing.T) {
+	driver := newTestDriver(t, false)
+	defer os.RemoveAll(driver.root)
+	command := &execdriver.Command{ID: "1", Resources: &execdriver.Resources{Memory: 33554432}}
+	p := newTestConfig(t, driver, command)
+	if _, err := os.Stat(p + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("Expected the temporary config to be renamed, got %v", err)
+	}
+
+	// A failed write leaves the previous config untouched
+	if err := os.Mkdir(p+".tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+	command.Resources.Memory = 67108864
+	if _, err := driver.generateLXCConfig(command, 0, nil); err == nil {
+		t.Fatal("Expected an error writing the config")
+	}
+	grepFile(t, p, "lxc.cgroup.memory.limit_in_bytes = 33554432")
+}
+
+func TestLXCConfigIDMappings(t *testing.T) {
+	driver := newTestDriver(t, false)
+	defer os.RemoveAll(driver.root)
+	command := &execdriver.Command{
+		ID:          "1",
+		UidMappings: []execdriver.IDMap{{ContainerID: 0, HostID: 100000, Size: 65536}},
+		GidMappings: []execdriver.IDMap{{ContainerID: 0, HostID: 200000, Size: 65536}},
+	}
+	p := newTestConfig(t, driver, command)
+	grepFile(t, p, "lxc.id_map = u 0 100000 65536")
+	grepFile(t, p, "lxc.id_map = g 0 200000 65536")
+}
+
+func TestLXCConfigHostNetworking(t *testing.T) {
+	driver := newTestDriver(t, false)
+	defer os.RemoveAll(driver.root)
+	command := &execdriver.Command{
+		ID:             "1",
+		Network:        &execdriver.Network{Bridge: "docker0"},
+		HostNetworking: true,
+	}
+	p := newTestConfig(t, driver, command)
+	grepFile(t, p, "lxc.network.type = none")
+	grepFileNot(t, p, "lxc.network.link")
+}
+
+func TestLXCConfigMacAddress(t *testing.T) {
+	driver := newTestDriver(t, false)
+	defer os.RemoveAll(driver.root)
+	command := &execdriver.Command{
+		ID:      "1",
+		Network: &execdriver.Network{Bridge: "docker0"},
+	}
+	p := newTestConfig(t, driver, command)
+	grepFileNot(t, p, "lxc.network.hwaddr")
+
+	command.Network.MacAddress = "02:42:ac:11:00:02"
+	if err := validateNetwork(command.Network); err != nil {
+		t.Fatal(err)
+	}
+	p = newTestConfig(t, driver, command)
+	grepFile(t, p, "lxc.network.hwaddr = 02:42:ac:11:00:02")
+
+	command.Network.MacAddress = "02:42:ac:11:00"
+	if err := validateNetwork(command.Network); err == nil {
+		t.Fatal("Expected an error for an invalid mac address")
+	}
+}
+
+func TestLXCConfigVethName(t *testing.T) {
+	driver := newTestDriver(t, false)
+	defer os.RemoveAll(driver.root)
+	command := &execdriver.Command{
+		ID:      "1",
+		Network: &execdriver.Network{Bridge: "docker0"},
+	}
+	p := newTestConfig(t, driver, command)
+	grepFileNot(t, p, "lxc.network.veth.pair")
+
+	command.Network.VethName = "veth4f2a9c1"
+	if err := validateNetwork(command.Network); err != nil {
+		t.Fatal(err)
+	}
+	p = newTestConfig(t, driver, command)
+	grepFile(t, p, "lxc.network.veth.pair = veth4f2a9c1")
+
+	command.Network.VethName = "veth4f2a9c1e8b7d6"
+	if err := validateNetwork(command.Network); err == nil {
+		t.Fatal("Expected an error for a veth name longer than IFNAMSIZ")
+	}
+}
+
+func TestLXCConfigMultipleNetworks(t *testing.T) {
+	driver := newTestDriver(t, false)
+	defer os.RemoveAll(driver.root)
+	command := &execdriver.Command{
+		ID:       "1",
+		Network:  &execdriver.Network{Bridge: "docker0"},
+		Networks: []*execdriver.Network{{Bridge: "data0"}},
+	}
+	p := newTestConfig(t, driver, command)
+	grepFile(t, p, "lxc.network.link = docker0")
+	grepFile(t, p, "lxc.network.name = eth0")
+	grepFile(t, p, "lxc.network.link = data0")
+	grepFile(t, p, "lxc.network.name = eth1")
+}
+
+func TestLXCConfigAppArmorProfile(t *testing.T) {
+	driver := newTestDriver(t, true)
+	defer os.RemoveAll(driver.root)
+	command := &execdriver.Command{
+		ID:              "1",
+		Privileged:      true,
+		AppArmorProfile: "docker-nginx",
+	}
+	p := newTestConfig(t, driver, command)
+	grepFile(t, p, "lxc.aa_profile = docker-nginx")
+	grepFileNot(t, p, "lxc.aa_profile = unconfined")
+
+	driver.apparmor = false
+	p = newTestConfig(t, driver, command)
+	grepFile(t, p, "lxc.aa_profile = unconfined")
+}
+
+func TestValidateAppArmorProfile(t *testing.T) {
+	root, err := ioutil.TempDir("", "TestValidateAppArmorProfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	if err := ioutil.WriteFile(path.Join(root, "docker-nginx"), []byte("profile docker-nginx {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded := path.Join(root, "profiles")
+	if err := ioutil.WriteFile(loaded, []byte("docker-default (enforce)\n/usr/sbin/ntpd (enforce)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for name, valid := range map[string]bool{
+		"docker-nginx":   true,
+		"docker-default": true,
+		"docker-missing": false,
+		"../profiles":    false,
+	} {
+		if err := validateAppArmorProfile(name, root, loaded); (err == nil) != valid {
+			t.Errorf("Unexpected result for profile %q: %v", name, err)
+		}
+	}
+}
+
+func TestLXCConfigAllowedDevices(t *testing.T) {
+	driver := newTestDriver(t, false)
+	defer os.RemoveAll(driver.root)
+	command := &execdriver.Command{
+		ID:         "1",
+		Privileged: true,
+		Rootfs:     path.Join(driver.root, "rootfs"),
+		AllowedDevices: []execdriver.DeviceEntry{
+			{Path: "/dev/null", Type: 'c', Major: 1, Minor: 3, Permissions: "rw"},
+		},
+	}
+	mountTargets, err := setupMounts(command)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(path.Join(command.Rootfs, "dev", "null")); err != nil || !fi.Mode().IsRegular() {
+		t.Fatalf("Expected the mountpoint of the device to be created: %v", err)
+	}
+	p, err := driver.generateLXCConfig(command, 0, mountTargets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grepFile(t, p, "lxc.cgroup.devices.deny = a")
+	grepFileNot(t, p, "lxc.cgroup.devices.allow = a")
+	grepFile(t, p, "lxc.cgroup.devices.allow = c 1:3 rw")
+	// Bind mounted as mknod is not permitted in a user namespace
+	grepFile(t, p, "lxc.mount.entry = /dev/null "+command.Rootfs+"/dev/null none bind 0 0")
+}
+
+func TestLxcConf(t *testing.T) {
+	driver := newTestDriver(t, false)
+	defer os.RemoveAll(driver.root)
+	command := &execdriver.Command{
+		ID: "1",
+		LxcConf: []execdriver.KeyValuePair{
+			{Key: "lxc.kmsg", Value: "0"},
+			{Key: "lxc.console", Value: "/var/log/console.log"},
+		},
+	}
+	if err := validateLxcConf(command.LxcConf); err != nil {
+		t.Fatal(err)
+	}
+	config, err := driver.RenderConfig(command)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"lxc.kmsg = 0", "lxc.console = /var/log/console.log"} {
+		if !strings.Contains(string(config), "\n"+line+"\n") {
+			t.Fatalf("Expected %q in the config, got:\n%s", line, config)
+		}
+	}
+	// lxc keeps the last value, the raw lines must come last
+	if strings.LastIndex(string(config), "lxc.console = none") > strings.Index(string(config), "lxc.console = /var/log/console.log") {
+		t.Fatal("Expected the raw lines after the generated ones")
+	}
+}
+
+func TestValidateLxcConfConflicts(t *testing.T) {
+	err := validateLxcConf([]execdriver.KeyValuePair{
+		{Key: "lxc.rootfs", Value: "/"},
+		{Key: "lxc.kmsg", Value: "0"},
+		{Key: "lxc.network.type", Value: "empty"},
+	})
+	if err == nil {
+		t.Fatal("Expected an error overriding managed keys")
+	}
+	for _, key := range []string{"lxc.rootfs", "lxc.network.type"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Fatalf("Expected %s in the error, got %s", key, err)
+		}
+	}
+	if strings.Contains(err.Error(), "lxc.kmsg") {
+		t.Fatalf("Expected lxc.kmsg to be allowed, got %s", err)
+	}
+
+	// Limits set from Resources and AllowedDevices
+	for _, key := range []string{
+		"lxc.cgroup.memory.limit_in_bytes",
+		"lxc.cgroup.cpu.shares",
+		"lxc.cgroup.cpuset.cpus",
+		"lxc.cgroup.devices.allow",
+		"lxc.tty",
+		"lxc.pts",
+	} {
+		if err := validateLxcConf([]execdriver.KeyValuePair{{Key: key, Value: "a"}}); err == nil {
+			t.Errorf("Expected an error overriding %s", key)
+		}
+	}
+	// Neither modeled nor set by the driver
+	for _, key := range []string{"lxc.cgroup.net_cls.classid", "lxc.cgroup.cpuacct.usage", "lxc.mount.entry", "lxc.console"} {
+		if err := validateLxcConf([]execdriver.KeyValuePair{{Key: key, Value: "1"}}); err != nil {
+			t.Errorf("Expected %s to be allowed, got %s", key, err)
+		}
+	}
+
+	if err := validateLxcConf([]execdriver.KeyValuePair{{Key: "kmsg", Value: "0"}}); err == nil {
+		t.Fatal("Expected an error for a key outside of lxc.*")
+	}
+
+	for _, pair := range []execdriver.KeyValuePair{
+		{Key: "lxc.kmsg", Value: "0\nlxc.rootfs = /"},
+		{Key: "lxc.kmsg", Value: "0\rlxc.rootfs = /"},
+		{Key: "lxc.kmsg = 0\nlxc.rootfs", Value: "/"},
+	} {
+		if err := validateLxcConf([]execdriver.KeyValuePair{pair}); err == nil {
+			t.Errorf("Expected an error injecting a line with %q = %q", pair.Key, pair.Value)
+		}
+	}
+}
+
+func TestLXCConfigDisableAppArmor(t *testing.T) {
+	driver := newTestDriver(t, true)
+	defer os.RemoveAll(driver.root)
+
+	// Privileged containers stay confined unless asked otherwise
+	config, err := driver.RenderConfig(&execdriver.Command{ID: "1", Privileged: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(config), "lxc.aa_profile") {
+		t.Fatalf("Expected the default AppArmor profile, got:\n%s", config)
+	}
+
+	for _, privileged := range []bool{true, false} {
+		config, err := driver.RenderConfig(&execdriver.Command{ID: "1", Privileged: privileged, DisableAppArmor: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(config), "\nlxc.aa_profile = unconfined\n") {
+			t.Fatalf("Expected privileged=%t to run unconfined, got:\n%s", privileged, config)
+		}
+	}
+}
+
+func TestLXCConfigBlkioThrottle(t *testing.T) {
+	if _, err := os.Stat("/dev/loop0"); err != nil {
+		t.Skip("/dev/loop0 is not available")
+	}
+	driver := newTestDriver(t, false)
+	defer os.RemoveAll(driver.root)
+	config, err := driver.RenderConfig(&execdriver.Command{
+		ID: "1",
+		Resources: &execdriver.Resources{
+			BlkioDeviceReadBps:  []execdriver.ThrottleDevice{{Path: "/dev/loop0", Rate: "1m"}},
+			BlkioDeviceWriteBps: []execdriver.ThrottleDevice{{Path: "/dev/loop0", Rate: "512k"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"lxc.cgroup.blkio.throttle.read_bps_device = 7:0 1048576",
+		"lxc.cgroup.blkio.throttle.write_bps_device = 7:0 524288",
+	} {
+		if !strings.Contains(string(config), "\n"+line+"\n") {
+			t.Fatalf("Expected %q in the config, got:\n%s", line, config)
+		}
+	}
+}
+
+func TestLXCConfigCapabilities(t *testing.T) {
+	driver := newTestDriver(t, false)
+	defer os.RemoveAll(driver.root)
+	command := &execdriver.Command{ID: "1"}
+	render := func(version string) string {
+		driver.lxcVersion = version
+		config, err := driver.RenderConfig(command)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(config)
+	}
+
+	if config := render("0.9.0"); !strings.Contains(config, "\nlxc.cap.drop = ") || strings.Contains(config, "lxc.cap.keep") {
+		t.Fatalf("Expected a drop list with lxc 0.9.0, got:\n%s", config)
+	}
+	if config := render("1.0.5"); !strings.Contains(config, "\nlxc.cap.keep = ") || strings.Contains(config, "lxc.cap.drop") {
+		t.Fatalf("Expected a keep list with lxc 1.0.5, got:\n%s", config)
+	}
+
+	// Privileged containers keep everything
+	command.Privileged = true
+	if config := render("1.0.5"); strings.Contains(config, "lxc.cap.") {
+		t.Fatalf("Expected no capability setting for a privileged container, got:\n%s", config)
+	}
+}
+
+func TestLXCConfigAutoGateway(t *testing.T) {
+	driver := newTestDriver(t, false)
+	defer os.RemoveAll(driver.root)
+	command := &execdriver.Command{
+		ID: "1",
+		Network: &execdriver.Network{
+			Gateway:     execdriver.AutoGateway,
+			IPAddress:   "172.17.0.2",
+			IPPrefixLen: 16,
+			Bridge:      "docker0",
+			Mtu:         1500,
+		},
+	}
+	p := newTestConfig(t, driver, command)
+	grepFile(t, p, "lxc.network.ipv4 = 172.17.0.2/16")
+	grepFile(t, p, "lxc.network.ipv4.gateway = auto")
+	grepFile(t, p, "lxc.network.mtu = 1500")
+
+	command.Network.Gateway = "172.17.42.1"
+	p = newTestConfig(t, driver, command)
+	grepFileNot(t, p, "lxc.network.ipv4")
+}
+
+func TestLXCConfigIpcModeHost(t *testing.T) {
+	driver := newTestDriver(t, false)
+	defer os.RemoveAll(driver.root)
+	command := &execdriver.Command{
+		ID:      "1",
+		Rootfs:  "/rootfs",
+		IpcMode: execdriver.IpcModeHost,
+	}
+	p := newTestConfig(t, driver, command)
+	// Segments created in the /dev/shm of the host are visible
+	grepFile(t, p, "lxc.mount.entry = /dev/shm /rootfs/dev/shm none bind 0 0")
+
+	command.IpcMode = "container:"
+	if err := execdriver.ValidateIpcMode(command.IpcMode); err == nil {
+		t.Fatal("Expected an error without the id of the container")
+	}
+}
+
+func TestLXCConfigAutoDev(t *testing.T) {
+	driver := newTestDriver(t, false)
+	defer os.RemoveAll(driver.root)
+	command := &execdriver.Command{ID: "1", Rootfs: "/rootfs", AutoDev: true}
+	render := func(version string) string {
+		driver.lxcVersion = version
+		config, err := driver.RenderConfig(command)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(config)
+	}
+
+	config := render("1.0.5")
+	if !strings.Contains(config, "\nlxc.autodev = 1\n") {
+		t.Fatalf("Expected lxc.autodev with lxc 1.0.5, got:\n%s", config)
+	}
+	// The tmpfs lxc mounts on /dev starts empty
+	if !strings.Contains(config, "/rootfs/dev/shm tmpfs size=65536k,nosuid,nodev,noexec,create=dir 0 0") {
+		t.Fatalf("Expected the /dev/shm mountpoint to be created, got:\n%s", config)
+	}
+	if config := render("0.9.0"); strings.Contains(config, "lxc.autodev") || strings.Contains(config, "create=") {
+		t.Fatalf("Expected the /dev of the rootfs with lxc 0.9.0, got:\n%s", config)
+	}
+}
+
+func TestLXCConfigHugepageLimits(t *testing.T) {
+	driver := newTestDriver(t, false)
+	defer os.RemoveAll(driver.root)
+	command := &execdriver.Command{
+		ID:             "1",
+		HugepageLimits: []execdriver.HugepageLimit{{PageSize: "2MB", Limit: 1 << 30}},
+	}
+	p := newTestConfig(t, driver, command)
+	grepFile(t, p, "lxc.cgroup.hugetlb.2MB.limit_in_bytes = 1073741824")
+}
+
+func TestLXCConfigStartAuto(t *testing.T) {
+	driver := newTestDriver(t, false)
+	defer os.RemoveAll(driver.root)
+	command := &execdriver.Command{ID: "1"}
+	p := newTestConfig(t, driver, command)
+	grepFileNot(t, p, "lxc.start.")
+
+	command.StartAuto = true
+	command.StartOrder = 20
+	p = newTestConfig(t, driver, command)
+	grepFile(t, p, "lxc.start.auto = 1")
+	grepFile(t, p, "lxc.start.order = 20")
+}
+
+func TestLXCConfigGenerateAppArmor(t *testing.T) {
+	driver := newTestDriver(t, true)
+	defer os.RemoveAll(driver.root)
+	command := &execdriver.Command{ID: "1", GenerateAppArmor: true}
+	p := newTestConfig(t, driver, command)
+	grepFile(t, p, "lxc.aa_profile = docker-1")
+	if name := driver.configValue("1", "lxc.aa_profile"); name != "docker-1" {
+		t.Fatalf("Expected the generated profile to be read back, got %q", name)
+	}
+}
+
+func TestLXCConfigMemorySwappiness(t *testing.T) {
+	driver := newTestDriver(t, false)
+	defer os.RemoveAll(driver.root)
+	command := &execdriver.Command{ID: "1"}
+	p := newTestConfig(t, driver, command)
+	grepFileNot(t, p, "lxc.cgroup.memory.swappiness")
+
+	for _, swappiness := range []int64{0, 100} {
+		value := swappiness
+		command.MemorySwappiness = &value
+		if err := execdriver.ValidateMemorySwappiness(command.MemorySwappiness); err != nil {
+			t.Fatal(err)
+		}
+		p = newTestConfig(t, driver, command)
+		grepFile(t, p, fmt.Sprintf("lxc.cgroup.memory.swappiness = %d", swappiness))
+	}
+
+	for _, swappiness := range []int64{-1, 101} {
+		value := swappiness
+		if err := execdriver.ValidateMemorySwappiness(&value); err == nil {
+			t.Errorf("Expected an error for the memory swappiness %d", swappiness)
+		}
+	}
+}
+
+func TestLXCConfigKernelMemory(t *testing.T) {
+	driver := newTestDriver(t, false)
+	defer os.RemoveAll(driver.root)
+	command := &execdriver.Command{ID: "1"}
+	p := newTestConfig(t, driver, command)
+	grepFileNot(t, p, "lxc.cgroup.memory.kmem")
+
+	command.KernelMemory = 50331648
+	p = newTestConfig(t, driver, command)
+	grepFile(t, p, "lxc.cgroup.memory.kmem.limit_in_bytes = 50331648")
+}
+
+func TestLXCConfigShmSize(t *testing.T) {
+	driver := newTestDriver(t, false)
+	defer os.RemoveAll(driver.root)
+	command := &execdriver.Command{ID: "1", Rootfs: "/rootfs"}
+	p := newTestConfig(t, driver, command)
+	grepFile(t, p, "lxc.mount.entry = shm /rootfs/dev/shm tmpfs size=65536k,nosuid,nodev,noexec 0 0")
+
+	command.ShmSize = 1 << 30
+	p = newTestConfig(t, driver, command)
+	grepFile(t, p, "lxc.mount.entry = shm /rootfs/dev/shm tmpfs size=1048576k,nosuid,nodev,noexec 0 0")
+}
@@ -0,0 +1,51 @@
+// +build linux
+
+package lxc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Returns a channel receiving a value for each OOM of the memory cgroup dir
+// and closed once dir is removed, through the cgroup.event_control eventfd
+// which the kernel also signals on removal
+func notifyOOM(dir string) (<-chan struct{}, error) {
+	oomControl, err := os.Open(filepath.Join(dir, "memory.oom_control"))
+	if err != nil {
+		return nil, err
+	}
+	fd, _, errno := syscall.RawSyscall(syscall.SYS_EVENTFD2, 0, syscall.FD_CLOEXEC, 0)
+	if errno != 0 {
+		oomControl.Close()
+		return nil, errno
+	}
+	eventfd := os.NewFile(fd, "eventfd")
+	data := fmt.Sprintf("%d %d", eventfd.Fd(), oomControl.Fd())
+	if err := ioutil.WriteFile(filepath.Join(dir, "cgroup.event_control"), []byte(data), 0700); err != nil {
+		eventfd.Close()
+		oomControl.Close()
+		return nil, err
+	}
+
+	notifications := make(chan struct{})
+	go func() {
+		defer close(notifications)
+		defer oomControl.Close()
+		defer eventfd.Close()
+		buf := make([]byte, 8)
+		for {
+			if _, err := eventfd.Read(buf); err != nil {
+				return
+			}
+			if _, err := os.Stat(filepath.Join(dir, "cgroup.event_control")); os.IsNotExist(err) {
+				return
+			}
+			notifications <- struct{}{}
+		}
+	}()
+	return notifications, nil
+}
@@ -0,0 +1,11 @@
+// +build !linux
+
+package lxc
+
+import (
+	"fmt"
+)
+
+func notifyOOM(dir string) (<-chan struct{}, error) {
+	return nil, fmt.Errorf("not supported")
+}
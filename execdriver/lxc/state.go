@@ -0,0 +1,58 @@
+package lxc
+
+import (
+	"encoding/json"
+	"github.com/dotcloud/docker/execdriver"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// Where the run state of the container is kept across daemon restarts
+func (d *driver) runStatePath(id string) string {
+	return path.Join(d.root, "containers", id, "state.json")
+}
+
+func (d *driver) saveRunState(id string, state *execdriver.RunState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := d.runStatePath(id) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, d.runStatePath(id)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// GetState returns the restarts and last exit code of the container as
+// recorded by Run, the zero state when it never exited
+func (d *driver) GetState(id string) (execdriver.RunState, error) {
+	var state execdriver.RunState
+	data, err := ioutil.ReadFile(d.runStatePath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, err
+	}
+	return state, nil
+}
+
+// WasOOMKilled returns whether the last launch of the container id by Run
+// hit its memory limit, which got its main process killed unless the OOM
+// killer is disabled
+func (d *driver) WasOOMKilled(id string) (bool, error) {
+	state, err := d.GetState(id)
+	if err != nil {
+		return false, err
+	}
+	return state.OOMKilled, nil
+}
@@ -0,0 +1,165 @@
+package lxc
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/dotcloud/docker/execdriver"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// cpuacct.stat is reported in USER_HZ which is 100 on all
+// the architectures we support
+const clockTicks = 100
+
+// How long FsUsage reuses the size it last computed for a container
+const fsUsageCacheTTL = 2 * time.Second
+
+type fsUsageEntry struct {
+	size int64
+	at   time.Time
+}
+
+// Stats returns the memory and cpu usage of the container
+// read from its memory and cpuacct cgroups
+func (d *driver) Stats(id string) (*execdriver.ResourceStats, error) {
+	memoryDir, err := d.findCgroupDir("memory", id)
+	if err != nil {
+		return nil, err
+	}
+	cpuacctDir, err := d.findCgroupDir("cpuacct", id)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &execdriver.ResourceStats{}
+	if stats.MemoryUsage, err = readCgroupInt(filepath.Join(memoryDir, "memory.usage_in_bytes")); err != nil {
+		return nil, err
+	}
+	if stats.MemoryLimit, err = readCgroupInt(filepath.Join(memoryDir, "memory.limit_in_bytes")); err != nil {
+		return nil, err
+	}
+	if stats.CpuUsage, err = readCgroupInt(filepath.Join(cpuacctDir, "cpuacct.usage")); err != nil {
+		return nil, err
+	}
+	if stats.CpuUser, stats.CpuSystem, err = readCpuacctStat(filepath.Join(cpuacctDir, "cpuacct.stat")); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// FsUsage returns the bytes used by the files of the container directory
+// under the driver root, its config and logs. The rootfs mounted in there
+// and whatever else lives on another filesystem are left out. The result
+// is cached for fsUsageCacheTTL so that frequent polls don't walk the tree
+// every time.
+func (d *driver) FsUsage(id string) (int64, error) {
+	d.fsUsageLock.Lock()
+	defer d.fsUsageLock.Unlock()
+
+	if entry, ok := d.fsUsage[id]; ok && time.Since(entry.at) < fsUsageCacheTTL {
+		return entry.size, nil
+	}
+	size, err := directorySize(filepath.Join(d.root, "containers", id))
+	if err != nil {
+		delete(d.fsUsage, id)
+		return 0, err
+	}
+	if d.fsUsage == nil {
+		d.fsUsage = make(map[string]fsUsageEntry)
+	}
+	d.fsUsage[id] = fsUsageEntry{size: size, at: time.Now()}
+	return size, nil
+}
+
+// Sum the size of the files under dir, hard links counted once. The
+// rootfs directory and the mounts of other filesystems are not descended.
+func directorySize(dir string) (int64, error) {
+	var (
+		size int64
+		seen = make(map[uint64]bool)
+		dev  uint64
+	)
+	if fi, err := os.Stat(dir); err != nil {
+		return 0, err
+	} else if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		dev = uint64(st.Dev)
+	}
+	rootfs := filepath.Join(dir, "rootfs")
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			if p == rootfs {
+				return filepath.SkipDir
+			}
+			if st, ok := fi.Sys().(*syscall.Stat_t); ok && uint64(st.Dev) != dev {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		if st, ok := fi.Sys().(*syscall.Stat_t); ok && st.Nlink > 1 {
+			if seen[st.Ino] {
+				return nil
+			}
+			seen[st.Ino] = true
+		}
+		size += fi.Size()
+		return nil
+	})
+	return size, err
+}
+
+func readCgroupInt(filename string) (int64, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	// memory.limit_in_bytes reports "unlimited" as the max uint64,
+	// clamp it instead of failing to parse
+	value, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid value in %s: %s", filename, err)
+	}
+	if value > 1<<63-1 {
+		value = 1<<63 - 1
+	}
+	return int64(value), nil
+}
+
+// Parse the user and system times of cpuacct.stat into nanoseconds
+func readCpuacctStat(filename string) (user, system int64, err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		ticks, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("Invalid value in %s: %s", filename, err)
+		}
+		switch fields[0] {
+		case "user":
+			user = ticks * (1e9 / clockTicks)
+		case "system":
+			system = ticks * (1e9 / clockTicks)
+		}
+	}
+	return user, system, s.Err()
+}
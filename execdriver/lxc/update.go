@@ -0,0 +1,116 @@
+package lxc
+
+import (
+	"fmt"
+	"github.com/dotcloud/docker/execdriver"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+type cgroupWrite struct {
+	subsystem string
+	file      string
+	value     string
+}
+
+// UpdateResources changes the limits of the running container id by
+// writing r to its cgroups. The zero values are left unchanged, as are
+// the limits which are off like an OomKillDisable of false. A MemorySwap of
+// 0 with a Memory limit is twice Memory, as when starting the container.
+func (d *driver) UpdateResources(id string, r execdriver.Resources) error {
+	if err := validateResources(&r); err != nil {
+		return err
+	}
+	writes, err := d.resourceWrites(id, &r)
+	if err != nil {
+		return err
+	}
+	for _, w := range writes {
+		dir, err := d.findCgroupDir(w.subsystem, id)
+		if err != nil {
+			return err
+		}
+		filename := filepath.Join(dir, w.file)
+		if err := ioutil.WriteFile(filename, []byte(w.value), 0); err != nil {
+			if pathErr, ok := err.(*os.PathError); ok && pathErr.Err == syscall.EBUSY && w.file == "memory.limit_in_bytes" {
+				// The kernel couldn't reclaim enough to get under the new limit
+				usage, _ := readCgroupInt(filepath.Join(dir, "memory.usage_in_bytes"))
+				return fmt.Errorf("Unable to lower the memory limit of %s to %s bytes, it is using %d bytes", id, w.value, usage)
+			}
+			return fmt.Errorf("Unable to update %s of %s to %s: %s", w.file, id, w.value, err)
+		}
+	}
+	return nil
+}
+
+// Returns the cgroup files to write for r in order. The memory limit
+// can't go above the memory+swap one, the first of the two written is
+// the one keeping them ordered.
+func (d *driver) resourceWrites(id string, r *execdriver.Resources) ([]cgroupWrite, error) {
+	var writes []cgroupWrite
+	add := func(subsystem, file string, value int64) {
+		writes = append(writes, cgroupWrite{subsystem, file, strconv.FormatInt(value, 10)})
+	}
+
+	if r.Memory > 0 {
+		memory := cgroupWrite{"memory", "memory.limit_in_bytes", strconv.FormatInt(r.Memory, 10)}
+		swap := r.MemorySwap
+		if swap == 0 {
+			swap = r.Memory * 2
+		}
+		memsw := cgroupWrite{"memory", "memory.memsw.limit_in_bytes", strconv.FormatInt(swap, 10)}
+
+		dir, err := d.findCgroupDir("memory", id)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(filepath.Join(dir, memsw.file)); err != nil {
+			// No swap accounting on this kernel
+			writes = append(writes, memory)
+		} else if current, err := readCgroupInt(filepath.Join(dir, memory.file)); err == nil && r.Memory > current {
+			writes = append(writes, memsw, memory)
+		} else {
+			writes = append(writes, memory, memsw)
+		}
+		if r.OomKillDisable {
+			add("memory", "memory.oom_control", 1)
+		}
+	}
+	if r.MemoryReservation > 0 {
+		add("memory", "memory.soft_limit_in_bytes", r.MemoryReservation)
+	}
+	if r.CpuShares > 0 {
+		add("cpu", "cpu.shares", r.CpuShares)
+	}
+	if r.CpuPeriod > 0 {
+		add("cpu", "cpu.cfs_period_us", r.CpuPeriod)
+	}
+	if r.CpuQuota > 0 {
+		add("cpu", "cpu.cfs_quota_us", r.CpuQuota)
+	}
+	if r.CpusetCpus != "" {
+		writes = append(writes, cgroupWrite{"cpuset", "cpuset.cpus", r.CpusetCpus})
+	}
+	if r.CpusetMems != "" {
+		writes = append(writes, cgroupWrite{"cpuset", "cpuset.mems", r.CpusetMems})
+	}
+	if r.BlkioWeight > 0 {
+		add("blkio", "blkio.weight", int64(r.BlkioWeight))
+	}
+	// The throttled devices were checked by validateResources
+	for _, t := range r.BlkioDeviceReadBps {
+		limit, _ := t.CgroupString()
+		writes = append(writes, cgroupWrite{"blkio", "blkio.throttle.read_bps_device", limit})
+	}
+	for _, t := range r.BlkioDeviceWriteBps {
+		limit, _ := t.CgroupString()
+		writes = append(writes, cgroupWrite{"blkio", "blkio.throttle.write_bps_device", limit})
+	}
+	if r.PidsLimit > 0 {
+		add("pids", "pids.max", r.PidsLimit)
+	}
+	return writes, nil
+}
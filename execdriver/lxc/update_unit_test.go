@@ -0,0 +1,71 @@
+package lxc
+
+import (
+	"github.com/dotcloud/docker/execdriver"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestUpdateResources(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	roots := map[string]string{}
+	for subsystem, files := range map[string]map[string]string{
+		"memory": {"memory.limit_in_bytes": "67108864\n", "memory.memsw.limit_in_bytes": "134217728\n"},
+		"cpu":    {"cpu.shares": "1024\n"},
+	} {
+		roots[subsystem] = path.Join(tmp, subsystem)
+		if err := os.MkdirAll(path.Join(roots[subsystem], "1"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		for file, value := range files {
+			if err := ioutil.WriteFile(path.Join(roots[subsystem], "1", file), []byte(value), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	d := &driver{root: tmp, cgroupRoots: roots}
+
+	// Raising the memory limit needs the memory+swap one raised first
+	writes, err := d.resourceWrites("1", &execdriver.Resources{Memory: 134217728})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []cgroupWrite{
+		{"memory", "memory.memsw.limit_in_bytes", "268435456"},
+		{"memory", "memory.limit_in_bytes", "134217728"},
+	}
+	if !reflect.DeepEqual(writes, expected) {
+		t.Fatalf("Expected %v, got %v", expected, writes)
+	}
+	if writes, err = d.resourceWrites("1", &execdriver.Resources{Memory: 33554432, MemorySwap: -1}); err != nil {
+		t.Fatal(err)
+	}
+	if writes[0].file != "memory.limit_in_bytes" || writes[1].value != "-1" {
+		t.Fatalf("Expected the memory limit to be lowered first, got %v", writes)
+	}
+
+	if err := d.UpdateResources("1", execdriver.Resources{Memory: 33554432, CpuShares: 512}); err != nil {
+		t.Fatal(err)
+	}
+	for file, expected := range map[string]string{
+		path.Join(roots["memory"], "1", "memory.limit_in_bytes"):       "33554432",
+		path.Join(roots["memory"], "1", "memory.memsw.limit_in_bytes"): "67108864",
+		path.Join(roots["cpu"], "1", "cpu.shares"):                     "512",
+	} {
+		if value, err := ioutil.ReadFile(file); err != nil || string(value) != expected {
+			t.Errorf("Expected %s to be %s, got %q (%v)", file, expected, value, err)
+		}
+	}
+
+	if err := d.UpdateResources("1", execdriver.Resources{MemorySwap: 1 << 30}); err == nil {
+		t.Fatal("Expected an error for a swap limit without a memory limit")
+	}
+}
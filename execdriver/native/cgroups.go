@@ -0,0 +1,258 @@
+// +build linux
+
+package native
+
+import (
+	"fmt"
+	"github.com/dotcloud/docker/execdriver"
+	"github.com/dotcloud/docker/pkg/cgroups"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Devices unprivileged containers have access to,
+// this mirrors the list of the lxc template
+var defaultAllowedDevices = []string{
+	"c 1:3 rwm", // /dev/null
+	"c 1:5 rwm", // /dev/zero
+	"c 5:1 rwm", // consoles
+	"c 5:0 rwm",
+	"c 4:0 rwm",
+	"c 4:1 rwm",
+	"c 1:9 rwm",   // /dev/urandom
+	"c 1:8 rwm",   // /dev/random
+	"c 136:* rwm", // /dev/pts
+	"c 5:2 rwm",
+	"c 10:200 rwm", // tuntap
+}
+
+type cgroupValue struct {
+	file  string
+	value string
+}
+
+type cgroupSettings struct {
+	subsystem string
+	required  bool // fail when the subsystem is not mounted
+	values    []cgroupValue
+}
+
+// Compute the cgroup files to write for the container
+func getCgroupSettings(c *execdriver.Command) []cgroupSettings {
+	devices := cgroupSettings{subsystem: "devices"}
+	// An explicit list of devices restricts privileged containers too
+	if c.Privileged && len(c.AllowedDevices) == 0 {
+		devices.values = append(devices.values, cgroupValue{"devices.allow", "a"})
+	} else {
+		devices.required = true
+		devices.values = append(devices.values, cgroupValue{"devices.deny", "a"})
+		for _, dev := range defaultAllowedDevices {
+			devices.values = append(devices.values, cgroupValue{"devices.allow", dev})
+		}
+		for _, dev := range c.AllowedDevices {
+			devices.values = append(devices.values, cgroupValue{"devices.allow", dev.CgroupString()})
+		}
+	}
+
+	var (
+		memory   = cgroupSettings{subsystem: "memory"}
+		cpu      = cgroupSettings{subsystem: "cpu"}
+		settings = []cgroupSettings{devices}
+	)
+	if r := c.Resources; r != nil {
+		if r.Memory > 0 {
+			memory.required = true
+			memory.values = append(memory.values, cgroupValue{"memory.limit_in_bytes", strconv.FormatInt(r.Memory, 10)})
+			// Same defaults as the lxc driver, twice the memory unless disabled
+			if swap := r.MemorySwap; swap >= 0 {
+				if swap == 0 {
+					swap = r.Memory * 2
+				}
+				memory.values = append(memory.values, cgroupValue{"memory.memsw.limit_in_bytes", strconv.FormatInt(swap, 10)})
+			}
+			if r.OomKillDisable {
+				memory.values = append(memory.values, cgroupValue{"memory.oom_control", "1"})
+			}
+		}
+		// Without a reservation the soft limit stays the memory limit
+		if reservation := r.MemoryReservation; reservation > 0 || r.Memory > 0 {
+			if reservation == 0 {
+				reservation = r.Memory
+			}
+			memory.required = true
+			memory.values = append(memory.values, cgroupValue{"memory.soft_limit_in_bytes", strconv.FormatInt(reservation, 10)})
+		}
+		if r.CpuShares > 0 {
+			cpu.required = true
+			cpu.values = append(cpu.values, cgroupValue{"cpu.shares", strconv.FormatInt(r.CpuShares, 10)})
+		}
+		if r.CpuPeriod > 0 {
+			cpu.required = true
+			cpu.values = append(cpu.values, cgroupValue{"cpu.cfs_period_us", strconv.FormatInt(r.CpuPeriod, 10)})
+		}
+		if r.CpuQuota > 0 {
+			cpu.required = true
+			cpu.values = append(cpu.values, cgroupValue{"cpu.cfs_quota_us", strconv.FormatInt(r.CpuQuota, 10)})
+		}
+		if r.CpusetCpus != "" || r.CpusetMems != "" {
+			cpuset := cgroupSettings{subsystem: "cpuset", required: true}
+			if r.CpusetCpus != "" {
+				cpuset.values = append(cpuset.values, cgroupValue{"cpuset.cpus", r.CpusetCpus})
+			}
+			if r.CpusetMems != "" {
+				cpuset.values = append(cpuset.values, cgroupValue{"cpuset.mems", r.CpusetMems})
+			}
+			settings = append(settings, cpuset)
+		}
+		blkio := cgroupSettings{subsystem: "blkio"}
+		if r.BlkioWeight > 0 {
+			blkio.values = append(blkio.values, cgroupValue{"blkio.weight", strconv.Itoa(int(r.BlkioWeight))})
+		}
+		// The devices were checked by checkSupported
+		for _, t := range r.BlkioDeviceReadBps {
+			limit, _ := t.CgroupString()
+			blkio.required = true
+			blkio.values = append(blkio.values, cgroupValue{"blkio.throttle.read_bps_device", limit})
+		}
+		for _, t := range r.BlkioDeviceWriteBps {
+			limit, _ := t.CgroupString()
+			blkio.required = true
+			blkio.values = append(blkio.values, cgroupValue{"blkio.throttle.write_bps_device", limit})
+		}
+		if len(blkio.values) > 0 {
+			settings = append(settings, blkio)
+		}
+		if r.PidsLimit > 0 {
+			settings = append(settings, cgroupSettings{
+				subsystem: "pids",
+				required:  true,
+				values:    []cgroupValue{{"pids.max", strconv.FormatInt(r.PidsLimit, 10)}},
+			})
+		}
+	}
+	if c.MemorySwappiness != nil {
+		memory.required = true
+		memory.values = append(memory.values, cgroupValue{"memory.swappiness", strconv.FormatInt(*c.MemorySwappiness, 10)})
+	}
+	if c.KernelMemory > 0 {
+		// Written along with the others before the init joins the cgroup
+		memory.required = true
+		memory.values = append(memory.values, cgroupValue{"memory.kmem.limit_in_bytes", strconv.FormatInt(c.KernelMemory, 10)})
+	}
+	return append(settings, memory, cpu,
+		cgroupSettings{subsystem: "cpuacct"},
+		cgroupSettings{subsystem: "freezer"},
+	)
+}
+
+// Returns the cgroup directory of the container for the given subsystem
+func cgroupPath(subsystem, id string) (string, error) {
+	cgroupRoot, err := cgroups.FindCgroupMountpoint(subsystem)
+	if err != nil {
+		return "", err
+	}
+	cgroupDir, err := cgroups.GetThisCgroupDir(subsystem)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cgroupRoot, cgroupDir, id), nil
+}
+
+// Create the cgroups of the container, apply its limits and
+// move its init process in them. It returns the directories
+// created so far, even on error, so that they can be removed.
+func applyCgroups(c *execdriver.Command) ([]string, error) {
+	var dirs []string
+	for _, s := range getCgroupSettings(c) {
+		dir, err := cgroupPath(s.subsystem, c.ID)
+		if err != nil {
+			if s.required {
+				return dirs, fmt.Errorf("Unable to apply the %s limits: %s", s.subsystem, err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return dirs, err
+		}
+		dirs = append(dirs, dir)
+
+		if s.subsystem == "cpuset" {
+			// No task can join a cpuset until both its cpus and memory
+			// nodes are set, inherit the ones not requested from the parent
+			for _, file := range []string{"cpuset.cpus", "cpuset.mems"} {
+				if hasCgroupValue(s.values, file) {
+					continue
+				}
+				value, err := ioutil.ReadFile(filepath.Join(filepath.Dir(dir), file))
+				if err != nil {
+					return dirs, err
+				}
+				s.values = append([]cgroupValue{{file, strings.TrimSpace(string(value))}}, s.values...)
+			}
+		}
+		for _, v := range s.values {
+			if err := ioutil.WriteFile(filepath.Join(dir, v.file), []byte(v.value), 0); err != nil {
+				return dirs, fmt.Errorf("Unable to write %s to %s: %s", v.value, v.file, err)
+			}
+		}
+		// dockerinit is already multi-threaded, tasks would only move the
+		// one thread, cgroup.procs moves all of them
+		if err := ioutil.WriteFile(filepath.Join(dir, "cgroup.procs"), []byte(strconv.Itoa(c.Process.Pid)), 0); err != nil {
+			return dirs, err
+		}
+	}
+	return dirs, nil
+}
+
+func hasCgroupValue(values []cgroupValue, file string) bool {
+	for _, v := range values {
+		if v.file == file {
+			return true
+		}
+	}
+	return false
+}
+
+// Remove the cgroups of the container once all its tasks are gone
+func removeCgroups(dirs []string) {
+	for _, dir := range dirs {
+		// The kernel refuses to remove a cgroup until the
+		// exited tasks have been reaped, retry for a while
+		for i := 0; i < 10; i++ {
+			if err := os.Remove(dir); err == nil || os.IsNotExist(err) {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+}
+
+func setFreezerState(id, state string) error {
+	dir, err := cgroupPath("freezer", id)
+	if err != nil {
+		return err
+	}
+	stateFile := filepath.Join(dir, "freezer.state")
+	if err := ioutil.WriteFile(stateFile, []byte(state), 0); err != nil {
+		return err
+	}
+
+	// Freezing is not instantaneous, the kernel reports FREEZING
+	// until every task in the cgroup has been stopped
+	var current string
+	for i := 0; i < 20; i++ {
+		data, err := ioutil.ReadFile(stateFile)
+		if err != nil {
+			return err
+		}
+		if current = strings.TrimSpace(string(data)); current == state {
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return fmt.Errorf("Container %s freezer state is %s, expected %s", id, current, state)
+}
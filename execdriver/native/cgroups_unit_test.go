@@ -0,0 +1,73 @@
+// +build linux
+
+package native
+
+import (
+	"github.com/dotcloud/docker/execdriver"
+	"testing"
+)
+
+func findCgroupValue(settings []cgroupSettings, subsystem, file string) (string, bool) {
+	for _, s := range settings {
+		if s.subsystem != subsystem {
+			continue
+		}
+		for _, v := range s.values {
+			if v.file == file {
+				return v.value, true
+			}
+		}
+	}
+	return "", false
+}
+
+func TestCgroupSettings(t *testing.T) {
+	c := &execdriver.Command{
+		Resources: &execdriver.Resources{
+			Memory:    33554432,
+			CpuShares: 512,
+		},
+	}
+	settings := getCgroupSettings(c)
+	for file, expected := range map[string]string{
+		"memory.limit_in_bytes":       "33554432",
+		"memory.memsw.limit_in_bytes": "67108864",
+		"memory.soft_limit_in_bytes":  "33554432",
+	} {
+		if value, _ := findCgroupValue(settings, "memory", file); value != expected {
+			t.Errorf("Expected %s to be %s, got %q", file, expected, value)
+		}
+	}
+	if value, _ := findCgroupValue(settings, "cpu", "cpu.shares"); value != "512" {
+		t.Errorf("Expected cpu.shares to be 512, got %q", value)
+	}
+	if value, _ := findCgroupValue(settings, "devices", "devices.deny"); value != "a" {
+		t.Errorf("Expected unprivileged containers to be denied every device by default")
+	}
+
+	c.Privileged = true
+	c.Resources.MemorySwap = -1
+	settings = getCgroupSettings(c)
+	if _, found := findCgroupValue(settings, "memory", "memory.memsw.limit_in_bytes"); found {
+		t.Error("Expected no swap limit when it is disabled")
+	}
+	if _, found := findCgroupValue(settings, "devices", "devices.deny"); found {
+		t.Error("Expected privileged containers to have access to every device")
+	}
+
+	swappiness := int64(0)
+	c.MemorySwappiness = &swappiness
+	if value, _ := findCgroupValue(getCgroupSettings(c), "memory", "memory.swappiness"); value != "0" {
+		t.Errorf("Expected memory.swappiness to be 0, got %q", value)
+	}
+
+	c.Resources.MemoryReservation = 16777216
+	if value, _ := findCgroupValue(getCgroupSettings(c), "memory", "memory.soft_limit_in_bytes"); value != "16777216" {
+		t.Errorf("Expected memory.soft_limit_in_bytes to be the reservation, got %q", value)
+	}
+
+	c.KernelMemory = 50331648
+	if value, _ := findCgroupValue(getCgroupSettings(c), "memory", "memory.kmem.limit_in_bytes"); value != "50331648" {
+		t.Errorf("Expected memory.kmem.limit_in_bytes to be 50331648, got %q", value)
+	}
+}
@@ -0,0 +1,412 @@
+// +build linux
+
+package native
+
+import (
+	"fmt"
+	"github.com/dotcloud/docker/execdriver"
+	"github.com/dotcloud/docker/execdriver/setup"
+	"github.com/dotcloud/docker/pkg/netlink"
+	"github.com/dotcloud/docker/utils"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	DriverName = "native"
+	Version    = "0.1"
+
+	// namespaces dockerinit is cloned into
+	cloneFlags = syscall.CLONE_NEWNS | syscall.CLONE_NEWUTS | syscall.CLONE_NEWIPC | syscall.CLONE_NEWPID | syscall.CLONE_NEWNET
+)
+
+type driver struct {
+}
+
+func NewDriver() (*driver, error) {
+	return &driver{}, nil
+}
+
+func (d *driver) Name() string {
+	return fmt.Sprintf("%s-%s", DriverName, Version)
+}
+
+func (d *driver) Run(c *execdriver.Command, pipes *execdriver.Pipes, startCallback execdriver.StartCallback) (int, error) {
+	if err := c.Validate(); err != nil {
+		return -1, err
+	}
+	if err := checkSupported(c); err != nil {
+		return -1, err
+	}
+	seccompParams, err := execdriver.SeccompParams(c)
+	if err != nil {
+		return -1, err
+	}
+	deviceParams, err := execdriver.DeviceParams(c)
+	if err != nil {
+		return -1, err
+	}
+	ulimitParams, err := execdriver.UlimitParams(c)
+	if err != nil {
+		return -1, err
+	}
+	pathParams, err := execdriver.PathParams(c)
+	if err != nil {
+		return -1, err
+	}
+	if err := execdriver.SetTerminal(c, pipes); err != nil {
+		return -1, err
+	}
+	if err := execdriver.WriteEnv(c); err != nil {
+		return -1, err
+	}
+
+	params := []string{
+		c.InitPath,
+		"-driver",
+		DriverName,
+		"-root",
+		c.Rootfs,
+	}
+
+	var (
+		network             *execdriver.Network
+		vethHost, vethChild string
+	)
+	if ifaces := c.Interfaces(); len(ifaces) > 0 {
+		network = ifaces[0]
+		// The interface is renamed to eth0 by dockerinit once in the
+		// namespace of the container, to avoid clashing with the host's
+		suffix := utils.RandomString()[:7]
+		vethHost, vethChild = "veth"+suffix, "vchd"+suffix
+		if network.VethName != "" {
+			vethHost = network.VethName
+		}
+		params = append(params, "-veth", vethChild)
+		params = append(params, execdriver.NetworkParams(c)...)
+	}
+	netns, err := execdriver.OpenNetNs(c, nil)
+	if err != nil {
+		return -1, err
+	}
+	if netns != nil {
+		defer netns.Close()
+		// Passed right after the sync pipe
+		params = append(params, "-netns-fd", "4")
+	}
+
+	if c.User != "" {
+		params = append(params, "-u", c.User)
+	}
+	if len(c.GroupAdd) > 0 {
+		params = append(params, "-group-add", strings.Join(c.GroupAdd, ":"))
+	}
+
+	if c.Privileged {
+		params = append(params, "-privileged")
+	}
+
+	if c.Domainname != "" {
+		params = append(params, "-domain", c.Domainname)
+	}
+	params = append(params, execdriver.UTSParams(c)...)
+	if c.ShmSize > 0 {
+		params = append(params, "-shm-size", strconv.FormatInt(c.ShmSize, 10))
+	}
+
+	if c.NoNewPrivileges {
+		params = append(params, "-no-new-privileges")
+	}
+	params = append(params, seccompParams...)
+	params = append(params, deviceParams...)
+	params = append(params, ulimitParams...)
+	params = append(params, pathParams...)
+	params = append(params, execdriver.SysctlParams(c)...)
+	params = append(params, execdriver.CgroupNamespaceParams(c)...)
+
+	if c.WorkingDir != "" {
+		params = append(params, "-w", c.WorkingDir)
+		if c.CreateWorkingDir {
+			params = append(params, "-create-workdir")
+		}
+	}
+
+	if len(c.CapAdd) > 0 {
+		params = append(params, "-cap-add", strings.Join(c.CapAdd, ":"))
+	}
+
+	if len(c.CapDrop) > 0 {
+		params = append(params, "-cap-drop", strings.Join(c.CapDrop, ":"))
+	}
+
+	if c.Tty {
+		params = append(params, "-console", c.Console)
+	}
+
+	params = append(params, "--", c.Entrypoint)
+	params = append(params, c.Arguments...)
+
+	// dockerinit is bind mounted in the rootfs by the core
+	c.Path = filepath.Join(c.Rootfs, c.InitPath)
+	c.Args = params
+	if c.SysProcAttr == nil {
+		c.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	c.SysProcAttr.Cloneflags = cloneFlags
+	if c.HostNetworking {
+		c.SysProcAttr.Cloneflags &^= syscall.CLONE_NEWNET
+	}
+	if c.HostPid {
+		c.SysProcAttr.Cloneflags &^= syscall.CLONE_NEWPID
+	}
+	if c.UTSMode == execdriver.UTSModeHost {
+		c.SysProcAttr.Cloneflags &^= syscall.CLONE_NEWUTS
+	}
+
+	// dockerinit blocks reading this pipe until the cgroups and the
+	// network of the container have been set up
+	syncPipe, parentPipe, err := os.Pipe()
+	if err != nil {
+		return -1, err
+	}
+	defer parentPipe.Close()
+	c.ExtraFiles = []*os.File{syncPipe}
+	if netns != nil {
+		c.ExtraFiles = append(c.ExtraFiles, netns)
+	}
+
+	err = c.Start()
+	syncPipe.Close()
+	if err != nil {
+		return -1, err
+	}
+
+	cgroupDirs, err := applyCgroups(c)
+	defer removeCgroups(cgroupDirs)
+	if err == nil && vethHost != "" {
+		err = setupVeth(network, vethHost, vethChild, c.Process.Pid)
+	}
+	if err != nil {
+		c.Process.Kill()
+		c.Wait()
+		return -1, err
+	}
+	parentPipe.Close()
+
+	if startCallback != nil {
+		startCallback(c)
+	}
+
+	if err := c.Wait(); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok { // Do not propagate the error if it's simply a status code != 0
+			return c.ExitCode(), err
+		}
+	}
+	return c.ExitCode(), nil
+}
+
+// Options of the command this driver does not implement yet
+func checkSupported(c *execdriver.Command) error {
+	var unsupported []string
+	if c.ReadonlyRootfs {
+		unsupported = append(unsupported, "read-only rootfs")
+	}
+	if len(c.Dns) > 0 || len(c.DnsSearch) > 0 {
+		unsupported = append(unsupported, "custom dns")
+	}
+	if len(c.Mounts) > 0 || len(c.Tmpfs) > 0 {
+		unsupported = append(unsupported, "mounts")
+	}
+	if len(c.UidMappings) > 0 || len(c.GidMappings) > 0 {
+		unsupported = append(unsupported, "id mappings")
+	}
+	if c.AppArmorProfile != "" || c.GenerateAppArmor {
+		unsupported = append(unsupported, "apparmor profiles")
+	}
+	if len(c.Interfaces()) > 1 {
+		unsupported = append(unsupported, "multiple networks")
+	}
+	if len(c.LxcConf) > 0 {
+		unsupported = append(unsupported, "lxc config")
+	}
+	if name := c.RestartPolicy.Name; name != "" && name != "no" {
+		unsupported = append(unsupported, "restart policies")
+	}
+	for _, n := range c.Interfaces() {
+		if n.Gateway == execdriver.AutoGateway {
+			unsupported = append(unsupported, "automatic gateways")
+			break
+		}
+	}
+	if len(c.InitWrapper) > 0 {
+		unsupported = append(unsupported, "init wrappers")
+	}
+	if c.Network != nil && c.Network.NetworkContainerID != "" {
+		unsupported = append(unsupported, "container networks")
+	}
+	if c.IpcMode != "" {
+		unsupported = append(unsupported, "ipc modes")
+	}
+	if c.CgroupParent != "" {
+		unsupported = append(unsupported, "cgroup parents")
+	}
+	if len(c.HugepageLimits) > 0 {
+		unsupported = append(unsupported, "hugepage limits")
+	}
+	if c.StartAuto || c.StartOrder != 0 {
+		unsupported = append(unsupported, "lxc autostart")
+	}
+	if c.ConsoleLog {
+		unsupported = append(unsupported, "console logs")
+	}
+	if len(c.PreStart)+len(c.PostStart)+len(c.PreStop)+len(c.PostStop) > 0 {
+		unsupported = append(unsupported, "lifecycle hooks")
+	}
+	for _, n := range c.Interfaces() {
+		if n.NetworkBandwidth != 0 {
+			unsupported = append(unsupported, "network bandwidth limits")
+			break
+		}
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("The %s driver does not support: %s", DriverName, strings.Join(unsupported, ", "))
+	}
+	if r := c.Resources; r != nil {
+		for _, devices := range [][]execdriver.ThrottleDevice{r.BlkioDeviceReadBps, r.BlkioDeviceWriteBps} {
+			for _, t := range devices {
+				if _, err := t.CgroupString(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, n := range c.Interfaces() {
+		if n.VethName != "" {
+			if err := execdriver.ValidateVethName(n.VethName); err != nil {
+				return err
+			}
+		}
+		if n.MacAddress == "" {
+			continue
+		}
+		if _, err := net.ParseMAC(n.MacAddress); err != nil {
+			return fmt.Errorf("Invalid mac address %s: %s", n.MacAddress, err)
+		}
+	}
+	if _, err := setup.GetCapabilities(c.CapAdd); err != nil {
+		return err
+	}
+	if _, err := setup.GetCapabilities(c.CapDrop); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Create the veth pair of the container, attach the host side to the
+// bridge and move the other side in the network namespace of pid
+func setupVeth(network *execdriver.Network, vethHost, vethChild string, pid int) error {
+	if err := netlink.NetworkCreateVethPair(vethHost, vethChild); err != nil {
+		return fmt.Errorf("Unable to create veth pair: %s", err)
+	}
+	host, err := net.InterfaceByName(vethHost)
+	if err != nil {
+		return err
+	}
+	bridge, err := net.InterfaceByName(network.Bridge)
+	if err != nil {
+		return fmt.Errorf("Unable to find bridge %s: %s", network.Bridge, err)
+	}
+	if err := netlink.NetworkSetMaster(host, bridge); err != nil {
+		return err
+	}
+	if err := netlink.NetworkSetMTU(host, network.Mtu); err != nil {
+		return err
+	}
+	if err := netlink.NetworkLinkUp(host); err != nil {
+		return err
+	}
+	child, err := net.InterfaceByName(vethChild)
+	if err != nil {
+		return err
+	}
+	if network.MacAddress != "" {
+		if err := netlink.NetworkSetMacAddress(child, network.MacAddress); err != nil {
+			return fmt.Errorf("Unable to set mac address %s: %s", network.MacAddress, err)
+		}
+	}
+	return netlink.NetworkSetNsPid(child, pid)
+}
+
+func (d *driver) Kill(c *execdriver.Command, sig int) error {
+	if c.Process == nil {
+		return execdriver.ErrNotRunning
+	}
+	return syscall.Kill(c.Process.Pid, syscall.Signal(sig))
+}
+
+func (d *driver) Pause(c *execdriver.Command) error {
+	return setFreezerState(c.ID, "FROZEN")
+}
+
+func (d *driver) Unpause(c *execdriver.Command) error {
+	return setFreezerState(c.ID, "THAWED")
+}
+
+// The processes of a container started by a previous daemon are not our
+// children so the best we can do is to wait for its cgroup to be empty
+func (d *driver) Restore(c *execdriver.Command) (int, error) {
+	for {
+		pids, err := d.GetPidsForContainer(c.ID)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return -1, nil
+			}
+			return -1, err
+		}
+		if len(pids) == 0 {
+			return -1, nil
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+type info struct {
+	ID     string
+	driver *driver
+}
+
+func (i *info) IsRunning() bool {
+	pids, err := i.driver.GetPidsForContainer(i.ID)
+	return err == nil && len(pids) > 0
+}
+
+func (d *driver) Info(id string) execdriver.Info {
+	return &info{
+		ID:     id,
+		driver: d,
+	}
+}
+
+func (d *driver) GetPidsForContainer(id string) ([]int, error) {
+	pids := []int{}
+
+	// memory is chosen randomly, any cgroup used by docker works
+	cgroupDir, err := cgroupPath("memory", id)
+	if err != nil {
+		return pids, err
+	}
+
+	// tasks lists every thread, cgroup.procs one pid per process
+	output, err := ioutil.ReadFile(filepath.Join(cgroupDir, "cgroup.procs"))
+	if err != nil {
+		return pids, err
+	}
+	return execdriver.ParseTasks(output), nil
+}
@@ -0,0 +1,16 @@
+// +build !linux
+
+package native
+
+import (
+	"fmt"
+)
+
+const DriverName = "native"
+
+type driver struct {
+}
+
+func NewDriver() (*driver, error) {
+	return nil, fmt.Errorf("The %s driver is only supported on linux", DriverName)
+}
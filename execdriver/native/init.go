@@ -0,0 +1,160 @@
+// +build linux
+
+package native
+
+import (
+	"fmt"
+	"github.com/dotcloud/docker/execdriver"
+	"github.com/dotcloud/docker/execdriver/setup"
+	"github.com/dotcloud/docker/pkg/netlink"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+func init() {
+	execdriver.RegisterInitFunc(DriverName, func(args *execdriver.InitArgs) error {
+		if err := waitForDriver(); err != nil {
+			return err
+		}
+
+		if err := setupRootfs(args); err != nil {
+			return err
+		}
+
+		if err := renameVeth(args); err != nil {
+			return err
+		}
+
+		if err := setup.Hostname(args); err != nil {
+			return err
+		}
+
+		if err := setup.JoinNetNs(args); err != nil {
+			return err
+		}
+
+		if err := setup.Networking(args); err != nil {
+			return err
+		}
+
+		if err := setup.Devices(args); err != nil {
+			return err
+		}
+
+		if err := setup.Propagation(args); err != nil {
+			return err
+		}
+
+		if err := setup.Sysctls(args); err != nil {
+			return err
+		}
+
+		if err := setup.Paths(args); err != nil {
+			return err
+		}
+
+		if err := setup.Ulimits(args); err != nil {
+			return err
+		}
+
+		if err := setup.CgroupNamespace(args); err != nil {
+			return err
+		}
+
+		if err := setup.Capabilities(args); err != nil {
+			return err
+		}
+
+		if err := setup.WorkingDirectory(args); err != nil {
+			return err
+		}
+
+		if err := setup.ChangeUser(args); err != nil {
+			return err
+		}
+
+		if err := setup.NoNewPrivileges(args); err != nil {
+			return err
+		}
+
+		if err := setup.Seccomp(args); err != nil {
+			return err
+		}
+
+		return setup.Exec(args)
+	})
+}
+
+// Block until the driver closes its end of the sync pipe, passed as fd 3
+func waitForDriver() error {
+	pipe := os.NewFile(3, "sync-pipe")
+	defer pipe.Close()
+	if _, err := ioutil.ReadAll(pipe); err != nil {
+		return fmt.Errorf("Unable to sync with the driver: %s", err)
+	}
+	return nil
+}
+
+// Mount the pseudo filesystems in the rootfs and make it the root
+// of the new mount namespace
+func setupRootfs(args *execdriver.InitArgs) error {
+	root := args.Root
+
+	// Keep the mounts below from propagating to the host
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("Unable to make / private: %s", err)
+	}
+	if err := syscall.Mount(root, root, "bind", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return fmt.Errorf("Unable to bind mount %s: %s", root, err)
+	}
+
+	mounts := []struct {
+		source, target, fstype string
+		flags                  uintptr
+		data                   string
+	}{
+		{"proc", "/proc", "proc", syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC, ""},
+		{"sysfs", "/sys", "sysfs", syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC, ""},
+		{"devpts", "/dev/pts", "devpts", syscall.MS_NOSUID | syscall.MS_NOEXEC, "newinstance,ptmxmode=0666"},
+		{"shm", "/dev/shm", "tmpfs", syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC, execdriver.ShmSizeOption(args.ShmSize)},
+	}
+	for _, m := range mounts {
+		if err := syscall.Mount(m.source, filepath.Join(root, m.target), m.fstype, m.flags, m.data); err != nil {
+			return fmt.Errorf("Unable to mount %s on %s: %s", m.source, m.target, err)
+		}
+	}
+	if args.Console != "" {
+		if err := syscall.Mount(args.Console, filepath.Join(root, "/dev/console"), "bind", syscall.MS_BIND, ""); err != nil {
+			return fmt.Errorf("Unable to bind mount the console: %s", err)
+		}
+	}
+
+	if err := syscall.Chdir(root); err != nil {
+		return err
+	}
+	if err := syscall.Mount(root, "/", "", syscall.MS_MOVE, ""); err != nil {
+		return fmt.Errorf("Unable to move %s to /: %s", root, err)
+	}
+	if err := syscall.Chroot("."); err != nil {
+		return err
+	}
+	return syscall.Chdir("/")
+}
+
+// Give the container side of the veth pair its final name
+func renameVeth(args *execdriver.InitArgs) error {
+	if args.Veth == "" {
+		return nil
+	}
+	iface, err := net.InterfaceByName(args.Veth)
+	if err != nil {
+		return fmt.Errorf("Unable to set up networking: %v", err)
+	}
+	if err := netlink.NetworkChangeName(iface, "eth0"); err != nil {
+		return fmt.Errorf("Unable to rename %s to eth0: %v", args.Veth, err)
+	}
+	return nil
+}
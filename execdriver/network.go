@@ -0,0 +1,163 @@
+package execdriver
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Interface other than eth0 set up by dockerinit, the gateways
+// are only given when the interface carries the default route
+type InitInterface struct {
+	Name     string
+	Ip       string
+	Gateway  string
+	Ip6      string
+	Gateway6 string
+	Mtu      int
+}
+
+// Format as the value of the dockerinit -iface flag, e.g.
+// "eth1,1500,10.0.1.2/24,10.0.1.1,," with the IPv6 settings last
+func (i *InitInterface) String() string {
+	return strings.Join([]string{i.Name, strconv.Itoa(i.Mtu), i.Ip, i.Gateway, i.Ip6, i.Gateway6}, ",")
+}
+
+// Parse the value of a dockerinit -iface flag
+func ParseInitInterface(value string) (*InitInterface, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 6 || parts[0] == "" {
+		return nil, fmt.Errorf("Invalid interface %q", value)
+	}
+	mtu, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid mtu for interface %q: %s", value, err)
+	}
+	return &InitInterface{
+		Name:     parts[0],
+		Mtu:      mtu,
+		Ip:       parts[2],
+		Gateway:  parts[3],
+		Ip6:      parts[4],
+		Gateway6: parts[5],
+	}, nil
+}
+
+// Returns the interfaces of the container in order, Network being eth0
+// followed by Networks. There are none to create when the container
+// joins an existing network namespace.
+func (c *Command) Interfaces() []*Network {
+	if c.HostNetworking || c.JoinsNetNs() {
+		return nil
+	}
+	var ifaces []*Network
+	if c.Network != nil {
+		ifaces = append(ifaces, c.Network)
+	}
+	return append(ifaces, c.Networks...)
+}
+
+// Returns the dockerinit flags configuring the interfaces of the container.
+// Only the first interface gets a gateway unless some of them explicitly
+// ask for the default route.
+func NetworkParams(c *Command) []string {
+	ifaces := c.Interfaces()
+	explicit := false
+	for _, n := range ifaces {
+		if n.DefaultRoute {
+			explicit = true
+		}
+	}
+
+	var params []string
+	for i, n := range ifaces {
+		iface := &InitInterface{
+			Name: fmt.Sprintf("eth%d", i),
+			Ip:   fmt.Sprintf("%s/%d", n.IPAddress, n.IPPrefixLen),
+			Mtu:  n.Mtu,
+		}
+		if n.IPv6Address != "" {
+			iface.Ip6 = fmt.Sprintf("%s/%d", n.IPv6Address, n.IPv6PrefixLen)
+		}
+		if n.DefaultRoute || (!explicit && i == 0) {
+			iface.Gateway, iface.Gateway6 = n.Gateway, n.IPv6Gateway
+		}
+		if n.Gateway == AutoGateway {
+			// Already configured by the driver along with the route
+			iface.Ip, iface.Gateway = "", ""
+		}
+
+		if i > 0 {
+			params = append(params, "-iface", iface.String())
+			continue
+		}
+		if iface.Gateway != "" {
+			params = append(params, "-g", iface.Gateway)
+		}
+		if iface.Ip != "" {
+			params = append(params, "-i", iface.Ip)
+		}
+		params = append(params, "-mtu", strconv.Itoa(iface.Mtu))
+		if iface.Ip6 != "" {
+			params = append(params, "-i6", iface.Ip6)
+		}
+		if iface.Gateway6 != "" {
+			params = append(params, "-g6", iface.Gateway6)
+		}
+	}
+	return params
+}
+
+// Longest interface name the kernel takes, IFNAMSIZ less the trailing NUL
+const maxInterfaceName = 15
+
+// Check name can be given to the host side of a veth pair
+func ValidateVethName(name string) error {
+	if len(name) > maxInterfaceName {
+		return fmt.Errorf("Veth name %q is longer than %d characters", name, maxInterfaceName)
+	}
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/: \t\n") {
+		return fmt.Errorf("Invalid veth name %q", name)
+	}
+	return nil
+}
+
+// Whether the container joins an existing network namespace, the one of
+// Network.NetNsPath or of the container Network.NetworkContainerID
+func (c *Command) JoinsNetNs() bool {
+	return !c.HostNetworking && c.Network != nil && (c.Network.NetNsPath != "" || c.Network.NetworkContainerID != "")
+}
+
+// Open the network namespace the container joins, nil when it does not.
+// initPid resolves the host pid of the init of another container, drivers
+// not tracking them pass nil. dockerinit is given the file with -netns-fd,
+// the caller closes it.
+func OpenNetNs(c *Command, initPid func(id string) (int, error)) (*os.File, error) {
+	if !c.JoinsNetNs() {
+		return nil, nil
+	}
+	n := c.Network
+	if n.NetNsPath != "" && n.NetworkContainerID != "" {
+		return nil, fmt.Errorf("Unable to join both the network namespace %s and the network of container %s", n.NetNsPath, n.NetworkContainerID)
+	}
+	if len(c.Networks) > 0 {
+		return nil, fmt.Errorf("Additional networks can't be set up when joining an existing network namespace")
+	}
+	nsPath := n.NetNsPath
+	if id := n.NetworkContainerID; id != "" {
+		if initPid == nil {
+			return nil, fmt.Errorf("Unable to join the network of container %s: not supported by this driver", id)
+		}
+		pid, err := initPid(id)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to join the network of container %s: %s", id, err)
+		}
+		nsPath = fmt.Sprintf("/proc/%d/ns/net", pid)
+	}
+	f, err := os.Open(nsPath)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open the network namespace: %s", err)
+	}
+	return f, nil
+}
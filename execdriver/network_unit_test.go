@@ -0,0 +1,131 @@
+package execdriver
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseInitInterface(t *testing.T) {
+	iface := &InitInterface{
+		Name:     "eth1",
+		Ip:       "10.0.1.2/24",
+		Ip6:      "2001:db8::2/64",
+		Gateway6: "2001:db8::1",
+		Mtu:      1500,
+	}
+	parsed, err := ParseInitInterface(iface.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(iface, parsed) {
+		t.Fatalf("Expected %v, got %v", iface, parsed)
+	}
+	for _, value := range []string{"", "eth1", ",1500,10.0.1.2/24,,,", "eth1,mtu,10.0.1.2/24,,,"} {
+		if _, err := ParseInitInterface(value); err == nil {
+			t.Errorf("Expected an error parsing %q", value)
+		}
+	}
+}
+
+func TestNetworkParams(t *testing.T) {
+	c := &Command{
+		Network: &Network{Gateway: "10.0.0.1", IPAddress: "10.0.0.2", IPPrefixLen: 24, Mtu: 1500},
+		Networks: []*Network{
+			{Gateway: "10.0.1.1", IPAddress: "10.0.1.2", IPPrefixLen: 24, Mtu: 9000},
+		},
+	}
+	expected := []string{
+		"-g", "10.0.0.1", "-i", "10.0.0.2/24", "-mtu", "1500",
+		"-iface", "eth1,9000,10.0.1.2/24,,,",
+	}
+	if params := NetworkParams(c); !reflect.DeepEqual(params, expected) {
+		t.Fatalf("Expected %v, got %v", expected, params)
+	}
+
+	c.Networks[0].DefaultRoute = true
+	expected = []string{
+		"-i", "10.0.0.2/24", "-mtu", "1500",
+		"-iface", "eth1,9000,10.0.1.2/24,10.0.1.1,,",
+	}
+	if params := NetworkParams(c); !reflect.DeepEqual(params, expected) {
+		t.Fatalf("Expected %v, got %v", expected, params)
+	}
+
+	c.HostNetworking = true
+	if params := NetworkParams(c); len(params) != 0 {
+		t.Fatalf("Expected no network params with host networking, got %v", params)
+	}
+}
+
+func TestNetworkParamsGateway(t *testing.T) {
+	// No default route without a gateway
+	c := &Command{Network: &Network{IPAddress: "10.0.0.2", IPPrefixLen: 24, Mtu: 1500}}
+	expected := []string{"-i", "10.0.0.2/24", "-mtu", "1500"}
+	if params := NetworkParams(c); !reflect.DeepEqual(params, expected) {
+		t.Fatalf("Expected %v, got %v", expected, params)
+	}
+
+	// The driver sets up both the address and the route
+	c.Network.Gateway = AutoGateway
+	expected = []string{"-mtu", "1500"}
+	if params := NetworkParams(c); !reflect.DeepEqual(params, expected) {
+		t.Fatalf("Expected %v, got %v", expected, params)
+	}
+}
+
+func TestNetworkParamsNetNs(t *testing.T) {
+	c := &Command{Network: &Network{Gateway: "10.0.0.1", IPAddress: "10.0.0.2", IPPrefixLen: 24, Mtu: 1500, NetNsPath: "/proc/self/ns/net"}}
+	if params := NetworkParams(c); len(params) != 0 {
+		t.Fatalf("Expected no network params when joining a namespace, got %v", params)
+	}
+
+	f, err := OpenNetNs(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	c.Networks = []*Network{{IPAddress: "10.0.1.2", IPPrefixLen: 24, Mtu: 1500}}
+	if _, err := OpenNetNs(c, nil); err == nil {
+		t.Fatal("Expected an error joining a namespace with additional networks")
+	}
+}
+
+func TestOpenNetNsContainer(t *testing.T) {
+	c := &Command{Network: &Network{NetworkContainerID: "1"}}
+	if _, err := OpenNetNs(c, nil); err == nil {
+		t.Fatal("Expected an error joining a container without a way to find its pid")
+	}
+	f, err := OpenNetNs(c, func(id string) (int, error) {
+		if id != "1" {
+			t.Fatalf("Expected the pid of container 1, got %s", id)
+		}
+		return os.Getpid(), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	c.Network.NetNsPath = "/proc/self/ns/net"
+	if _, err := OpenNetNs(c, nil); err == nil {
+		t.Fatal("Expected an error joining both a namespace and a container")
+	}
+}
+
+func TestValidateVethName(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"veth1":            true,
+		"vethabcdefghijk":  true,
+		"vethabcdefghijkl": false,
+		"":                 false,
+		"..":               false,
+		"veth/1":           false,
+		"veth 1":           false,
+	} {
+		if err := ValidateVethName(name); (err == nil) != valid {
+			t.Errorf("Unexpected result for veth name %q: %v", name, err)
+		}
+	}
+}
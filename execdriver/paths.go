@@ -0,0 +1,112 @@
+package execdriver
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Paths hidden from the container when Command.MaskedPaths is nil,
+// privileged or not, as writing to or reading them can compromise the host
+var DefaultMaskedPaths = []string{
+	"/proc/kcore",
+	"/proc/sysrq-trigger",
+	"/proc/timer_stats",
+	"/proc/latency_stats",
+	"/sys/firmware",
+}
+
+// Paths made read-only when Command.ReadonlyPaths is nil, except for
+// privileged containers which are expected to tune the kernel
+var DefaultReadonlyPaths = []string{
+	"/proc/bus",
+	"/proc/fs",
+	"/proc/irq",
+	"/proc/sys",
+}
+
+// Propagation of the mounts not asking for another one, events neither
+// reach nor come from the host
+const DefaultMountPropagation = "rprivate"
+
+var mountPropagations = []string{"private", "rprivate", "shared", "rshared", "slave", "rslave"}
+
+// Returns the propagation of m, the default when not set
+func (m *Mount) Propagation() string {
+	if m.MountPropagation == "" {
+		return DefaultMountPropagation
+	}
+	return m.MountPropagation
+}
+
+func ValidateMountPropagation(propagation string) error {
+	for _, p := range mountPropagations {
+		if p == propagation {
+			return nil
+		}
+	}
+	return fmt.Errorf("Invalid mount propagation %q, expected one of %s", propagation, strings.Join(mountPropagations, ", "))
+}
+
+// Parse the value of the dockerinit -propagation flag, a list of
+// destination=propagation separated by ':'
+func ParsePropagations(list []string) (map[string]string, error) {
+	if len(list) == 0 {
+		return nil, nil
+	}
+	propagations := make(map[string]string, len(list))
+	for _, entry := range list {
+		i := strings.LastIndex(entry, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("Invalid mount propagation %q, expected destination=propagation", entry)
+		}
+		if err := ValidateMountPropagation(entry[i+1:]); err != nil {
+			return nil, err
+		}
+		propagations[entry[:i]] = entry[i+1:]
+	}
+	return propagations, nil
+}
+
+// Returns the dockerinit flags masking and remounting read-only the
+// paths of the container, the defaults for the lists left nil, and
+// setting the propagation of its mounts
+func PathParams(c *Command) ([]string, error) {
+	masked, readonly := c.MaskedPaths, c.ReadonlyPaths
+	if masked == nil {
+		masked = DefaultMaskedPaths
+	}
+	if readonly == nil && !c.Privileged {
+		readonly = DefaultReadonlyPaths
+	}
+	var params []string
+	for _, list := range []struct {
+		flag  string
+		paths []string
+	}{{"-masked-paths", masked}, {"-readonly-paths", readonly}} {
+		if len(list.paths) == 0 {
+			continue
+		}
+		for _, p := range list.paths {
+			if !filepath.IsAbs(p) || strings.Contains(p, ":") {
+				return nil, fmt.Errorf("Invalid path %q for %s, it must be absolute and not contain ':'", p, list.flag[1:])
+			}
+		}
+		params = append(params, list.flag, strings.Join(list.paths, ":"))
+	}
+
+	var propagations []string
+	for _, m := range c.Mounts {
+		if err := ValidateMountPropagation(m.Propagation()); err != nil {
+			return nil, err
+		}
+		if strings.Contains(m.Destination, ":") {
+			return nil, fmt.Errorf("Invalid mount destination %q for propagation, it must not contain ':'", m.Destination)
+		}
+		propagations = append(propagations, m.Destination+"="+m.Propagation())
+	}
+	if len(propagations) > 0 {
+		params = append(params, "-propagation", strings.Join(propagations, ":"))
+	}
+	return params, nil
+}
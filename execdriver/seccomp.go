@@ -0,0 +1,22 @@
+package execdriver
+
+import (
+	"github.com/dotcloud/docker/pkg/seccomp"
+)
+
+// Returns the dockerinit flags installing the seccomp profile of the
+// container. The profile is loaded here as its path is on the host.
+func SeccompParams(c *Command) ([]string, error) {
+	if c.SeccompProfile == "" {
+		return nil, nil
+	}
+	profile, err := seccomp.Load(c.SeccompProfile)
+	if err != nil {
+		return nil, err
+	}
+	data, err := profile.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return []string{"-seccomp", data}, nil
+}
@@ -1,6 +1,6 @@
 // +build amd64
 
-package lxc
+package setup
 
 import (
 	"syscall"
@@ -9,3 +9,7 @@ import (
 func setHostname(hostname string) error {
 	return syscall.Sethostname([]byte(hostname))
 }
+
+func setDomainname(domainname string) error {
+	return syscall.Setdomainname([]byte(domainname))
+}
@@ -1,7 +1,11 @@
 // +build !linux !amd64
 
-package lxc
+package setup
 
 func setHostname(hostname string) error {
 	panic("Not supported on darwin")
 }
+
+func setDomainname(domainname string) error {
+	panic("Not supported on darwin")
+}
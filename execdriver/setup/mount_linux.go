@@ -0,0 +1,53 @@
+// +build amd64
+
+package setup
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Hide a file behind /dev/null, a directory behind an empty read-only tmpfs
+func maskPath(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if fi.IsDir() {
+		return syscall.Mount("tmpfs", path, "tmpfs", syscall.MS_RDONLY, "")
+	}
+	return syscall.Mount("/dev/null", path, "", syscall.MS_BIND, "")
+}
+
+var propagationFlags = map[string]uintptr{
+	"private":  syscall.MS_PRIVATE,
+	"rprivate": syscall.MS_PRIVATE | syscall.MS_REC,
+	"shared":   syscall.MS_SHARED,
+	"rshared":  syscall.MS_SHARED | syscall.MS_REC,
+	"slave":    syscall.MS_SLAVE,
+	"rslave":   syscall.MS_SLAVE | syscall.MS_REC,
+}
+
+// Change the propagation of the mount at path, e.g. to "rshared"
+func setPropagation(path, propagation string) error {
+	flags, ok := propagationFlags[propagation]
+	if !ok {
+		return fmt.Errorf("unknown propagation")
+	}
+	return syscall.Mount("", path, "", flags, "")
+}
+
+// Bind mount the path over itself and remount the bind read-only
+func readonlyPath(path string) error {
+	if err := syscall.Mount(path, path, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return syscall.Mount(path, path, "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY|syscall.MS_REC, "")
+}
@@ -0,0 +1,15 @@
+// +build !linux !amd64
+
+package setup
+
+func maskPath(path string) error {
+	panic("Not supported on darwin")
+}
+
+func readonlyPath(path string) error {
+	panic("Not supported on darwin")
+}
+
+func setPropagation(path, propagation string) error {
+	panic("Not supported on darwin")
+}
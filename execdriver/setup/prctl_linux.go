@@ -0,0 +1,17 @@
+// +build amd64
+
+package setup
+
+import (
+	"syscall"
+)
+
+const prSetNoNewPrivs = 38
+
+// Sets no_new_privs on the calling thread, inherited by the program it execs
+func setNoNewPrivs() error {
+	if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0, 0, 0, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
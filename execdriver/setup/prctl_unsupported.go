@@ -0,0 +1,12 @@
+// +build !linux !amd64
+
+package setup
+
+import (
+	"log"
+)
+
+func setNoNewPrivs() error {
+	log.Printf("WARNING: no_new_privs is not supported on this platform, ignoring")
+	return nil
+}
@@ -0,0 +1,24 @@
+// +build amd64
+
+package setup
+
+import (
+	"syscall"
+)
+
+// Not exported by the syscall package
+const sysSetns = 308
+
+func setNetNs(fd int) error {
+	if _, _, errno := syscall.RawSyscall(sysSetns, uintptr(fd), syscall.CLONE_NEWNET, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+const cloneNewCgroup = 0x02000000
+
+// Like setns, only moves the calling thread
+func unshareCgroupNs() error {
+	return syscall.Unshare(cloneNewCgroup)
+}
@@ -0,0 +1,107 @@
+// +build linux,amd64
+
+package setup
+
+import (
+	"fmt"
+	"github.com/dotcloud/docker/execdriver"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func init() {
+	if helper := os.Getenv("DOCKER_NS_HELPER"); helper != "" {
+		nsHelper(helper)
+	}
+}
+
+// Joins the network namespace of a sleep in a child process and checks the
+// one of the program it execs, as dockerinit does once its thread is locked
+func TestJoinNetNs(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Creating a network namespace requires root")
+	}
+	sleep := exec.Command("sleep", "30")
+	sleep.SysProcAttr = &syscall.SysProcAttr{Cloneflags: syscall.CLONE_NEWNET}
+	if err := sleep.Start(); err != nil {
+		t.Skipf("Unable to create a network namespace: %s", err)
+	}
+	defer sleep.Process.Kill()
+
+	ns := "/proc/" + strconv.Itoa(sleep.Process.Pid) + "/ns/net"
+	expected, err := os.Readlink(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := os.Readlink("/proc/self/ns/net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current == expected {
+		t.Fatalf("Expected the namespace of the sleep to be a new one")
+	}
+
+	actual, err := execInNs("net", ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual != expected {
+		t.Fatalf("Expected the program to run in %s, got %s", expected, actual)
+	}
+}
+
+func TestCgroupNamespace(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Unsharing the cgroup namespace requires root")
+	}
+	current, err := os.Readlink("/proc/self/ns/cgroup")
+	if err != nil {
+		t.Skip("Cgroup namespaces are not supported by the kernel")
+	}
+	actual, err := execInNs("cgroup", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual == current {
+		t.Fatalf("Expected the program to run in a new cgroup namespace, got %s", actual)
+	}
+}
+
+// Runs the step in the locked thread of a child process and execs readlink
+// of the namespace kind, as dockerinit runs its steps before execve
+func execInNs(kind string, args string) (string, error) {
+	cmd := exec.Command(os.Args[0], "-test.run=Test")
+	cmd.Env = append(os.Environ(), "DOCKER_NS_HELPER="+kind+":"+args)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", err, output)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func nsHelper(helper string) {
+	runtime.LockOSThread()
+	parts := strings.SplitN(helper, ":", 2)
+	var err error
+	switch parts[0] {
+	case "net":
+		var fd int
+		if fd, err = syscall.Open(parts[1], syscall.O_RDONLY, 0); err == nil {
+			err = JoinNetNs(&execdriver.InitArgs{NetNsFd: fd})
+		}
+	case "cgroup":
+		err = CgroupNamespace(&execdriver.InitArgs{CgroupNs: true})
+	}
+	if err != nil {
+		os.Stderr.WriteString(err.Error() + "\n")
+		os.Exit(1)
+	}
+	err = syscall.Exec("/bin/sh", []string{"sh", "-c", "readlink /proc/self/ns/" + parts[0]}, os.Environ())
+	os.Stderr.WriteString("exec: " + err.Error() + "\n")
+	os.Exit(1)
+}
@@ -0,0 +1,11 @@
+// +build !linux !amd64
+
+package setup
+
+func setNetNs(fd int) error {
+	panic("Not supported on darwin")
+}
+
+func unshareCgroupNs() error {
+	panic("Not supported on darwin")
+}
@@ -0,0 +1,544 @@
+// Package setup holds the steps shared by the exec drivers to prepare
+// the container environment from dockerinit before running the process
+package setup
+
+import (
+	"fmt"
+	"github.com/dotcloud/docker/execdriver"
+	"github.com/dotcloud/docker/pkg/netlink"
+	"github.com/dotcloud/docker/pkg/seccomp"
+	"github.com/dotcloud/docker/pkg/user"
+	"github.com/syndtr/gocapability/capability"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+var procSys = "/proc/sys"
+
+// Write the sysctls to /proc/sys, once the interfaces of the container
+// are up and before /proc/sys is made read-only
+func Sysctls(args *execdriver.InitArgs) error {
+	for key, value := range args.Sysctls {
+		filename := filepath.Join(procSys, strings.Replace(key, ".", "/", -1))
+		if err := ioutil.WriteFile(filename, []byte(value), 0644); err != nil {
+			return fmt.Errorf("Unable to set the sysctl %s to %s: %s", key, value, err)
+		}
+	}
+	return nil
+}
+
+// Set the hostname and domain name of the container, unless its UTS
+// namespace is the one of the host
+func Hostname(args *execdriver.InitArgs) error {
+	if args.HostUts {
+		return nil
+	}
+	if args.Domainname != "" {
+		if err := setDomainname(args.Domainname); err != nil {
+			return fmt.Errorf("Unable to set the domain name: %s", err)
+		}
+	}
+	hostname := getEnv(args, "HOSTNAME")
+	if hostname == "" {
+		return nil
+	}
+	return setHostname(hostname)
+}
+
+// Join the network namespace passed by the driver, if any
+func JoinNetNs(args *execdriver.InitArgs) error {
+	if args.NetNsFd < 0 {
+		return nil
+	}
+	defer syscall.Close(args.NetNsFd)
+	if err := setNetNs(args.NetNsFd); err != nil {
+		return fmt.Errorf("Unable to join the network namespace: %s", err)
+	}
+	return nil
+}
+
+// Unshare the cgroup namespace, once the driver moved the process to the
+// cgroups of the container and before the capabilities are dropped
+func CgroupNamespace(args *execdriver.InitArgs) error {
+	if !args.CgroupNs {
+		return nil
+	}
+	if err := unshareCgroupNs(); err != nil {
+		if err == syscall.EINVAL {
+			log.Printf("WARNING: Unable to unshare the cgroup namespace, not supported by the kernel")
+			return nil
+		}
+		return fmt.Errorf("Unable to unshare the cgroup namespace: %s", err)
+	}
+	return nil
+}
+
+// IPv6 requires links to carry packets of at least this size
+const ipv6MinMtu = 1280
+
+// Setup networking
+func Networking(args *execdriver.InitArgs) error {
+	ifaces := append([]*execdriver.InitInterface{{
+		Name:     "eth0",
+		Ip:       args.Ip,
+		Gateway:  args.Gateway,
+		Ip6:      args.Ip6,
+		Gateway6: args.Gateway6,
+		Mtu:      args.Mtu,
+	}}, args.Interfaces...)
+
+	configured := false
+	for _, i := range ifaces {
+		if i.Ip == "" && i.Ip6 == "" {
+			continue
+		}
+		if err := setupInterface(i); err != nil {
+			return err
+		}
+		configured = true
+	}
+	if configured {
+		// loopback
+		iface, err := net.InterfaceByName("lo")
+		if err != nil {
+			return fmt.Errorf("Unable to set up networking: %v", err)
+		}
+		if err := netlink.NetworkLinkUp(iface); err != nil {
+			return fmt.Errorf("Unable to set up networking: %v", err)
+		}
+	}
+	for _, i := range ifaces {
+		for _, gateway := range []string{i.Gateway, i.Gateway6} {
+			if gateway == "" {
+				continue
+			}
+			gw := net.ParseIP(gateway)
+			if gw == nil {
+				return fmt.Errorf("Unable to set up networking, %s is not a valid gateway IP", gateway)
+			}
+
+			if err := netlink.AddDefaultGw(gw); err != nil {
+				return fmt.Errorf("Unable to set up networking: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Add the addresses of the interface, set its mtu and bring it up
+func setupInterface(i *execdriver.InitInterface) error {
+	if i.Ip6 != "" && i.Mtu < ipv6MinMtu {
+		return fmt.Errorf("Unable to set up networking, mtu %d of %s is below the IPv6 minimum of %d", i.Mtu, i.Name, ipv6MinMtu)
+	}
+	iface, err := net.InterfaceByName(i.Name)
+	if err != nil {
+		return fmt.Errorf("Unable to set up networking: %v", err)
+	}
+	for _, addr := range []string{i.Ip, i.Ip6} {
+		if addr == "" {
+			continue
+		}
+		ip, ipNet, err := net.ParseCIDR(addr)
+		if err != nil {
+			return fmt.Errorf("Unable to set up networking: %v", err)
+		}
+		if err := netlink.NetworkLinkAddIp(iface, ip, ipNet); err != nil {
+			return fmt.Errorf("Unable to set up networking: %v", err)
+		}
+	}
+	if err := netlink.NetworkSetMTU(iface, i.Mtu); err != nil {
+		return fmt.Errorf("Unable to set MTU: %v", err)
+	}
+	if err := netlink.NetworkLinkUp(iface); err != nil {
+		return fmt.Errorf("Unable to set up networking: %v", err)
+	}
+	return nil
+}
+
+// Prevent the process and its children from gaining privileges,
+// e.g. through setuid binaries, once the user has been changed
+func NoNewPrivileges(args *execdriver.InitArgs) error {
+	if !args.NoNewPrivs {
+		return nil
+	}
+	if err := setNoNewPrivs(); err != nil {
+		if err == syscall.EINVAL {
+			// PR_SET_NO_NEW_PRIVS only exists since linux 3.5
+			log.Printf("WARNING: no_new_privs is not supported by this kernel, ignoring")
+			return nil
+		}
+		return fmt.Errorf("Unable to set no_new_privs: %s", err)
+	}
+	return nil
+}
+
+// Install the seccomp filter of the container. As dockerinit usually runs
+// without CAP_SYS_ADMIN at this point no_new_privs gets set first, which
+// the kernel requires to accept the filter.
+func Seccomp(args *execdriver.InitArgs) error {
+	if args.Seccomp == nil {
+		return nil
+	}
+	if err := setNoNewPrivs(); err != nil && err != syscall.EINVAL {
+		return fmt.Errorf("Unable to set no_new_privs: %s", err)
+	}
+	if err := args.Seccomp.Install(); err != nil {
+		if err == seccomp.ErrNotSupported {
+			log.Printf("WARNING: %s, running without syscall filtering", err)
+			return nil
+		}
+		return fmt.Errorf("Unable to install the seccomp profile: %s", err)
+	}
+	return nil
+}
+
+// Create the device nodes granted to the container which are not bind
+// mounted already, before the capabilities, among them CAP_MKNOD, get
+// dropped. In a user namespace mknod is not permitted, lxc bind mounts
+// the nodes of the host instead.
+func Devices(args *execdriver.InitArgs) error {
+	for _, dev := range args.Devices {
+		if _, err := os.Lstat(dev.Path); err == nil {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(dev.Path), 0755); err != nil {
+			return err
+		}
+		if err := syscall.Mknod(dev.Path, dev.Mode, int(dev.Rdev)); err != nil {
+			return fmt.Errorf("Unable to create device %s: %s", dev.Path, err)
+		}
+		// Mknod is subject to the umask, set the permissions of the host node
+		if err := os.Chmod(dev.Path, os.FileMode(dev.Mode&07777)); err != nil {
+			return err
+		}
+		if err := os.Chown(dev.Path, dev.Uid, dev.Gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Set the propagation of the mounts of the container, lxc-start only
+// applies it with lxc 3.0 and later
+func Propagation(args *execdriver.InitArgs) error {
+	for _, dest := range propagationOrder(args.Propagate) {
+		propagation := args.Propagate[dest]
+		if err := setPropagation(dest, propagation); err != nil {
+			return fmt.Errorf("Unable to make %s %s: %s", dest, propagation, err)
+		}
+	}
+	return nil
+}
+
+// Sorts destinations by depth, the recursive propagation of a mount must
+// be set before the one of the mounts nested in it
+type byDepth []string
+
+func (b byDepth) Len() int      { return len(b) }
+func (b byDepth) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byDepth) Less(i, j int) bool {
+	di, dj := strings.Count(filepath.Clean(b[i]), "/"), strings.Count(filepath.Clean(b[j]), "/")
+	if di != dj {
+		return di < dj
+	}
+	return b[i] < b[j]
+}
+
+func propagationOrder(propagate map[string]string) []string {
+	dests := make([]string, 0, len(propagate))
+	for dest := range propagate {
+		dests = append(dests, dest)
+	}
+	sort.Sort(byDepth(dests))
+	return dests
+}
+
+// Mask and remount read-only the paths given by the driver, once the
+// rootfs and its mounts are set up
+func Paths(args *execdriver.InitArgs) error {
+	for _, path := range args.Masked {
+		if err := maskPath(path); err != nil {
+			return fmt.Errorf("Unable to mask %s: %s", path, err)
+		}
+	}
+	for _, path := range args.Readonly {
+		if err := readonlyPath(path); err != nil {
+			return fmt.Errorf("Unable to make %s read-only: %s", path, err)
+		}
+	}
+	return nil
+}
+
+// Apply the resource limits, before the capabilities get dropped
+// as raising a hard limit requires CAP_SYS_RESOURCE
+func Ulimits(args *execdriver.InitArgs) error {
+	for _, u := range args.Ulimits {
+		resource, err := execdriver.RlimitResource(u.Name)
+		if err != nil {
+			return err
+		}
+		rlimit := &syscall.Rlimit{Cur: rlimitValue(u.Soft), Max: rlimitValue(u.Hard)}
+		if err := syscall.Setrlimit(resource, rlimit); err != nil {
+			return fmt.Errorf("Unable to set ulimit %s: %s", u.String(), err)
+		}
+	}
+	return nil
+}
+
+func rlimitValue(limit int64) uint64 {
+	if limit < 0 {
+		return ^uint64(0) // RLIM_INFINITY
+	}
+	return uint64(limit)
+}
+
+// Setup working directory
+func WorkingDirectory(args *execdriver.InitArgs) error {
+	if args.WorkDir == "" {
+		return nil
+	}
+	if _, err := os.Stat(args.WorkDir); os.IsNotExist(err) {
+		if !args.MkWorkDir {
+			return fmt.Errorf("Working directory %q does not exist in the container", args.WorkDir)
+		}
+		if err := os.MkdirAll(args.WorkDir, 0755); err != nil {
+			return fmt.Errorf("Unable to create the working directory %q: %v", args.WorkDir, err)
+		}
+	}
+	if err := syscall.Chdir(args.WorkDir); err != nil {
+		return fmt.Errorf("Unable to change dir to %v: %v", args.WorkDir, err)
+	}
+	return nil
+}
+
+// Takes care of dropping privileges to the desired user
+func ChangeUser(args *execdriver.InitArgs) error {
+	uid, gid, suppGids, err := user.GetUserGroupSupplementary(
+		args.User,
+		syscall.Getuid(), syscall.Getgid(),
+	)
+	if err != nil {
+		return err
+	}
+	if len(args.GroupAdd) > 0 {
+		extraGids, err := user.GetAdditionalGroups(args.GroupAdd)
+		if err != nil {
+			return err
+		}
+		suppGids = append(suppGids, extraGids...)
+	}
+
+	if err := syscall.Setgroups(suppGids); err != nil {
+		return fmt.Errorf("Setgroups failed: %v", err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("Setgid failed: %v", err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("Setuid failed: %v", err)
+	}
+
+	return nil
+}
+
+// Capabilities dropped from unprivileged containers
+var defaultDropCapabilities = []capability.Cap{
+	capability.CAP_SETPCAP,
+	capability.CAP_SYS_MODULE,
+	capability.CAP_SYS_RAWIO,
+	capability.CAP_SYS_PACCT,
+	capability.CAP_SYS_ADMIN,
+	capability.CAP_SYS_NICE,
+	capability.CAP_SYS_RESOURCE,
+	capability.CAP_SYS_TIME,
+	capability.CAP_SYS_TTY_CONFIG,
+	capability.CAP_MKNOD,
+	capability.CAP_AUDIT_WRITE,
+	capability.CAP_AUDIT_CONTROL,
+	capability.CAP_MAC_OVERRIDE,
+	capability.CAP_MAC_ADMIN,
+	capability.CAP_NET_ADMIN,
+}
+
+// Map capability names such as "net_raw" or "CAP_NET_RAW" to their value
+func GetCapabilities(names []string) ([]capability.Cap, error) {
+	var caps []capability.Cap
+	for _, name := range names {
+		found := false
+		key := strings.TrimPrefix(strings.ToLower(name), "cap_")
+		for c := capability.Cap(0); c <= capability.CAP_BLOCK_SUSPEND; c++ {
+			if c.String() == key {
+				caps = append(caps, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("Unknown capability %q", name)
+		}
+	}
+	return caps, nil
+}
+
+// Compute the capabilities to drop starting from the default
+// set, keeping the ones in add and dropping the ones in drop
+func getDropCapabilities(privileged bool, add, drop []string) ([]capability.Cap, error) {
+	keep, err := GetCapabilities(add)
+	if err != nil {
+		return nil, err
+	}
+	extra, err := GetCapabilities(drop)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []capability.Cap
+	if !privileged {
+	defaults:
+		for _, c := range defaultDropCapabilities {
+			for _, k := range keep {
+				if c == k {
+					continue defaults
+				}
+			}
+			result = append(result, c)
+		}
+	}
+	return append(result, extra...), nil
+}
+
+// Capabilities dockerinit uses to set up the container before
+// Capabilities drops the ones the container must not have
+var setupCapabilities = []capability.Cap{
+	capability.CAP_SYS_ADMIN,    // hostname, domain name
+	capability.CAP_NET_ADMIN,    // interfaces and routes
+	capability.CAP_MKNOD,        // allowed devices
+	capability.CAP_CHOWN,        // ownership of the allowed devices
+	capability.CAP_FOWNER,       // permissions of the allowed devices
+	capability.CAP_SYS_RESOURCE, // ulimits above the current hard limits
+	capability.CAP_SETPCAP,      // dropping from the bounding set
+}
+
+func hasCapability(caps []capability.Cap, c capability.Cap) bool {
+	for _, cap := range caps {
+		if cap == c {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns, by name, the capabilities the container must not have which
+// dockerinit doesn't need either so that they can go before it runs
+func EarlyDropCapabilities(privileged bool, add, drop []string) ([]string, error) {
+	caps, err := getDropCapabilities(privileged, add, drop)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, c := range caps {
+		if !hasCapability(setupCapabilities, c) {
+			names = append(names, c.String())
+		}
+	}
+	return names, nil
+}
+
+// Returns, by name, the capabilities of the container along with the ones
+// dockerinit needs, every other one, known or not, can go before it runs
+func EarlyKeepCapabilities(privileged bool, add, drop []string) ([]string, error) {
+	caps, err := getDropCapabilities(privileged, add, drop)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for c := capability.Cap(0); c <= lastCapability(); c++ {
+		if !hasCapability(caps, c) || hasCapability(setupCapabilities, c) {
+			names = append(names, c.String())
+		}
+	}
+	return names, nil
+}
+
+// The last capability both the kernel and we know about, lxc
+// refuses to keep one the kernel doesn't have
+func lastCapability() capability.Cap {
+	data, err := ioutil.ReadFile("/proc/sys/kernel/cap_last_cap")
+	if err != nil {
+		return capability.CAP_LAST_CAP
+	}
+	last, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || capability.Cap(last) > capability.CAP_LAST_CAP {
+		return capability.CAP_LAST_CAP
+	}
+	return capability.Cap(last)
+}
+
+func Capabilities(args *execdriver.InitArgs) error {
+	drop, err := getDropCapabilities(args.Privileged, args.CapAdd, args.CapDrop)
+	if err != nil {
+		return err
+	}
+	if len(drop) == 0 {
+		return nil
+	}
+
+	c, err := capability.NewPid(os.Getpid())
+	if err != nil {
+		return err
+	}
+
+	c.Unset(capability.CAPS|capability.BOUNDS, drop...)
+
+	if err := c.Apply(capability.CAPS | capability.BOUNDS); err != nil {
+		return err
+	}
+	return nil
+}
+
+func getEnv(args *execdriver.InitArgs, key string) string {
+	for _, kv := range args.Env {
+		parts := strings.SplitN(kv, "=", 2)
+		if parts[0] == key && len(parts) == 2 {
+			return parts[1]
+		}
+	}
+	return ""
+}
+
+// Used when the container does not set its own PATH
+const defaultPath = "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// The environment of the process, exactly the one of the container
+// rather than whatever dockerinit inherited from its launcher
+func execEnv(args *execdriver.InitArgs) []string {
+	env := append([]string{}, args.Env...)
+	for _, kv := range env {
+		if strings.HasPrefix(kv, "PATH=") {
+			return env
+		}
+	}
+	return append(env, defaultPath)
+}
+
+// Replace dockerinit by the process of the container
+func Exec(args *execdriver.InitArgs) error {
+	path, err := exec.LookPath(args.Args[0])
+	if err != nil {
+		log.Printf("Unable to locate %v", args.Args[0])
+		os.Exit(127)
+	}
+	if err := syscall.Exec(path, args.Args, execEnv(args)); err != nil {
+		return fmt.Errorf("dockerinit unable to execute %s - %s", path, err)
+	}
+	panic("Unreachable")
+}
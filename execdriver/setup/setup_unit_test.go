@@ -0,0 +1,241 @@
+package setup
+
+import (
+	"github.com/dotcloud/docker/execdriver"
+	"github.com/syndtr/gocapability/capability"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestGetCapabilities(t *testing.T) {
+	caps, err := GetCapabilities([]string{"net_raw", "CAP_MKNOD", "Sys_Time"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []capability.Cap{capability.CAP_NET_RAW, capability.CAP_MKNOD, capability.CAP_SYS_TIME}
+	if len(caps) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, caps)
+	}
+	for i := range expected {
+		if caps[i] != expected[i] {
+			t.Fatalf("Expected %v, got %v", expected, caps)
+		}
+	}
+
+	if _, err := GetCapabilities([]string{"CAP_DOES_NOT_EXIST"}); err == nil {
+		t.Fatal("Expected an error for an unknown capability")
+	}
+}
+
+func TestGetDropCapabilities(t *testing.T) {
+	drop, err := getDropCapabilities(false, []string{"SYS_TIME"}, []string{"NET_RAW"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hasNetRaw, hasMknod bool
+	for _, c := range drop {
+		switch c {
+		case capability.CAP_SYS_TIME:
+			t.Fatal("CAP_SYS_TIME should have been kept")
+		case capability.CAP_NET_RAW:
+			hasNetRaw = true
+		case capability.CAP_MKNOD:
+			hasMknod = true
+		}
+	}
+	if !hasNetRaw || !hasMknod {
+		t.Fatalf("Expected CAP_NET_RAW and CAP_MKNOD to be dropped, got %v", drop)
+	}
+
+	drop, err = getDropCapabilities(true, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drop) != 0 {
+		t.Fatalf("Expected privileged containers to keep every capability, got %v", drop)
+	}
+}
+
+func TestNetworkingIPv6MinMtu(t *testing.T) {
+	args := &execdriver.InitArgs{Ip6: "2001:db8::2/64", Mtu: 1000}
+	if err := Networking(args); err == nil {
+		t.Fatal("Expected an error for an mtu too small for IPv6")
+	}
+}
+
+func TestDevices(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Creating device nodes requires root")
+	}
+	dir, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dev := &execdriver.InitDevice{
+		Path: path.Join(dir, "dev", "null"),
+		Mode: syscall.S_IFCHR | 0666,
+		Rdev: 1<<8 | 3,
+		Uid:  1,
+		Gid:  2,
+	}
+	args := &execdriver.InitArgs{Devices: []*execdriver.InitDevice{dev}}
+	if err := Devices(args); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(dev.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := fi.Sys().(*syscall.Stat_t)
+	if fi.Mode()&os.ModeCharDevice == 0 || fi.Mode().Perm() != 0666 || st.Rdev != 1<<8|3 || st.Uid != 1 || st.Gid != 2 {
+		t.Fatalf("Unexpected device node %s: mode %s, rdev %d, owner %d:%d", dev.Path, fi.Mode(), st.Rdev, st.Uid, st.Gid)
+	}
+
+	// Existing nodes are left alone
+	if err := Devices(args); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUlimits(t *testing.T) {
+	var saved syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &saved); err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Setrlimit(syscall.RLIMIT_NOFILE, &saved)
+
+	args := &execdriver.InitArgs{Ulimits: []*execdriver.Ulimit{{Name: "nofile", Soft: 512, Hard: int64(saved.Max)}}}
+	if err := Ulimits(args); err != nil {
+		t.Fatal(err)
+	}
+	// The limits are inherited by the process dockerinit executes
+	output, err := exec.Command("/bin/sh", "-c", "ulimit -n").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limit := strings.TrimSpace(string(output)); limit != "512" {
+		t.Fatalf("Expected ulimit -n to report 512, got %s", limit)
+	}
+
+	args.Ulimits = []*execdriver.Ulimit{{Name: "openfiles", Soft: 512, Hard: 512}}
+	if err := Ulimits(args); err == nil {
+		t.Fatal("Expected an error for an unknown ulimit")
+	}
+}
+
+func TestExecEnv(t *testing.T) {
+	args := &execdriver.InitArgs{Env: []string{"HOME=/", "container=lxc"}}
+	if env := strings.Join(execEnv(args), " "); env != "HOME=/ container=lxc "+defaultPath {
+		t.Fatalf("Expected the default PATH to be added, got %s", env)
+	}
+
+	args.Env = []string{"PATH=/opt/bin", "HOME=/"}
+	if env := strings.Join(execEnv(args), " "); env != "PATH=/opt/bin HOME=/" {
+		t.Fatalf("Expected exactly the environment of the container, got %s", env)
+	}
+}
+
+func TestEarlyCapabilities(t *testing.T) {
+	drop, err := EarlyDropCapabilities(false, []string{"sys_time"}, []string{"net_raw"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dropped := " " + strings.Join(drop, " ") + " "
+	for _, name := range []string{"sys_module", "net_raw"} {
+		if !strings.Contains(dropped, " "+name+" ") {
+			t.Errorf("Expected %s to be dropped by lxc, got %s", name, dropped)
+		}
+	}
+	// Added ones are kept, the ones dockerinit needs go later
+	for _, name := range []string{"sys_time", "sys_admin", "net_admin", "mknod"} {
+		if strings.Contains(dropped, " "+name+" ") {
+			t.Errorf("Expected %s not to be dropped by lxc, got %s", name, dropped)
+		}
+	}
+
+	keep, err := EarlyKeepCapabilities(false, []string{"sys_time"}, []string{"net_raw"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := " " + strings.Join(keep, " ") + " "
+	for _, name := range []string{"chown", "sys_time", "sys_admin", "net_admin", "mknod"} {
+		if !strings.Contains(kept, " "+name+" ") {
+			t.Errorf("Expected %s to be kept by lxc, got %s", name, kept)
+		}
+	}
+	for _, name := range []string{"sys_module", "net_raw"} {
+		if strings.Contains(kept, " "+name+" ") {
+			t.Errorf("Expected %s not to be kept by lxc, got %s", name, kept)
+		}
+	}
+}
+
+func TestWorkingDirectory(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	args := &execdriver.InitArgs{WorkDir: path.Join(tmp, "app")}
+	if err := WorkingDirectory(args); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Fatalf("Expected an error for a missing working directory, got %v", err)
+	}
+	args.MkWorkDir = true
+	if err := WorkingDirectory(args); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(args.WorkDir); err != nil || !fi.IsDir() {
+		t.Fatalf("Expected the working directory to be created: %v", err)
+	}
+}
+
+func TestPropagationOrder(t *testing.T) {
+	order := propagationOrder(map[string]string{
+		"/a/b/c": "private",
+		"/b":     "rslave",
+		"/a/b":   "private",
+		"/a":     "rshared",
+	})
+	if strings.Join(order, " ") != "/a /b /a/b /a/b/c" {
+		t.Fatalf("Expected the mounts from the shallowest to the deepest, got %v", order)
+	}
+}
+
+func TestSysctls(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(orig string) { procSys = orig }(procSys)
+	procSys = dir
+
+	if err := os.MkdirAll(path.Join(dir, "net", "core"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	args := &execdriver.InitArgs{Sysctls: map[string]string{"net.core.somaxconn": "1024"}}
+	if err := Sysctls(args); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := ioutil.ReadFile(path.Join(dir, "net", "core", "somaxconn")); err != nil || string(content) != "1024" {
+		t.Fatalf("Expected the sysctl to be written, got %q (%v)", content, err)
+	}
+
+	args.Sysctls = map[string]string{"net.missing.key": "1"}
+	if err := Sysctls(args); err == nil || !strings.Contains(err.Error(), "net.missing.key") {
+		t.Fatalf("Expected an error naming the sysctl, got %v", err)
+	}
+}
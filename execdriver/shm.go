@@ -0,0 +1,69 @@
+package execdriver
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Size of the /dev/shm of a container with no ShmSize
+const DefaultShmSize = 64 << 20
+
+// Where the memory of the host is read from, to bound ShmSize
+var meminfoPath = "/proc/meminfo"
+
+// Returns the tmpfs option sizing the /dev/shm of a container, e.g.
+// "size=65536k", the default size when size is 0
+func ShmSizeOption(size int64) string {
+	if size == 0 {
+		size = DefaultShmSize
+	}
+	if size%1024 == 0 {
+		return fmt.Sprintf("size=%dk", size/1024)
+	}
+	return fmt.Sprintf("size=%d", size)
+}
+
+// Check the size of the /dev/shm of a container, 0 being the default,
+// is at most the memory of the host
+func ValidateShmSize(size int64) error {
+	if size == 0 {
+		return nil
+	}
+	if size < 0 {
+		return fmt.Errorf("Shm size %d must be positive", size)
+	}
+	total, err := hostMemory()
+	if err != nil {
+		// No bound to check against
+		return nil
+	}
+	if size > total {
+		return fmt.Errorf("Shm size %d is larger than the memory of the host (%d)", size, total)
+	}
+	return nil
+}
+
+// Returns the total memory of the host in bytes
+func hostMemory() (int64, error) {
+	f, err := os.Open(meminfoPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// MemTotal:       16307936 kB
+		fields := strings.Fields(s.Text())
+		if len(fields) == 3 && fields[0] == "MemTotal:" && fields[2] == "kB" {
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return kb * 1024, nil
+		}
+	}
+	return 0, fmt.Errorf("No MemTotal in %s", meminfoPath)
+}
@@ -0,0 +1,63 @@
+package execdriver
+
+import (
+	"fmt"
+	"time"
+)
+
+// State of a container as seen by its driver.
+//
+// STARTING means the driver is still setting up the container: callers
+// should poll again rather than treat it as stopped or failed, the main
+// process may not exist yet. RUNNING is reported until the driver has torn
+// the container down, so the main process may already have exited for a
+// short while, its exit code is only known once Run returns.
+type ContainerState int
+
+const (
+	StateUnknown ContainerState = iota
+	StateStopped
+	StateStarting
+	StateRunning
+	StateStopping
+	StateAborting
+	StateFreezing
+	StateFrozen
+)
+
+var stateNames = map[ContainerState]string{
+	StateUnknown:  "UNKNOWN",
+	StateStopped:  "STOPPED",
+	StateStarting: "STARTING",
+	StateRunning:  "RUNNING",
+	StateStopping: "STOPPING",
+	StateAborting: "ABORTING",
+	StateFreezing: "FREEZING",
+	StateFrozen:   "FROZEN",
+}
+
+func (s ContainerState) String() string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+	return stateNames[StateUnknown]
+}
+
+// Parse a state name as printed by String, e.g. "RUNNING"
+func ParseContainerState(name string) (ContainerState, error) {
+	for state, n := range stateNames {
+		if state != StateUnknown && n == name {
+			return state, nil
+		}
+	}
+	return StateUnknown, fmt.Errorf("Unknown container state %q", name)
+}
+
+// A change of a container seen by its driver, either a new State or OOM
+// when the container hit its memory limit
+type StateEvent struct {
+	ID    string
+	State ContainerState // StateUnknown for an OOM event
+	OOM   bool
+	Time  time.Time
+}
@@ -0,0 +1,75 @@
+package execdriver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Sysctls of the IPC namespace, the others are the net.* ones
+var ipcSysctls = []string{
+	"kernel.msgmax",
+	"kernel.msgmnb",
+	"kernel.msgmni",
+	"kernel.sem",
+	"kernel.shmall",
+	"kernel.shmmax",
+	"kernel.shmmni",
+	"kernel.shm_rmid_forced",
+}
+
+// Check the sysctl key of c can be set in its namespaces. Those which
+// aren't namespaced change the whole host, only privileged containers may
+// set them.
+func validateSysctl(c *Command, key string) error {
+	for _, part := range strings.Split(key, ".") {
+		if part == "" || part == ".." || strings.Contains(part, "/") {
+			return fmt.Errorf("Invalid sysctl %q", key)
+		}
+	}
+	switch {
+	case strings.HasPrefix(key, "net."):
+		if c.HostNetworking {
+			return fmt.Errorf("Unable to set the sysctl %s of %s in the network namespace of the host", key, c.ID)
+		}
+		if n := c.Network; n != nil && (n.NetNsPath != "" || n.NetworkContainerID != "") {
+			return fmt.Errorf("Unable to set the sysctl %s of %s in the network namespace it shares", key, c.ID)
+		}
+		return nil
+	case isIpcSysctl(key):
+		if c.IpcMode != "" {
+			return fmt.Errorf("Unable to set the sysctl %s of %s in the IPC namespace it shares", key, c.ID)
+		}
+		return nil
+	case c.Privileged:
+		return nil
+	}
+	return fmt.Errorf("The sysctl %s is not namespaced, only privileged containers may set it", key)
+}
+
+func isIpcSysctl(key string) bool {
+	if strings.HasPrefix(key, "fs.mqueue.") {
+		return true
+	}
+	for _, k := range ipcSysctls {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the dockerinit flags setting the sysctls of the container, in
+// the order of their keys
+func SysctlParams(c *Command) []string {
+	var keys []string
+	for key := range c.Sysctls {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var params []string
+	for _, key := range keys {
+		params = append(params, "-sysctl", key+"="+c.Sysctls[key])
+	}
+	return params
+}
@@ -0,0 +1,27 @@
+package execdriver
+
+import (
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Parse the content of a cgroup tasks file, one pid per line. Stray
+// whitespace is ignored and entries that aren't a pid, such as a number
+// read while the kernel was still writing it, skipped with a warning.
+func ParseTasks(tasks []byte) []int {
+	pids := []int{}
+	for _, line := range strings.Split(string(tasks), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		pid, err := strconv.Atoi(line)
+		if err != nil || pid <= 0 {
+			log.Printf("WARNING: Skipping invalid pid %q of a cgroup tasks file", line)
+			continue
+		}
+		pids = append(pids, pid)
+	}
+	return pids
+}
@@ -0,0 +1,88 @@
+package execdriver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Resource limit set by dockerinit before running the process,
+// -1 as Soft or Hard for unlimited
+type Ulimit struct {
+	Name string `json:"name"` // e.g. "nofile", see RlimitResource
+	Soft int64  `json:"soft"`
+	Hard int64  `json:"hard"`
+}
+
+// RLIMIT_* values of the limits known by name, as in ulimit(1)
+var rlimits = map[string]int{
+	"cpu":        0,
+	"fsize":      1,
+	"data":       2,
+	"stack":      3,
+	"core":       4,
+	"rss":        5,
+	"nproc":      6,
+	"nofile":     7,
+	"memlock":    8,
+	"as":         9,
+	"locks":      10,
+	"sigpending": 11,
+	"msgqueue":   12,
+	"nice":       13,
+	"rtprio":     14,
+}
+
+// Map a limit name such as "nofile" to its RLIMIT_* value
+func RlimitResource(name string) (int, error) {
+	resource, ok := rlimits[name]
+	if !ok {
+		return -1, fmt.Errorf("Unknown ulimit %q", name)
+	}
+	return resource, nil
+}
+
+// Format as the value of the dockerinit -ulimit flag, e.g. "nofile=1024:4096"
+func (u *Ulimit) String() string {
+	return fmt.Sprintf("%s=%d:%d", u.Name, u.Soft, u.Hard)
+}
+
+// Parse the value of a dockerinit -ulimit flag
+func ParseUlimit(value string) (*Ulimit, error) {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("Invalid ulimit %q", value)
+	}
+	limits := strings.SplitN(parts[1], ":", 2)
+	if len(limits) != 2 {
+		return nil, fmt.Errorf("Invalid ulimit %q, expected name=soft:hard", value)
+	}
+	soft, err := strconv.ParseInt(limits[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid soft limit for ulimit %q: %s", value, err)
+	}
+	hard, err := strconv.ParseInt(limits[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid hard limit for ulimit %q: %s", value, err)
+	}
+	return &Ulimit{Name: parts[0], Soft: soft, Hard: hard}, nil
+}
+
+// Returns the dockerinit flags setting the ulimits of the container,
+// after checking the names and that no soft limit exceeds its hard one
+func UlimitParams(c *Command) ([]string, error) {
+	var params []string
+	for _, u := range c.Ulimits {
+		if _, err := RlimitResource(u.Name); err != nil {
+			return nil, err
+		}
+		if u.Soft < -1 || u.Hard < -1 {
+			return nil, fmt.Errorf("Invalid ulimit %s, the limits must be positive or -1 for unlimited", u.String())
+		}
+		if u.Hard != -1 && (u.Soft == -1 || u.Soft > u.Hard) {
+			return nil, fmt.Errorf("Invalid ulimit %s, the soft limit exceeds the hard limit", u.String())
+		}
+		params = append(params, "-ulimit", u.String())
+	}
+	return params, nil
+}
@@ -0,0 +1,35 @@
+package execdriver
+
+import (
+	"testing"
+)
+
+func TestUlimitParams(t *testing.T) {
+	c := &Command{Ulimits: []Ulimit{{Name: "nofile", Soft: 1024, Hard: 4096}, {Name: "core", Soft: 0, Hard: -1}}}
+	params, err := UlimitParams(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(params) != 4 || params[1] != "nofile=1024:4096" || params[3] != "core=0:-1" {
+		t.Fatalf("Unexpected params %v", params)
+	}
+	u, err := ParseUlimit(params[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *u != c.Ulimits[0] {
+		t.Fatalf("Expected %v, got %v", c.Ulimits[0], u)
+	}
+
+	for _, u := range []Ulimit{
+		{Name: "files", Soft: 1, Hard: 1},
+		{Name: "nofile", Soft: 2048, Hard: 1024},
+		{Name: "nofile", Soft: -1, Hard: 1024},
+		{Name: "nproc", Soft: -2, Hard: -1},
+	} {
+		c.Ulimits = []Ulimit{u}
+		if _, err := UlimitParams(c); err == nil {
+			t.Errorf("Expected an error for ulimit %v", u)
+		}
+	}
+}
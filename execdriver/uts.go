@@ -0,0 +1,24 @@
+package execdriver
+
+import (
+	"fmt"
+)
+
+// Command.UTSMode sharing the UTS namespace of the host
+const UTSModeHost = "host"
+
+func ValidateUTSMode(mode string) error {
+	if mode == "" || mode == UTSModeHost {
+		return nil
+	}
+	return fmt.Errorf("Invalid UTS mode %q, expected host", mode)
+}
+
+// Returns the dockerinit flags of the UTS mode of the container, whose
+// hostname and domain name are left alone in the one of the host
+func UTSParams(c *Command) []string {
+	if c.UTSMode != UTSModeHost {
+		return nil
+	}
+	return []string{"-host-uts"}
+}
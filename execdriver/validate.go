@@ -0,0 +1,211 @@
+package execdriver
+
+import (
+	"fmt"
+	"github.com/dotcloud/docker/pkg/cgroups"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Lists of what is online on the host, checked against the cpusets
+var (
+	cpusOnlinePath  = "/sys/devices/system/cpu/online"
+	nodesOnlinePath = "/sys/devices/system/node/online"
+)
+
+// Validate rejects the options of c contradicting each other, e.g. host
+// networking along with joining the network namespace of a container,
+// before a driver acts on any of them. What depends on the driver, like the
+// lxc version or the cgroups mounted, is left to it.
+func (c *Command) Validate() error {
+	if n := c.Network; n != nil {
+		if n.NetNsPath != "" && n.NetworkContainerID != "" {
+			return fmt.Errorf("Unable to join both the network namespace %s and the one of container %s", n.NetNsPath, n.NetworkContainerID)
+		}
+		if c.HostNetworking && (n.NetNsPath != "" || n.NetworkContainerID != "") {
+			return fmt.Errorf("Host networking can't be combined with joining another network namespace")
+		}
+		if n.NetworkContainerID != "" && n.NetworkContainerID == c.ID {
+			return fmt.Errorf("Container %s can't join its own network namespace", c.ID)
+		}
+	}
+	if err := ValidateIpcMode(c.IpcMode); err != nil {
+		return err
+	}
+	if id := c.IpcContainer(); id == c.ID {
+		return fmt.Errorf("Container %s can't join its own IPC namespace", c.ID)
+	}
+	if err := ValidateUTSMode(c.UTSMode); err != nil {
+		return err
+	}
+	if c.UTSMode == UTSModeHost {
+		if c.Domainname != "" {
+			return fmt.Errorf("Unable to set the domain name %s of %s sharing the UTS namespace of the host", c.Domainname, c.ID)
+		}
+		for _, kv := range c.Env {
+			if strings.HasPrefix(kv, "HOSTNAME=") && kv != "HOSTNAME=" {
+				return fmt.Errorf("Unable to set the hostname %s of %s sharing the UTS namespace of the host", strings.TrimPrefix(kv, "HOSTNAME="), c.ID)
+			}
+		}
+	}
+	if len(c.UidMappings) > 0 || len(c.GidMappings) > 0 {
+		// The namespaces of the host belong to its own user namespace
+		switch {
+		case c.HostNetworking:
+			return fmt.Errorf("Host networking can't be combined with a user namespace")
+		case c.HostPid:
+			return fmt.Errorf("Sharing the pid namespace of the host can't be combined with a user namespace")
+		case c.IpcMode == IpcModeHost:
+			return fmt.Errorf("Sharing the IPC namespace of the host can't be combined with a user namespace")
+		case c.UTSMode == UTSModeHost:
+			return fmt.Errorf("Sharing the UTS namespace of the host can't be combined with a user namespace")
+		}
+	}
+	if c.AppArmorProfile != "" && c.DisableAppArmor {
+		return fmt.Errorf("Unable to confine %s with AppArmor profile %s when AppArmor is disabled", c.ID, c.AppArmorProfile)
+	}
+	if c.GenerateAppArmor && (c.AppArmorProfile != "" || c.DisableAppArmor) {
+		return fmt.Errorf("Unable to generate an AppArmor profile for %s along with another profile or with AppArmor disabled", c.ID)
+	}
+	if c.Resources != nil {
+		if err := c.Resources.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := ValidateMemorySwappiness(c.MemorySwappiness); err != nil {
+		return err
+	}
+	if err := ValidateKernelMemory(c.KernelMemory); err != nil {
+		return err
+	}
+	if err := ValidateShmSize(c.ShmSize); err != nil {
+		return err
+	}
+	if c.ShmSize != 0 && c.IpcMode != "" {
+		return fmt.Errorf("Unable to size the /dev/shm of %s, it's the one of its IPC mode %s", c.ID, c.IpcMode)
+	}
+	for key := range c.Sysctls {
+		if err := validateSysctl(c, key); err != nil {
+			return err
+		}
+	}
+	return c.RestartPolicy.Validate()
+}
+
+// Validate rejects the limits of r the kernel would refuse once applied,
+// including cpusets naming cpus or memory nodes which aren't online
+func (r *Resources) Validate() error {
+	if r.MemorySwap > 0 && r.Memory == 0 {
+		return fmt.Errorf("Memory swap limit (%d) requires a memory limit to be set", r.MemorySwap)
+	}
+	if r.MemoryReservation < 0 {
+		return fmt.Errorf("Memory reservation %d must be positive", r.MemoryReservation)
+	}
+	if r.Memory > 0 && r.MemoryReservation > r.Memory {
+		return fmt.Errorf("Memory reservation (%d) must be at most the memory limit (%d)", r.MemoryReservation, r.Memory)
+	}
+	if r.OomKillDisable && r.Memory == 0 {
+		return fmt.Errorf("Disabling the OOM killer requires a memory limit to be set")
+	}
+	if r.CpuPeriod != 0 && (r.CpuPeriod < 1000 || r.CpuPeriod > 1000000) {
+		return fmt.Errorf("Cpu period %d is out of range, it must be between 1000 and 1000000 microseconds", r.CpuPeriod)
+	}
+	if r.CpuQuota < 0 {
+		return fmt.Errorf("Cpu quota %d must be positive", r.CpuQuota)
+	}
+	if r.BlkioWeight != 0 && (r.BlkioWeight < 10 || r.BlkioWeight > 1000) {
+		return fmt.Errorf("Blkio weight %d is out of range, it must be between 10 and 1000", r.BlkioWeight)
+	}
+	if r.CpusetCpus != "" {
+		if err := validateOnlineList("cpu", r.CpusetCpus, cpusOnlinePath); err != nil {
+			return err
+		}
+	}
+	if r.CpusetMems != "" {
+		if err := validateOnlineList("memory node", r.CpusetMems, nodesOnlinePath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check the kernel memory limit of a container, 0 is unlimited, and that
+// the kernel accounts the kernel memory of the memory cgroups
+func ValidateKernelMemory(limit int64) error {
+	if limit == 0 {
+		return nil
+	}
+	if limit < 0 {
+		return fmt.Errorf("Kernel memory limit %d must be positive", limit)
+	}
+	mountpoint, err := cgroups.FindCgroupMountpoint("memory")
+	if err != nil {
+		return fmt.Errorf("Unable to limit the kernel memory, the memory cgroup is not mounted: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(mountpoint, "memory.kmem.limit_in_bytes")); err != nil {
+		return fmt.Errorf("Unable to limit the kernel memory, this kernel doesn't account it: %s", err)
+	}
+	return nil
+}
+
+// Make sure every cpu or memory node in list is present in the
+// online list read from onlinePath
+func validateOnlineList(kind, list, onlinePath string) error {
+	requested, err := parseCpuList(list)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(onlinePath)
+	if os.IsNotExist(err) {
+		// e.g. no memory nodes listed without NUMA, leave it to the kernel
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to read online %ss: %s", kind, err)
+	}
+	online, err := parseCpuList(strings.TrimSpace(string(data)))
+	if err != nil {
+		return fmt.Errorf("Unable to parse online %ss %s: %s", kind, onlinePath, err)
+	}
+	for _, cpu := range requested {
+		found := false
+		for _, o := range online {
+			if o == cpu {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("Requested %s %d from cpuset %q is not online (online: %s)", kind, cpu, list, strings.TrimSpace(string(data)))
+		}
+	}
+	return nil
+}
+
+// Parse a kernel cpu or node list such as "0-2,7" into the individual numbers
+func parseCpuList(list string) ([]int, error) {
+	var cpus []int
+	for _, part := range strings.Split(list, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		start, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid cpu list %q", list)
+		}
+		end := start
+		if len(bounds) == 2 {
+			if end, err = strconv.Atoi(bounds[1]); err != nil {
+				return nil, fmt.Errorf("Invalid cpu list %q", list)
+			}
+		}
+		if start < 0 || end < start {
+			return nil, fmt.Errorf("Invalid cpu range %q in %q", part, list)
+		}
+		for i := start; i <= end; i++ {
+			cpus = append(cpus, i)
+		}
+	}
+	return cpus, nil
+}
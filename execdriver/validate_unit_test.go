@@ -0,0 +1,133 @@
+package execdriver
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestValidateCpuList(t *testing.T) {
+	root, err := ioutil.TempDir("", "TestValidateCpuList")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	online := path.Join(root, "online")
+	if err := ioutil.WriteFile(online, []byte("0-3,6\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for list, valid := range map[string]bool{
+		"0":     true,
+		"0-3":   true,
+		"1,6":   true,
+		"2-3,6": true,
+		"4":     false,
+		"0-6":   false,
+		"3-1":   false,
+		"a":     false,
+		"":      false,
+	} {
+		if err := validateOnlineList("cpu", list, online); (err == nil) != valid {
+			t.Errorf("Unexpected result for cpu list %q: %v", list, err)
+		}
+	}
+
+	// Kernels without NUMA don't list the memory nodes
+	if err := validateOnlineList("memory node", "0", path.Join(root, "missing")); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateOnlineList("memory node", "a", path.Join(root, "missing")); err == nil {
+		t.Fatal("Expected an error for an invalid list")
+	}
+}
+
+func TestCommandValidate(t *testing.T) {
+	memory := &Resources{Memory: 33554432}
+	for _, c := range []struct {
+		command  *Command
+		expected string
+	}{
+		{&Command{ID: "1", HostNetworking: true, Network: &Network{NetworkContainerID: "2"}}, "Host networking"},
+		{&Command{ID: "1", Network: &Network{NetNsPath: "/proc/1/ns/net", NetworkContainerID: "2"}}, "both"},
+		{&Command{ID: "1", Network: &Network{NetworkContainerID: "1"}}, "its own network"},
+		{&Command{ID: "1", IpcMode: "container:1"}, "its own IPC"},
+		{&Command{ID: "1", IpcMode: "shared"}, "Invalid IPC mode"},
+		{&Command{ID: "1", HostPid: true, UidMappings: []IDMap{{0, 100000, 65536}}}, "user namespace"},
+		{&Command{ID: "1", HostNetworking: true, GidMappings: []IDMap{{0, 100000, 65536}}}, "user namespace"},
+		{&Command{ID: "1", AppArmorProfile: "docker-default", DisableAppArmor: true}, "AppArmor is disabled"},
+		{&Command{ID: "1", GenerateAppArmor: true, AppArmorProfile: "docker-default"}, "generate an AppArmor profile"},
+		{&Command{ID: "1", Resources: &Resources{MemorySwap: 67108864}}, "Memory swap limit"},
+		{&Command{ID: "1", Resources: &Resources{OomKillDisable: true}}, "OOM killer"},
+		{&Command{ID: "1", RestartPolicy: RestartPolicy{Name: "sometimes"}}, "restart policy"},
+		{&Command{ID: "1", UTSMode: "private"}, "Invalid UTS mode"},
+		{&Command{ID: "1", KernelMemory: -1}, "Kernel memory limit"},
+		{&Command{ID: "1", ShmSize: 1 << 20, IpcMode: IpcModeHost}, "IPC mode"},
+		{&Command{ID: "1", Sysctls: map[string]string{"vm.max_map_count": "262144"}}, "vm.max_map_count is not namespaced"},
+		{&Command{ID: "1", Sysctls: map[string]string{"net.core.somaxconn": "1024"}, HostNetworking: true}, "network namespace of the host"},
+		{&Command{ID: "1", Sysctls: map[string]string{"net.core.somaxconn": "1024"}, Network: &Network{NetworkContainerID: "2"}}, "network namespace it shares"},
+		{&Command{ID: "1", Sysctls: map[string]string{"net.core.somaxconn": "1024"}, Network: &Network{NetNsPath: "/var/run/netns/a"}}, "network namespace it shares"},
+		{&Command{ID: "1", Sysctls: map[string]string{"kernel.shmmax": "1"}, IpcMode: IpcModeHost}, "IPC namespace"},
+		{&Command{ID: "1", Sysctls: map[string]string{"net.../../vm": "1"}}, "Invalid sysctl"},
+		{&Command{ID: "1", UTSMode: UTSModeHost, Domainname: "example.com"}, "domain name"},
+		{&Command{ID: "1", UTSMode: UTSModeHost, Env: []string{"HOSTNAME=web"}}, "hostname web"},
+	} {
+		if err := c.command.Validate(); err == nil || !strings.Contains(err.Error(), c.expected) {
+			t.Errorf("Expected an error about %q for %+v, got %v", c.expected, c.command, err)
+		}
+	}
+
+	for _, c := range []*Command{
+		{ID: "1"},
+		{ID: "1", HostNetworking: true, Network: &Network{Bridge: "docker0"}},
+		{ID: "1", Network: &Network{NetworkContainerID: "2"}, IpcMode: "container:2"},
+		{ID: "1", UidMappings: []IDMap{{0, 100000, 65536}}, IpcMode: "container:2"},
+		{ID: "1", Resources: &Resources{Memory: 33554432, MemorySwap: -1, OomKillDisable: true}},
+		{ID: "1", Resources: memory, GenerateAppArmor: true},
+		{ID: "1", UTSMode: UTSModeHost, Env: []string{"HOSTNAME=", "PATH=/bin"}},
+		{ID: "1", Sysctls: map[string]string{"net.ipv4.ip_forward": "1", "kernel.shmmax": "1", "fs.mqueue.msg_max": "64"}},
+		{ID: "1", Sysctls: map[string]string{"vm.max_map_count": "262144"}, Privileged: true},
+	} {
+		if err := c.Validate(); err != nil {
+			t.Errorf("Expected %+v to be valid, got %s", c, err)
+		}
+	}
+}
+
+func TestValidateShmSize(t *testing.T) {
+	root, err := ioutil.TempDir("", "TestValidateShmSize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func(p string) { meminfoPath = p }(meminfoPath)
+	meminfoPath = path.Join(root, "meminfo")
+	if err := ioutil.WriteFile(meminfoPath, []byte("MemTotal:        1048576 kB\nMemFree:          524288 kB\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for size, valid := range map[int64]bool{
+		0:           true,
+		128 << 20:   true,
+		1 << 30:     true,
+		-1:          false,
+		1<<30 + 512: false,
+	} {
+		if err := ValidateShmSize(size); (err == nil) != valid {
+			t.Errorf("Unexpected result for the shm size %d: %v", size, err)
+		}
+	}
+	if option := ShmSizeOption(1000); option != "size=1000" {
+		t.Errorf("Expected a size in bytes, got %s", option)
+	}
+}
+
+func TestSysctlParams(t *testing.T) {
+	c := &Command{Sysctls: map[string]string{"net.ipv4.ip_forward": "1", "kernel.sem": "250 32000 32 128"}}
+	params := strings.Join(SysctlParams(c), " ")
+	if expected := "-sysctl kernel.sem=250 32000 32 128 -sysctl net.ipv4.ip_forward=1"; params != expected {
+		t.Fatalf("Expected %q, got %q", expected, params)
+	}
+}
@@ -29,6 +29,33 @@ func FindCgroupMountpoint(subsystem string) (string, error) {
 	return "", fmt.Errorf("cgroup mountpoint not found for %s", subsystem)
 }
 
+// Returns those of subsystems which are not mounted, reading the mounts once
+func MissingSubsystems(subsystems []string) ([]string, error) {
+	mounts, err := mount.GetMounts()
+	if err != nil {
+		return nil, err
+	}
+	return missingSubsystems(mounts, subsystems), nil
+}
+
+func missingSubsystems(mounts []*mount.MountInfo, subsystems []string) []string {
+	mounted := make(map[string]bool)
+	for _, m := range mounts {
+		if m.Fstype == "cgroup" {
+			for _, opt := range strings.Split(m.VfsOpts, ",") {
+				mounted[opt] = true
+			}
+		}
+	}
+	var missing []string
+	for _, subsystem := range subsystems {
+		if !mounted[subsystem] {
+			missing = append(missing, subsystem)
+		}
+	}
+	return missing
+}
+
 // Returns the relative path to the cgroup docker is running in.
 func GetThisCgroupDir(subsystem string) (string, error) {
 	f, err := os.Open("/proc/self/cgroup")
@@ -49,8 +76,10 @@ func parseCgroupFile(subsystem string, r io.Reader) (string, error) {
 		}
 		text := s.Text()
 		parts := strings.Split(text, ":")
-		if parts[1] == subsystem {
-			return parts[2], nil
+		for _, subs := range strings.Split(parts[1], ",") {
+			if subs == subsystem {
+				return parts[2], nil
+			}
 		}
 	}
 	return "", fmt.Errorf("cgroup '%s' not found in /proc/self/cgroup", subsystem)
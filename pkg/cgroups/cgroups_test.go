@@ -2,6 +2,8 @@ package cgroups
 
 import (
 	"bytes"
+	"github.com/dotcloud/docker/pkg/mount"
+	"reflect"
 	"testing"
 )
 
@@ -25,3 +27,26 @@ func TestParseCgroups(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestParseCgroupsJoinedSubsystems(t *testing.T) {
+	r := bytes.NewBuffer([]byte(cgroupsContents))
+	dir, err := parseCgroupFile("cpu", r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir != "/" {
+		t.Fatalf("Expected / for cpu, got %s", dir)
+	}
+}
+
+func TestMissingSubsystems(t *testing.T) {
+	mounts := []*mount.MountInfo{
+		{Mountpoint: "/sys/fs/cgroup/memory", Fstype: "cgroup", VfsOpts: "rw,memory"},
+		{Mountpoint: "/sys/fs/cgroup/cpu,cpuacct", Fstype: "cgroup", VfsOpts: "rw,cpu,cpuacct"},
+		{Mountpoint: "/sys/fs/cgroup/devices", Fstype: "tmpfs", VfsOpts: "rw,devices"},
+	}
+	missing := missingSubsystems(mounts, []string{"memory", "cpu", "cpuacct", "cpuset", "devices"})
+	if expected := []string{"cpuset", "devices"}; !reflect.DeepEqual(missing, expected) {
+		t.Fatalf("Expected %v to be missing, got %v", expected, missing)
+	}
+}
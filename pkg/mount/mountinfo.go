@@ -30,6 +30,7 @@ type MountInfo struct {
 	Id, Parent, Major, Minor int
 	Root, Mountpoint, Opts   string
 	Fstype, Source, VfsOpts  string
+	Optional                 string // optional fields, e.g. "shared:1 master:2"
 }
 
 // Parse /proc/self/mountinfo because comparing Dev and ino does not work from bind mounts
@@ -66,6 +67,14 @@ func parseInfoFile(r io.Reader) ([]*MountInfo, error) {
 		}
 		// Safe as mountinfo encodes mountpoints with spaces as \040.
 		index := strings.Index(text, " - ")
+		if index < 0 {
+			return nil, fmt.Errorf("Error did not find the '-' separator in '%s'", text)
+		}
+		// The optional fields are variable in number, from the 7th
+		// field up to the separator
+		if preSeparatorFields := strings.Fields(text[:index]); len(preSeparatorFields) > 6 {
+			p.Optional = strings.Join(preSeparatorFields[6:], " ")
+		}
 		postSeparatorFields := strings.Fields(text[index+3:])
 		if len(postSeparatorFields) != 3 {
 			return nil, fmt.Errorf("Error did not find 3 fields post '-' in '%s'", text)
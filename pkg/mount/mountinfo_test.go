@@ -443,3 +443,31 @@ func TestParseGentooMountinfo(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestParseMountinfoOptionalFields(t *testing.T) {
+	r := bytes.NewBuffer([]byte(`15 35 0:3 / /proc rw,nosuid,nodev,noexec,relatime - proc proc rw
+35 1 253:2 / / rw,relatime shared:1 master:7 propagate_from:2 - ext4 /dev/mapper/root rw,data=ordered`))
+	mounts, err := parseInfoFile(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mounts) != 2 {
+		t.Fatalf("Expected 2 mounts, got %d", len(mounts))
+	}
+	if mounts[0].Optional != "" {
+		t.Fatalf("Expected no optional fields, got %q", mounts[0].Optional)
+	}
+	if mounts[1].Optional != "shared:1 master:7 propagate_from:2" || mounts[1].Fstype != "ext4" {
+		t.Fatalf("Expected the optional fields and the fs type to be parsed, got %q and %q", mounts[1].Optional, mounts[1].Fstype)
+	}
+
+	mounts, err = parseInfoFile(bytes.NewBuffer([]byte(fedoraMountinfo)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range mounts {
+		if m.Mountpoint == "/" && m.Optional != "shared:1" {
+			t.Fatalf("Expected / to be shared:1, got %q", m.Optional)
+		}
+	}
+}
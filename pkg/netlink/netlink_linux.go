@@ -778,6 +778,31 @@ func NetworkChangeName(iface *net.Interface, newName string) error {
 	return nil
 }
 
+// Set the hardware address of an interface. Identical to:
+// ip link set dev $iface address $macaddr
+func NetworkSetMacAddress(iface *net.Interface, macaddr string) error {
+	hwaddr, err := net.ParseMAC(macaddr)
+	if err != nil {
+		return err
+	}
+	fd, err := getIfSocket()
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	// struct ifreq holding the name followed by a struct sockaddr
+	data := [IFNAMSIZ + 24]byte{}
+	copy(data[:IFNAMSIZ-1], iface.Name)
+	*(*uint16)(unsafe.Pointer(&data[IFNAMSIZ])) = syscall.ARPHRD_ETHER
+	copy(data[IFNAMSIZ+2:IFNAMSIZ+16], hwaddr)
+
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.SIOCSIFHWADDR, uintptr(unsafe.Pointer(&data[0]))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
 func NetworkCreateVethPair(name1, name2 string) error {
 	s, err := getNetlinkSocket()
 	if err != nil {
@@ -44,6 +44,10 @@ func NetworkChangeName(iface *net.Interface, newName string) error {
 	return ErrNotImplemented
 }
 
+func NetworkSetMacAddress(iface *net.Interface, macaddr string) error {
+	return ErrNotImplemented
+}
+
 func NetworkSetNsFd(iface *net.Interface, fd int) error {
 	return ErrNotImplemented
 }
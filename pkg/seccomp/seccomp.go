@@ -0,0 +1,114 @@
+// Package seccomp loads the syscall filtering profiles of containers
+// and installs them as seccomp BPF filters
+package seccomp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+const (
+	ActAllow = "allow" // let the syscall through
+	ActErrno = "errno" // fail the syscall with EPERM
+	ActKill  = "kill"  // kill the process
+
+	// name of the profile shipped with docker
+	DefaultProfileName = "default"
+)
+
+var ErrNotSupported = errors.New("seccomp filtering is not supported by this kernel")
+
+type Rule struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+}
+
+// Profile applies the action of the first rule matching a syscall,
+// or DefaultAction when none does
+type Profile struct {
+	DefaultAction string  `json:"default_action"`
+	Syscalls      []*Rule `json:"syscalls"`
+}
+
+// Default denies the syscalls allowing a container to administer the
+// host, its kernel or other processes
+var Default = &Profile{
+	DefaultAction: ActAllow,
+	Syscalls: denyAll(
+		"acct", "add_key", "adjtimex", "clock_adjtime", "clock_settime",
+		"create_module", "delete_module", "finit_module", "get_kernel_syms",
+		"init_module", "ioperm", "iopl", "kcmp", "kexec_load", "keyctl",
+		"lookup_dcookie", "mount", "name_to_handle_at", "nfsservctl",
+		"open_by_handle_at", "perf_event_open", "pivot_root",
+		"process_vm_readv", "process_vm_writev", "ptrace", "query_module",
+		"quotactl", "reboot", "request_key", "setns", "settimeofday",
+		"swapoff", "swapon", "_sysctl", "sysfs", "umount2", "unshare", "uselib",
+	),
+}
+
+func denyAll(names ...string) []*Rule {
+	rules := make([]*Rule, len(names))
+	for i, name := range names {
+		rules[i] = &Rule{Name: name, Action: ActErrno}
+	}
+	return rules
+}
+
+// Load reads the JSON profile at path, DefaultProfileName
+// giving the profile shipped with docker
+func Load(path string) (*Profile, error) {
+	if path == DefaultProfileName {
+		return Default, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read seccomp profile: %s", err)
+	}
+	return Decode(string(data))
+}
+
+// Decode parses and validates a JSON profile
+func Decode(data string) (*Profile, error) {
+	p := &Profile{}
+	if err := json.Unmarshal([]byte(data), p); err != nil {
+		return nil, fmt.Errorf("Invalid seccomp profile: %s", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Encode the profile as compact JSON, suitable for a dockerinit flag
+func (p *Profile) Encode() (string, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (p *Profile) Validate() error {
+	if err := validateAction(p.DefaultAction); err != nil {
+		return err
+	}
+	for _, r := range p.Syscalls {
+		if _, exists := syscalls[r.Name]; !exists {
+			return fmt.Errorf("Unknown syscall %q in seccomp profile", r.Name)
+		}
+		if err := validateAction(r.Action); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateAction(action string) error {
+	switch action {
+	case ActAllow, ActErrno, ActKill:
+		return nil
+	}
+	return fmt.Errorf("Invalid seccomp action %q, expected %s, %s or %s", action, ActAllow, ActErrno, ActKill)
+}
@@ -0,0 +1,83 @@
+// +build amd64
+
+package seccomp
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const (
+	prSetSeccomp      = 22
+	seccompModeFilter = 2
+
+	retKill  = 0x00000000
+	retErrno = 0x00050000
+	retAllow = 0x7fff0000
+
+	auditArchX86_64 = 0xc000003e
+	x32SyscallBit   = 0x40000000
+
+	// offsets in struct seccomp_data
+	offsetNr   = 0
+	offsetArch = 4
+)
+
+func actionValue(action string) uint32 {
+	switch action {
+	case ActAllow:
+		return retAllow
+	case ActErrno:
+		return retErrno | uint32(syscall.EPERM)
+	}
+	return retKill
+}
+
+func stmt(code uint16, k uint32) syscall.SockFilter {
+	return syscall.SockFilter{Code: code, K: k}
+}
+
+func jump(code uint16, k uint32, jt, jf uint8) syscall.SockFilter {
+	return syscall.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+}
+
+// Compile the profile to a BPF program. Syscalls made through another
+// ABI than x86_64, e.g. by 32-bit binaries, get denied as the numbers
+// of the rules would not match them.
+func (p *Profile) compile() []syscall.SockFilter {
+	deny := actionValue(ActErrno)
+	filter := []syscall.SockFilter{
+		stmt(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, offsetArch),
+		jump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, auditArchX86_64, 1, 0),
+		stmt(syscall.BPF_RET|syscall.BPF_K, deny),
+		stmt(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, offsetNr),
+		jump(syscall.BPF_JMP|syscall.BPF_JGE|syscall.BPF_K, x32SyscallBit, 0, 1),
+		stmt(syscall.BPF_RET|syscall.BPF_K, deny),
+	}
+	for _, r := range p.Syscalls {
+		filter = append(filter,
+			jump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, syscalls[r.Name], 0, 1),
+			stmt(syscall.BPF_RET|syscall.BPF_K, actionValue(r.Action)),
+		)
+	}
+	return append(filter, stmt(syscall.BPF_RET|syscall.BPF_K, actionValue(p.DefaultAction)))
+}
+
+// Install the profile as the seccomp filter of the calling thread, it is
+// inherited by the children and kept across execve. The process must
+// either have CAP_SYS_ADMIN or have set no_new_privs beforehand.
+func (p *Profile) Install() error {
+	filter := p.compile()
+	prog := syscall.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: &filter[0],
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetSeccomp, seccompModeFilter, uintptr(unsafe.Pointer(&prog))); errno != 0 {
+		if errno == syscall.EINVAL {
+			// kernel built without CONFIG_SECCOMP_FILTER
+			return ErrNotSupported
+		}
+		return errno
+	}
+	return nil
+}
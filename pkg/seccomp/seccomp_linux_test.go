@@ -0,0 +1,51 @@
+// +build amd64
+
+package seccomp
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+)
+
+// Installs a profile denying getcwd in a child process, as
+// a filter can not be removed once installed
+func TestInstall(t *testing.T) {
+	if os.Getenv("DOCKER_SECCOMP_HELPER") == "1" {
+		installHelper()
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=TestInstall")
+	cmd.Env = append(os.Environ(), "DOCKER_SECCOMP_HELPER=1")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %s", err, output)
+	}
+}
+
+func installHelper() {
+	// PR_SET_NO_NEW_PRIVS
+	if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, 38, 1, 0, 0, 0, 0); errno != 0 {
+		os.Exit(0)
+	}
+	p := &Profile{
+		DefaultAction: ActAllow,
+		Syscalls:      []*Rule{{Name: "getcwd", Action: ActErrno}},
+	}
+	if err := p.Install(); err == ErrNotSupported {
+		os.Exit(0)
+	} else if err != nil {
+		os.Stderr.WriteString("Install: " + err.Error() + "\n")
+		os.Exit(1)
+	}
+	if _, err := syscall.Getwd(); err != syscall.EPERM {
+		os.Stderr.WriteString("Expected getcwd to fail with EPERM\n")
+		os.Exit(1)
+	}
+	if syscall.Getpid() <= 0 {
+		os.Stderr.WriteString("Expected getpid to be allowed\n")
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
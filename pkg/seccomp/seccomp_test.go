@@ -0,0 +1,57 @@
+package seccomp
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestDefaultProfileIsValid(t *testing.T) {
+	if err := Default.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-seccomp-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for data, valid := range map[string]bool{
+		`{"default_action": "allow", "syscalls": [{"name": "ptrace", "action": "kill"}]}`:  true,
+		`{"default_action": "errno", "syscalls": []}`:                                      true,
+		`{"default_action": "deny"}`:                                                       false,
+		`{"default_action": "allow", "syscalls": [{"name": "unknown", "action": "kill"}]}`: false,
+		`{"default_action": "allow", "syscalls": [{"name": "mount", "action": "trace"}]}`:  false,
+		`not json`: false,
+	} {
+		p := path.Join(dir, "profile.json")
+		if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(p); (err == nil) != valid {
+			t.Errorf("Unexpected result loading %s: %v", data, err)
+		}
+	}
+
+	if p, err := Load(DefaultProfileName); err != nil || p != Default {
+		t.Fatalf("Expected the default profile, got %v (%v)", p, err)
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	data, err := Default.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.DefaultAction != Default.DefaultAction || len(p.Syscalls) != len(Default.Syscalls) {
+		t.Fatalf("Expected %v, got %v", Default, p)
+	}
+}
@@ -0,0 +1,9 @@
+// +build !linux !amd64
+
+package seccomp
+
+var syscalls = map[string]uint32{}
+
+func (p *Profile) Install() error {
+	return ErrNotSupported
+}
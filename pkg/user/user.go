@@ -239,3 +239,36 @@ func GetUserGroupSupplementary(userSpec string, defaultUid int, defaultGid int)
 
 	return uid, gid, suppGids, nil
 }
+
+// Given names or ids of groups, e.g. "video" or "44", returns their GIDs
+// as listed in /etc/group. Numeric ids are accepted even when not listed.
+func GetAdditionalGroups(additionalGroups []string) ([]int, error) {
+	groups, err := ParseGroup()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("Unable to find additional groups %v: %v", additionalGroups, err)
+	}
+	return resolveGroups(additionalGroups, groups)
+}
+
+func resolveGroups(additionalGroups []string, groups []*Group) ([]int, error) {
+	gids := []int{}
+	for _, ag := range additionalGroups {
+		found := false
+		for _, g := range groups {
+			if g.Name == ag || strconv.Itoa(g.Gid) == ag {
+				gids = append(gids, g.Gid)
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		gid, err := strconv.Atoi(ag)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to find group %v", ag)
+		}
+		gids = append(gids, gid)
+	}
+	return gids, nil
+}
@@ -92,3 +92,23 @@ this is just some garbage data
 		t.Fatalf("Expected groups[1] to be 4 - adm - 3 members, got %v - %v - %v", groups[1].Gid, groups[1].Name, len(groups[1].List))
 	}
 }
+
+func TestUserResolveGroups(t *testing.T) {
+	groups, err := parseGroupFile(strings.NewReader(`
+video:x:44:
+docker:x:999:alice
+`), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	gids, err := resolveGroups([]string{"docker", "44", "1234"}, groups)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(gids) != 3 || gids[0] != 999 || gids[1] != 44 || gids[2] != 1234 {
+		t.Fatalf("Expected gids [999 44 1234], got %v", gids)
+	}
+	if _, err := resolveGroups([]string{"audio"}, groups); err == nil {
+		t.Fatalf("Expected an error for an unknown group name")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/dotcloud/docker/engine"
 	"github.com/dotcloud/docker/execdriver"
 	"github.com/dotcloud/docker/execdriver/lxc"
+	"github.com/dotcloud/docker/execdriver/native"
 	"github.com/dotcloud/docker/graphdriver"
 	"github.com/dotcloud/docker/graphdriver/aufs"
 	_ "github.com/dotcloud/docker/graphdriver/btrfs"
@@ -703,7 +704,11 @@ func NewRuntimeFromDirectory(config *DaemonConfig, eng *engine.Engine) (*Runtime
 
 	sysInfo := sysinfo.New(false)
 
-	ed, err := lxc.NewDriver(config.Root, sysInfo.AppArmor)
+	var ed execdriver.Driver
+	if ed, err = lxc.NewDriver(config.Root, sysInfo.AppArmor, lxc.Options{}); err == lxc.ErrLxcStartNotFound {
+		utils.Errorf("lxc is not installed, falling back to the %s exec driver", native.DriverName)
+		ed, err = native.NewDriver()
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -820,7 +825,7 @@ func (runtime *Runtime) Kill(c *Container, sig int) error {
 	return runtime.execDriver.Kill(c.command, sig)
 }
 
-func (runtime *Runtime) RestoreCommand(c *Container) error {
+func (runtime *Runtime) RestoreCommand(c *Container) (int, error) {
 	return runtime.execDriver.Restore(c.command)
 }
 
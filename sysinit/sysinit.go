@@ -7,9 +7,13 @@ import (
 	"github.com/dotcloud/docker/execdriver"
 	_ "github.com/dotcloud/docker/execdriver/chroot"
 	_ "github.com/dotcloud/docker/execdriver/lxc"
+	_ "github.com/dotcloud/docker/execdriver/native"
+	"github.com/dotcloud/docker/pkg/seccomp"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 )
 
@@ -25,6 +29,93 @@ func setupEnv(args *execdriver.InitArgs) {
 	}
 }
 
+// Split a flag value, an empty value gives an empty list
+func splitList(value, sep string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, sep)
+}
+
+// Repeatable flag collecting the interfaces given with -iface
+type interfaceList []*execdriver.InitInterface
+
+func (l *interfaceList) String() string {
+	var values []string
+	for _, i := range *l {
+		values = append(values, i.String())
+	}
+	return strings.Join(values, " ")
+}
+
+func (l *interfaceList) Set(value string) error {
+	iface, err := execdriver.ParseInitInterface(value)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, iface)
+	return nil
+}
+
+// Repeatable flag collecting the devices given with -device
+type deviceList []*execdriver.InitDevice
+
+func (l *deviceList) String() string {
+	var values []string
+	for _, d := range *l {
+		values = append(values, d.String())
+	}
+	return strings.Join(values, " ")
+}
+
+func (l *deviceList) Set(value string) error {
+	dev, err := execdriver.ParseInitDevice(value)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, dev)
+	return nil
+}
+
+type ulimitList []*execdriver.Ulimit
+
+func (l *ulimitList) String() string {
+	var values []string
+	for _, u := range *l {
+		values = append(values, u.String())
+	}
+	return strings.Join(values, " ")
+}
+
+func (l *ulimitList) Set(value string) error {
+	u, err := execdriver.ParseUlimit(value)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, u)
+	return nil
+}
+
+// Sysctls by key, from flags as key=value
+type sysctlMap map[string]string
+
+func (m sysctlMap) String() string {
+	var values []string
+	for key, value := range m {
+		values = append(values, key+"="+value)
+	}
+	return strings.Join(values, " ")
+}
+
+func (m sysctlMap) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("Invalid sysctl %q, expected key=value", value)
+	}
+	m[parts[0]] = parts[1]
+	return nil
+}
+
 func executeProgram(args *execdriver.InitArgs) error {
 	setupEnv(args)
 
@@ -39,6 +130,10 @@ func executeProgram(args *execdriver.InitArgs) error {
 // This code is run INSIDE the container and is responsible for setting
 // up the environment before running the actual process
 func SysInit() {
+	// The seccomp filter, the namespaces joined and no_new_privs only apply
+	// to the calling thread, keep them on the one calling execve
+	runtime.LockOSThread()
+
 	if len(os.Args) <= 1 {
 		fmt.Println("You should not invoke dockerinit manually")
 		os.Exit(1)
@@ -53,12 +148,39 @@ func SysInit() {
 		privileged = flag.Bool("privileged", false, "privileged mode")
 		mtu        = flag.Int("mtu", 1500, "interface mtu")
 		driver     = flag.String("driver", "", "exec driver")
+		capAdd     = flag.String("cap-add", "", "capabilities to add, separated by ':'")
+		capDrop    = flag.String("cap-drop", "", "capabilities to drop, separated by ':'")
+		root       = flag.String("root", "", "rootfs of the container, when the driver does not chroot into it")
+		console    = flag.String("console", "", "console device")
+		veth       = flag.String("veth", "", "interface to rename to eth0")
+		gateway6   = flag.String("g6", "", "ipv6 gateway address")
+		ip6        = flag.String("i6", "", "ipv6 address")
+		noNewPrivs = flag.Bool("no-new-privileges", false, "set no_new_privs before running the process")
+		seccompArg = flag.String("seccomp", "", "JSON seccomp profile to install")
+		domainname = flag.String("domain", "", "domain name")
+		netNsFd    = flag.Int("netns-fd", -1, "descriptor of the network namespace to join")
+		cgroupNs   = flag.Bool("cgroupns", false, "unshare the cgroup namespace")
+		mkWorkDir  = flag.Bool("create-workdir", false, "create the workdir when missing")
+		groupAdd   = flag.String("group-add", "", "supplementary groups, separated by ':'")
+		masked     = flag.String("masked-paths", "", "paths to mask, separated by ':'")
+		readonly   = flag.String("readonly-paths", "", "paths to make read-only, separated by ':'")
+		propagate  = flag.String("propagation", "", "propagation of the mounts, as destination=propagation separated by ':'")
+		hostUts    = flag.Bool("host-uts", false, "the UTS namespace is the host's, keep its hostname")
+		shmSize    = flag.Int64("shm-size", 0, "size of /dev/shm in bytes, the default when 0")
+		interfaces interfaceList
+		devices    deviceList
+		ulimits    ulimitList
+		sysctls    = make(sysctlMap)
 	)
+	flag.Var(&interfaces, "iface", "additional interface, as name,mtu,ip,gateway,ipv6,ipv6 gateway")
+	flag.Var(&devices, "device", "device node to create, as path,mode,rdev,uid,gid")
+	flag.Var(&ulimits, "ulimit", "resource limit to set, as name=soft:hard")
+	flag.Var(sysctls, "sysctl", "kernel parameter to set, as key=value")
 	flag.Parse()
 
 	// Get env
 	var env []string
-	content, err := ioutil.ReadFile("/.dockerenv")
+	content, err := ioutil.ReadFile(filepath.Join(*root, "/.dockerenv"))
 	if err != nil {
 		log.Fatalf("Unable to load environment variables: %v", err)
 	}
@@ -69,6 +191,18 @@ func SysInit() {
 	// Propagate the plugin-specific container env variable
 	env = append(env, "container="+os.Getenv("container"))
 
+	propagations, err := execdriver.ParsePropagations(splitList(*propagate, ":"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var profile *seccomp.Profile
+	if *seccompArg != "" {
+		if profile, err = seccomp.Decode(*seccompArg); err != nil {
+			log.Fatalf("Unable to load the seccomp profile: %v", err)
+		}
+	}
+
 	args := &execdriver.InitArgs{
 		User:       *user,
 		Gateway:    *gateway,
@@ -79,6 +213,29 @@ func SysInit() {
 		Args:       flag.Args(),
 		Mtu:        *mtu,
 		Driver:     *driver,
+		CapAdd:     splitList(*capAdd, ":"),
+		CapDrop:    splitList(*capDrop, ":"),
+		Root:       *root,
+		Console:    *console,
+		Gateway6:   *gateway6,
+		Ip6:        *ip6,
+		Interfaces: interfaces,
+		NoNewPrivs: *noNewPrivs,
+		Seccomp:    profile,
+		Devices:    devices,
+		Domainname: *domainname,
+		Ulimits:    ulimits,
+		NetNsFd:    *netNsFd,
+		CgroupNs:   *cgroupNs,
+		MkWorkDir:  *mkWorkDir,
+		GroupAdd:   splitList(*groupAdd, ":"),
+		Masked:     splitList(*masked, ":"),
+		Readonly:   splitList(*readonly, ":"),
+		Propagate:  propagations,
+		HostUts:    *hostUts,
+		ShmSize:    *shmSize,
+		Sysctls:    sysctls,
+		Veth:       *veth,
 	}
 
 	if err := executeProgram(args); err != nil {